@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonathanwthom/quack/secure"
+	"github.com/jonathanwthom/quack/storage"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// DirName is the directory in the user's home where caches are kept
+const DirName = ".quack-cache"
+
+const cacheVersion = 3
+
+// Source is the storage a cache is synced from
+type Source interface {
+	Objects(ctx context.Context) ([]storage.Object, error)
+	Iterate(ctx context.Context, opts storage.IterateOptions) (*storage.Iterator, error)
+}
+
+// record is a decrypted entry along with what it looked like in storage
+// when it was fetched
+type record struct {
+	Key       string             `json:"key"`
+	ETag      string             `json:"etag"`
+	ModTime   time.Time          `json:"modTime"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+	Content   string             `json:"content"`
+	Tags      []string           `json:"tags,omitempty"`
+	Mentions  []string           `json:"mentions,omitempty"`
+	Mood      string             `json:"mood,omitempty"`
+	Location  string             `json:"location,omitempty"`
+	History   []storage.Revision `json:"history,omitempty"`
+}
+
+type contents struct {
+	Version int                 `json:"version"`
+	Records map[string]record   `json:"records"`
+	Index   map[string][]string `json:"index"`
+}
+
+// Cache keeps decrypted entries and a search index in a local file, which is
+// itself encrypted with the QUACKWORD
+type Cache struct {
+	path     string
+	identity string
+	contents contents
+}
+
+// Changes counts what a sync changed
+type Changes struct {
+	Fetched int
+	Removed int
+}
+
+// Path returns where the cache for the journal with the given identity is
+// kept, under ~/.quack-cache
+func Path(identity string) (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(identity))
+
+	return filepath.Join(home, DirName, fmt.Sprintf("%x", sum[:16])), nil
+}
+
+// Open loads the cache at path for the journal with the given identity. A
+// missing cache, or one that can't be decrypted, e.g. after the QUACKWORD
+// changed, starts out empty.
+func Open(path, identity string) *Cache {
+	c := &Cache{path: path, identity: identity}
+	c.contents = contents{Version: cacheVersion, Records: map[string]record{}}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c
+	}
+
+	plaintext, err := secure.DecryptWithAD(string(data), c.additionalData())
+	if err != nil {
+		return c
+	}
+
+	var loaded contents
+	if json.Unmarshal([]byte(plaintext), &loaded) != nil || loaded.Version != cacheVersion || loaded.Records == nil {
+		return c
+	}
+	c.contents = loaded
+
+	return c
+}
+
+// additionalData ties the cache file to its journal
+func (c *Cache) additionalData() []byte {
+	return []byte("quack cache\n" + c.identity)
+}
+
+// Save encrypts the cache and writes it to disk, readable only by the user
+func (c *Cache) Save() error {
+	data, err := json.Marshal(c.contents)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := secure.EncryptWithAD(string(data), c.additionalData())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	// Write then rename, so a reader never sees half a cache.
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), ".cache-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.WriteString(tmp, encrypted); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Sync brings the cache up to date with src. Only entries that are new or
+// whose ETag or modification time changed are fetched and decrypted.
+func (c *Cache) Sync(ctx context.Context, src Source) (Changes, error) {
+	var changes Changes
+	objects, err := src.Objects(ctx)
+	if err != nil {
+		return changes, err
+	}
+
+	current := make(map[string]storage.Object, len(objects))
+	var stale []string
+	for _, obj := range objects {
+		current[obj.Key] = obj
+		r, ok := c.contents.Records[obj.Key]
+		if !ok || r.ETag != obj.ETag || !r.ModTime.Equal(obj.ModTime) {
+			stale = append(stale, obj.Key)
+		}
+	}
+
+	for key := range c.contents.Records {
+		if _, ok := current[key]; !ok {
+			delete(c.contents.Records, key)
+			changes.Removed++
+		}
+	}
+
+	if len(stale) > 0 {
+		it, err := src.Iterate(ctx, storage.IterateOptions{Keys: stale})
+		if err != nil {
+			return changes, err
+		}
+		defer it.Stop()
+
+		for {
+			entry, err := it.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return changes, err
+			}
+
+			if err := entry.SetDecryptedContent(); err != nil {
+				return changes, err
+			}
+
+			obj := current[entry.Key]
+			c.contents.Records[entry.Key] = record{
+				Key:       entry.Key,
+				ETag:      obj.ETag,
+				ModTime:   obj.ModTime,
+				CreatedAt: entry.CreatedAt,
+				UpdatedAt: entry.UpdatedAt,
+				Content:   entry.DecryptedContent,
+				Tags:      entry.Tags,
+				Mentions:  entry.Mentions,
+				Mood:      entry.Mood,
+				Location:  entry.Location,
+				History:   entry.History,
+			}
+			changes.Fetched++
+		}
+	}
+
+	if changes.Fetched+changes.Removed > 0 || c.contents.Index == nil {
+		c.reindex()
+	}
+
+	return changes, nil
+}
+
+// Entries returns the cached entries containing every one of required,
+// ignoring case, most recent first. They are already decrypted.
+func (c *Cache) Entries(required ...string) []storage.Entry {
+	var entries []storage.Entry
+	for _, key := range c.candidates(required) {
+		r := c.contents.Records[key]
+		if !containsAll(r.Content, required) {
+			continue
+		}
+
+		entries = append(entries, storage.Entry{
+			Key:              r.Key,
+			CreatedAt:        r.CreatedAt,
+			UpdatedAt:        r.UpdatedAt,
+			DecryptedContent: r.Content,
+			Tags:             r.Tags,
+			Mentions:         r.Mentions,
+			Mood:             r.Mood,
+			Location:         r.Location,
+			History:          r.History,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].Key > entries[j].Key
+	})
+
+	return entries
+}
+
+func containsAll(content string, required []string) bool {
+	content = strings.ToLower(content)
+	for _, s := range required {
+		if !strings.Contains(content, strings.ToLower(s)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Len returns how many entries are cached
+func (c *Cache) Len() int {
+	return len(c.contents.Records)
+}
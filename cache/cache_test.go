@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+type failingSource struct {
+	storage.Storage
+}
+
+func (f *failingSource) Objects(ctx context.Context) ([]storage.Object, error) {
+	return nil, errors.New("offline")
+}
+
+func newJournal(t *testing.T, contents ...string) (*storage.Storage, []storage.Entry) {
+	os.Setenv("QUACKWORD", "password")
+	s := storage.New(storage.NewMemoryBackend())
+
+	var entries []storage.Entry
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	for i, content := range contents {
+		entry := storage.NewEntry(start.Add(time.Duration(i) * time.Hour))
+		entry.Encrypt(content)
+		if err := s.Create(entry); err != nil {
+			t.Fatalf("storage.Create() returned error %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return s, entries
+}
+
+func tempPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "quack-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "cache"), func() { os.RemoveAll(dir) }
+}
+
+func TestSync(t *testing.T) {
+	s, entries := newJournal(t, "Hello World!", "Goodbye World!", "Hello again")
+	path, cleanup := tempPath(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	c := Open(path, "journal")
+	changes, err := c.Sync(ctx, s)
+	if err != nil || changes != (Changes{Fetched: 3}) {
+		t.Errorf("cache.Sync() returned %+v, %v, expected 3 fetched", changes, err)
+	}
+
+	changes, _ = c.Sync(ctx, s)
+	if changes != (Changes{}) {
+		t.Errorf("cache.Sync() without changes returned %+v, expected nothing fetched", changes)
+	}
+
+	entries[0].Encrypt("Hello edited world!")
+	s.Update(entries[0])
+	s.Delete(entries[1].Key)
+
+	changes, _ = c.Sync(ctx, s)
+	if changes != (Changes{Fetched: 1, Removed: 1}) {
+		t.Errorf("cache.Sync() after an update and delete returned %+v, expected 1 fetched and 1 removed", changes)
+	}
+
+	actual := c.Entries("hello")
+	if len(actual) != 2 || actual[0].DecryptedContent != "Hello again" || actual[1].DecryptedContent != "Hello edited world!" {
+		t.Errorf("cache.Entries(hello) returned %+v, expected both hello entries, newest first", actual)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	s, _ := newJournal(t, "Standup went long", "On call this week", "Café on the corner", "standing desk")
+	c := Open("", "journal")
+	c.Sync(context.Background(), s)
+
+	tests := []struct {
+		search   string
+		expected int
+	}{
+		{search: "", expected: 4},
+		{search: "stand", expected: 2},
+		{search: "STANDUP", expected: 1},
+		{search: "on", expected: 3},
+		{search: "café", expected: 1},
+		{search: "call this", expected: 1},
+		{search: "missing", expected: 0},
+	}
+
+	if actual := c.Entries("stand", "desk"); len(actual) != 1 || actual[0].DecryptedContent != "standing desk" {
+		t.Errorf("cache.Entries(stand, desk) returned %+v, expected standing desk", actual)
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		actual := c.Entries(test.search)
+
+		if len(actual) != test.expected {
+			t.Errorf("cache.Entries(%s) returned %d entries, expected %d", test.search, len(actual), test.expected)
+		}
+
+		for _, entry := range actual {
+			if !strings.Contains(strings.ToLower(entry.DecryptedContent), strings.ToLower(test.search)) {
+				t.Errorf("cache.Entries(%s) returned %s", test.search, entry.DecryptedContent)
+			}
+		}
+	}
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	s, _ := newJournal(t, "Hello World!")
+	path, cleanup := tempPath(t)
+	defer cleanup()
+
+	c := Open(path, "journal")
+	c.Sync(context.Background(), s)
+	if err := c.Save(); err != nil {
+		t.Fatalf("cache.Save() returned error %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "Hello") {
+		t.Errorf("cache.Save() wrote entries in plain text")
+	}
+
+	if n := Open(path, "journal").Len(); n != 1 {
+		t.Errorf("cache.Open() returned %d entries, expected 1", n)
+	}
+
+	if n := Open(path, "another journal").Len(); n != 0 {
+		t.Errorf("cache.Open() for another journal returned %d entries, expected 0", n)
+	}
+
+	os.Setenv("QUACKWORD", "another password")
+	defer os.Setenv("QUACKWORD", "password")
+	if n := Open(path, "journal").Len(); n != 0 {
+		t.Errorf("cache.Open() with another QUACKWORD returned %d entries, expected 0", n)
+	}
+}
+
+func TestSyncOffline(t *testing.T) {
+	s, _ := newJournal(t, "Hello World!")
+	c := Open("", "journal")
+	c.Sync(context.Background(), s)
+
+	if _, err := c.Sync(context.Background(), &failingSource{}); err == nil {
+		t.Errorf("cache.Sync() with unreachable storage returned no error")
+	}
+
+	if n := len(c.Entries()); n != 1 {
+		t.Errorf("cache.Entries() after a failed sync returned %d entries, expected 1", n)
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+)
+
+// The search index maps every three-character sequence in an entry, ignoring
+// case, to the keys of the entries containing it. An entry can only contain
+// a search term if it contains every trigram of the term, so the index
+// narrows a search down before any text is compared.
+
+func trigrams(text string) []string {
+	runes := []rune(strings.ToLower(text))
+	seen := make(map[string]bool)
+	var grams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		gram := string(runes[i : i+3])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+
+	return grams
+}
+
+// reindex rebuilds the search index from the cached entries
+func (c *Cache) reindex() {
+	index := make(map[string][]string)
+	for key, r := range c.contents.Records {
+		for _, gram := range trigrams(r.Content) {
+			index[gram] = append(index[gram], key)
+		}
+	}
+
+	for gram := range index {
+		sort.Strings(index[gram])
+	}
+
+	c.contents.Index = index
+}
+
+// candidates returns the keys of entries that may contain all of required
+func (c *Cache) candidates(required []string) []string {
+	var grams []string
+	for _, s := range required {
+		grams = append(grams, trigrams(s)...)
+	}
+
+	if len(grams) == 0 {
+		keys := make([]string, 0, len(c.contents.Records))
+		for key := range c.contents.Records {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	keys := c.contents.Index[grams[0]]
+	for _, gram := range grams[1:] {
+		keys = intersect(keys, c.contents.Index[gram])
+	}
+
+	return keys
+}
+
+// intersect returns the keys in both sorted lists
+func intersect(a, b []string) []string {
+	var out []string
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+
+	return out
+}
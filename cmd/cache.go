@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/jonathanwthom/quack/cache"
+)
+
+var noCache bool
+
+// cachedStore is storage that can be cached locally
+type cachedStore interface {
+	cache.Source
+	Identity() string
+}
+
+// openCache loads the local cache for the current journal and syncs it,
+// returning the sync error, if any. A cache that can't be synced is only
+// returned if it has entries to offer, and no cache is returned if caching
+// is off or unavailable.
+func openCache() (*cache.Cache, error) {
+	src, ok := store.(cachedStore)
+	if noCache || !ok || src.Identity() == "" {
+		return nil, nil
+	}
+
+	path, err := cache.Path(src.Identity())
+	if err != nil {
+		return nil, nil
+	}
+
+	c := cache.Open(path, src.Identity())
+	if _, err := c.Sync(context.Background(), src); err != nil {
+		if c.Len() == 0 {
+			return nil, err
+		}
+		return c, err
+	}
+
+	// A cache that can't be saved is still up to date for this read.
+	c.Save()
+
+	return c, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Read storage directly instead of through the local cache")
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jonathanwthom/quack/storage"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const composeHelp = "Write your entry. Enter starts a new line, Ctrl-D saves and Ctrl-C discards."
+
+// errDiscarded is returned when the user abandons an entry at the prompt
+var errDiscarded = errors.New("entry discarded")
+
+// Keys the prompt handles in raw mode
+const (
+	keyInterrupt = 3
+	keyEOF       = 4
+	keyBackspace = 8
+	keyEnter     = '\r'
+	keyNewline   = '\n'
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// composeInput and composeOutput are where compose reads and writes, so tests
+// can stand in for the terminal
+var composeInput io.Reader = os.Stdin
+var composeOutput io.Writer = os.Stderr
+
+// isTerminal reports whether compose is reading from a terminal
+var isTerminal = func() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// compose gets a new entry's text without it passing through the command
+// line, where it would end up in shell history. Piped input is read as it
+// is. At a terminal, the entry is written in the user's editor if they have
+// set one, or else at a prompt that counts characters as they are typed.
+func compose() (string, error) {
+	if !isTerminal() {
+		text, err := ioutil.ReadAll(composeInput)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(text), "\r\n"), nil
+	}
+
+	if os.Getenv("VISUAL") != "" || os.Getenv("EDITOR") != "" {
+		return editText("")
+	}
+
+	fd := int(os.Stdin.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer terminal.Restore(fd, state)
+
+	return prompt(composeInput, composeOutput, journalLimit())
+}
+
+// prompt reads an entry typed at a terminal in raw mode, showing how many
+// characters it has against limit, if there is one, at the start of the line
+// being typed. Nothing typed is echoed anywhere but out.
+func prompt(in io.Reader, out io.Writer, limit int) (string, error) {
+	r := bufio.NewReader(in)
+	lines := []string{""}
+	text := func() string { return strings.Join(lines, "\n") }
+
+	// render redraws the line being typed, led by the count so far
+	render := func() {
+		n := storage.Length(text())
+		counter := fmt.Sprintf("%3d", n)
+		if limit > 0 {
+			counter = fmt.Sprintf("%3d/%d", n, limit)
+		}
+		if limit > 0 && n > limit {
+			counter = "\x1b[31m" + counter + "\x1b[0m"
+		}
+		fmt.Fprintf(out, "\r\x1b[K%s │ %s", counter, lines[len(lines)-1])
+	}
+
+	// settle redraws the line being typed without the count, once it's done
+	settle := func() {
+		width := 3
+		if limit > 0 {
+			width = len(fmt.Sprint(limit)) + 4
+		}
+		fmt.Fprintf(out, "\r\x1b[K%*s │ %s", width, "", lines[len(lines)-1])
+	}
+
+	fmt.Fprintf(out, "%s\r\n", composeHelp)
+	render()
+
+	for {
+		c, _, err := r.ReadRune()
+		if err == io.EOF {
+			c = keyEOF
+		} else if err != nil {
+			return "", err
+		}
+
+		switch c {
+		case keyEOF:
+			settle()
+			fmt.Fprint(out, "\r\n")
+			return text(), nil
+		case keyInterrupt:
+			settle()
+			fmt.Fprint(out, "\r\n")
+			return "", errDiscarded
+		case keyEnter, keyNewline:
+			settle()
+			fmt.Fprint(out, "\r\n")
+			lines = append(lines, "")
+		case keyBackspace, keyDelete:
+			last := []rune(lines[len(lines)-1])
+			if len(last) > 0 {
+				lines[len(lines)-1] = string(last[:len(last)-1])
+			} else if len(lines) > 1 {
+				// Back up onto the end of the line before.
+				fmt.Fprint(out, "\r\x1b[K\x1b[A")
+				lines = lines[:len(lines)-1]
+			}
+		case keyEscape:
+			// Skip escape sequences such as arrow keys, which the prompt
+			// doesn't support.
+			if next, _ := r.Peek(1); len(next) == 1 && next[0] == '[' {
+				r.ReadByte()
+				for {
+					b, err := r.ReadByte()
+					if err != nil || (b >= 0x40 && b <= 0x7e) {
+						break
+					}
+				}
+			}
+		default:
+			if c >= ' ' || c == '\t' {
+				lines[len(lines)-1] += string(c)
+			}
+		}
+
+		render()
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPrompt(t *testing.T) {
+	tests := []struct {
+		typed       string
+		expected    string
+		err         error
+		description string
+	}{
+		{
+			typed:       "hello\rworld\x04",
+			expected:    "hello\nworld",
+			description: "when several lines are typed",
+		},
+		{
+			typed:       "helo\x7flo\r\x7f!\x1b[D\x04",
+			expected:    "hello!",
+			description: "when characters and a line are deleted",
+		},
+		{
+			typed:       "café",
+			expected:    "café",
+			description: "when input ends without Ctrl-D",
+		},
+		{
+			typed:       "secret\x03",
+			err:         errDiscarded,
+			description: "when the entry is discarded",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var out bytes.Buffer
+			actual, err := prompt(strings.NewReader(test.typed), &out, 280)
+
+			if actual != test.expected || err != test.err {
+				t.Errorf("cmd.prompt(%q) returned %q, %v, expected %q, %v", test.typed, actual, err, test.expected, test.err)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	prompt(strings.NewReader("quack\x04"), &out, 4)
+	if !strings.Contains(out.String(), "  4/4 │ quac") || !strings.Contains(out.String(), "\x1b[31m  5/4\x1b[0m │ quack") {
+		t.Errorf("cmd.prompt() did not count characters against the limit, wrote %q", out.String())
+	}
+}
+
+func TestNewFromStdin(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	input, terminal := composeInput, isTerminal
+	defer func() { composeInput, isTerminal = input, terminal }()
+	isTerminal = func() bool { return false }
+
+	composeInput = strings.NewReader("first line\nsecond line\n")
+	if actual := New(); actual != successMsg {
+		t.Fatalf("cmd.New() with piped input returned %s, expected %s", actual, successMsg)
+	}
+
+	entry := createdMock
+	if err := entry.SetDecryptedContent(); err != nil || entry.DecryptedContent != "first line\nsecond line" {
+		t.Errorf("cmd.New() with piped input saved %q, %v, expected both lines", entry.DecryptedContent, err)
+	}
+
+	composeInput = strings.NewReader("\n")
+	if actual := New(); actual != nothingToSaveMsg {
+		t.Errorf("cmd.New() with empty piped input returned %s, expected %s", actual, nothingToSaveMsg)
+	}
+}
@@ -3,22 +3,31 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/jonathanwthom/quack/secure"
+	"github.com/jonathanwthom/quack/storage"
 	"github.com/spf13/cobra"
 )
 
 const (
-	deleteSuccessMsg    = "Successfully deleted entry."
+	deleteSuccessMsg    = "Moved entry to the trash. Run quack restore <unique-id> to bring it back."
 	unableToDeleteError = "Unable to delete entry."
+	deleteConflictError = "Entry was changed while it was being deleted, so it was kept. Please read it and try again."
+	deleteUsageError    = "Please pass the unique id of the entry to delete, e.g. quack delete <unique-id>, or pick it with quack delete -i."
 )
 
+var deleteInteractive bool
+
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete an entry",
 	Long: `
 Delete an entry by running quack delete <unique-id>.
-The unique id of an entry can be found by running quack read -v`,
+The unique id of an entry can be found by running quack read -v, and only
+as much of it as no other entry's starts with is needed. Run quack delete -i
+to pick the entry from a list of recent ones instead.
+
+Deleted entries are moved to the trash, from which they can be restored
+with quack restore until they are purged; see quack trash.`,
 	Run: deleteRunner,
 }
 
@@ -27,20 +36,34 @@ func deleteRunner(cmd *cobra.Command, args []string) {
 	fmt.Println(result)
 }
 
-// Delete removes entries by key
+// Delete moves an entry to the trash by key
 func Delete(args ...string) string {
-	key := args[0]
+	if !deleteInteractive && len(args) != 1 {
+		return deleteUsageError
+	}
+
+	key, err := chooseKey(args, deleteInteractive)
+	if msg, ok := choiceError(err, args); ok {
+		return msg
+	}
+	if err != nil {
+		return unableToDeleteError
+	}
+
 	entry, err := store.ReadByKey(key)
 	if err != nil {
 		return unableToDeleteError
 	}
 
-	_, err = secure.Decrypt(entry.Content)
+	err = entry.SetDecryptedContent()
 	if err != nil {
 		return err.Error()
 	}
 
-	err = store.Delete(key)
+	err = store.Delete(key, entry.Unchanged())
+	if err == storage.ErrConflict {
+		return deleteConflictError
+	}
 	if err != nil {
 		return unableToDeleteError
 	}
@@ -50,4 +73,5 @@ func Delete(args ...string) string {
 
 func init() {
 	rootCmd.AddCommand(deleteCmd)
+	deleteCmd.Flags().BoolVarP(&deleteInteractive, "interactive", "i", false, "Pick the entry to delete from a list of recent ones")
 }
@@ -2,10 +2,13 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/jonathanwthom/quack/secure"
 	"github.com/jonathanwthom/quack/storage"
 )
 
@@ -18,6 +21,8 @@ func TestDelete(t *testing.T) {
 		expected           string
 		readByKeyMock      string
 		readByKeyErrorMock error
+		resolveKeyError    error
+		deleteErrorMock    error
 		description        string
 	}{
 		{
@@ -32,6 +37,24 @@ func TestDelete(t *testing.T) {
 			readByKeyMock:      "",
 			readByKeyErrorMock: errors.New("can't find that"),
 			description:        "when key to delete is not found",
+		}, {
+			args:            "changed-key",
+			expected:        deleteConflictError,
+			readByKeyMock:   "changed entry content",
+			deleteErrorMock: storage.ErrConflict,
+			description:     "when entry changes before it is deleted",
+		}, {
+			args:            "01JAB",
+			expected:        fmt.Sprintf(ambiguousKeyError, "01JAB", "2026/10/18/01JAB1\n2026/10/18/01JAB2"),
+			readByKeyMock:   "found entry content",
+			resolveKeyError: &storage.AmbiguousKeyError{Prefix: "01JAB", Keys: []string{"2026/10/18/01JAB1", "2026/10/18/01JAB2"}},
+			description:     "when the key prefix matches more than one entry",
+		}, {
+			args:            "missing",
+			expected:        fmt.Sprintf(keyNotFoundError, "missing"),
+			readByKeyMock:   "found entry content",
+			resolveKeyError: storage.ErrKeyNotFound,
+			description:     "when no key starts with the prefix",
 		},
 	}
 
@@ -39,11 +62,12 @@ func TestDelete(t *testing.T) {
 		t.Run(test.description, func(t *testing.T) {
 			expected := test.expected
 			args := test.args
-			encrypted, _ := secure.Encrypt(test.readByKeyMock)
-			readByKeyMock = storage.Entry{
-				Content: encrypted,
-			}
+			readByKeyMock = storage.NewEntry(time.Now())
+			readByKeyMock.Encrypt(test.readByKeyMock)
 			readByKeyErrorMock = test.readByKeyErrorMock
+			deleteErrorMock = test.deleteErrorMock
+			resolveKeyErrorMock = test.resolveKeyError
+			defer func() { deleteErrorMock, resolveKeyErrorMock = nil, nil }()
 
 			actual := Delete(args)
 
@@ -53,3 +77,23 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteUsage(t *testing.T) {
+	store = new(fakeStorage)
+
+	if actual := Delete(); actual != deleteUsageError {
+		t.Errorf("cmd.Delete() returned %s, expected %s", actual, deleteUsageError)
+	}
+}
+
+func TestDeleteInteractive(t *testing.T) {
+	store = new(fakeStorage)
+	entriesMock = nil
+	deleteInteractive = true
+	defer func() { deleteInteractive, pickInput, pickOutput = false, os.Stdin, os.Stderr }()
+	pickInput, pickOutput = strings.NewReader("\n"), ioutil.Discard
+
+	if actual := Delete(); actual != noEntriesToPick {
+		t.Errorf("cmd.Delete() with -i returned %s, expected %s", actual, noEntriesToPick)
+	}
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	editSuccessMsg       = "Entry saved."
+	editUnchangedMsg     = "Entry unchanged."
+	editUsageError       = "Please pass the unique id of the entry to edit, e.g. quack edit <unique-id>, or pick it with quack edit -i."
+	unableToEditError    = "Unable to edit entry."
+	emptyEntryError      = "Entry is empty, nothing was saved. Use quack delete to remove an entry."
+	editorError          = "Unable to open your editor (%v). Set EDITOR to the editor you use."
+	editedElsewhereError = "Entry was changed while you were editing it, nothing was saved. Please edit it again."
+	keptEditMsg          = "Your edit was kept, encrypted, in %s. Run quack import %s to add it as a new entry once it can be saved, then delete the file."
+	unkeptEditMsg        = "Your edit was:\n%s"
+)
+
+var editInteractive bool
+
+// editCmd represents the edit command
+var editCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit an entry in $EDITOR",
+	Long: `
+Edit an entry in your editor by running quack edit <unique-id>.
+The unique id of an entry can be found by running quack read -v, and only
+as much of it as no other entry's starts with is needed. Run quack edit -i
+to pick the entry from a list of recent ones instead.
+
+The entry opens in $VISUAL or $EDITOR, falling back to vi, from a temporary
+file only you can read, which is wiped once the editor closes. The entry keeps
+its original date, records when it was edited, and keeps what it said before
+in its history. If the edit can't be saved, e.g. because the entry changed in
+the meantime, it is kept, encrypted, in a file in your home directory that
+only you can read, which quack import can add to the journal as a new entry.`,
+	Run: EditRunner,
+}
+
+// EditRunner wraps Edit for easier testing
+func EditRunner(cmd *cobra.Command, args []string) {
+	result := Edit(args...)
+	fmt.Println(result)
+}
+
+// Edit opens an entry in the user's editor and saves the result
+func Edit(args ...string) string {
+	if !editInteractive && len(args) != 1 {
+		return editUsageError
+	}
+
+	key, err := chooseKey(args, editInteractive)
+	if msg, ok := choiceError(err, args); ok {
+		return msg
+	}
+	if err != nil {
+		return unableToEditError
+	}
+
+	entry, err := store.ReadByKey(key)
+	if err != nil {
+		return unableToEditError
+	}
+
+	if err := entry.SetDecryptedContent(); err != nil {
+		return err.Error()
+	}
+
+	msg, err := editText(entry.DecryptedContent)
+	if err != nil {
+		return fmt.Sprintf(editorError, err)
+	}
+
+	if msg == entry.DecryptedContent {
+		return editUnchangedMsg
+	}
+
+	if strings.TrimSpace(msg) == "" {
+		return emptyEntryError
+	}
+
+	if limit := journalLimit(); limit > 0 && storage.Length(msg) > limit {
+		return fmt.Sprintf(tooManyCharsError, storage.Length(msg), limit) + "\n" + keepEdit(entry, msg)
+	}
+
+	// Someone else may have saved the entry while the editor was open.
+	unchanged := entry.Unchanged()
+	if err := entry.Edit(msg, time.Now()); err != nil {
+		return err.Error()
+	}
+
+	// What was typed is kept if it can't be saved, rather than lost.
+	err = store.Update(entry, unchanged)
+	if err == storage.ErrConflict {
+		return editedElsewhereError + "\n" + keepEdit(entry, msg)
+	}
+	if tooLong, ok := err.(*storage.TooLongError); ok {
+		return fmt.Sprintf(tooManyCharsError, tooLong.Length, tooLong.Limit) + "\n" + keepEdit(entry, msg)
+	}
+	if err != nil {
+		return unableToEditError + "\n" + keepEdit(entry, msg)
+	}
+
+	return editSuccessMsg
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+	editCmd.Flags().BoolVarP(&editInteractive, "interactive", "i", false, "Pick the entry to edit from a list of recent ones")
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestEdit(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	editor, keptDir := runEditor, keptEditDir
+	defer func() {
+		runEditor, readByKeyMock, readByKeyErrorMock, updateErrorMocks = editor, storage.Entry{}, nil, nil
+		keptEditDir = keptDir
+	}()
+
+	dir, _ := ioutil.TempDir("", "quack-kept")
+	defer os.RemoveAll(dir)
+	keptEditDir = func() (string, error) { return dir, nil }
+
+	created := time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local)
+	entry := storage.NewEntry(created)
+	entry.Encrypt("Helo World!")
+
+	// typing stands in for the editor, replacing the file's text with text
+	typing := func(text string) func(string) error {
+		return func(path string) error {
+			before, _ := ioutil.ReadFile(path)
+			if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+				return fmt.Errorf("temp file has mode %v", info.Mode().Perm())
+			}
+			if string(before) != "Helo World!" {
+				return fmt.Errorf("temp file held %q", before)
+			}
+			return ioutil.WriteFile(path, []byte(text), 0600)
+		}
+	}
+
+	tests := []struct {
+		editor      func(string) error
+		readErr     error
+		args        []string
+		expected    string
+		kept        string
+		description string
+	}{
+		{
+			editor:      typing("Hello World!\n"),
+			expected:    editSuccessMsg,
+			description: "when the entry is edited",
+		},
+		{
+			editor:      typing("Helo World!\n"),
+			expected:    editUnchangedMsg,
+			description: "when the entry is left as it was",
+		},
+		{
+			editor:      typing("  \n"),
+			expected:    emptyEntryError,
+			description: "when the entry is emptied",
+		},
+		{
+			editor:      typing(strings.Repeat("quack ", 50)),
+			expected:    fmt.Sprintf(tooManyCharsError, 300, 280),
+			kept:        strings.Repeat("quack ", 50),
+			description: "when the entry is too long",
+		},
+		{
+			editor: func(path string) error {
+				updateErrorMocks = []error{storage.ErrConflict}
+				return typing("Hello World!")(path)
+			},
+			expected:    editedElsewhereError,
+			kept:        "Hello World!",
+			description: "when the entry changes while it is being edited",
+		},
+		{
+			editor:      func(string) error { return errors.New("not found") },
+			expected:    fmt.Sprintf(editorError, "not found"),
+			description: "when the editor can't be run",
+		},
+		{
+			readErr:     errors.New("missing"),
+			expected:    unableToEditError,
+			description: "when the entry can't be read",
+		},
+		{
+			args:        []string{},
+			expected:    editUsageError,
+			description: "when no entry is given",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			readByKeyMock, readByKeyErrorMock, updatedMock = entry, test.readErr, storage.Entry{}
+			runEditor = test.editor
+
+			args := test.args
+			if args == nil {
+				args = []string{entry.Key}
+			}
+
+			actual := Edit(args...)
+
+			expected := test.expected
+			if files, _ := ioutil.ReadDir(dir); len(files) > 0 {
+				path := filepath.Join(dir, files[0].Name())
+				data, _ := ioutil.ReadFile(path)
+				os.Remove(path)
+				if strings.Contains(string(data), test.kept) || files[0].Mode().Perm() != 0600 {
+					t.Errorf("cmd.Edit(%v) kept %q with mode %v, expected it encrypted and readable only by the user", args, data, files[0].Mode().Perm())
+				}
+
+				var kept []storage.Entry
+				archive, err := storage.OpenArchive(strings.TrimSpace(string(data)))
+				if err == nil {
+					kept, err = archive.Decrypted()
+				}
+				if err != nil || len(kept) != 1 || kept[0].DecryptedContent != test.kept || !kept[0].CreatedAt.Equal(created) {
+					t.Errorf("cmd.Edit(%v) kept %v, %v, expected an archive of %q created at %v", args, kept, err, test.kept, created)
+				}
+				expected += "\n" + fmt.Sprintf(keptEditMsg, path, path)
+			} else if test.kept != "" {
+				t.Errorf("cmd.Edit(%v) didn't keep the edit %q", args, test.kept)
+			}
+
+			if actual != expected {
+				t.Errorf("cmd.Edit(%v) returned %s, expected %s", args, actual, expected)
+			}
+		})
+	}
+
+	readByKeyMock, readByKeyErrorMock = entry, nil
+	runEditor = typing("Hello World!")
+	Edit(entry.Key)
+
+	saved := storage.Entry{Key: updatedMock.Key, CreatedAt: updatedMock.CreatedAt, Content: updatedMock.Content}
+	if err := saved.SetDecryptedContent(); err != nil {
+		t.Fatalf("cmd.Edit() saved an entry that fails to decrypt: %v", err)
+	}
+	if saved.DecryptedContent != "Hello World!" || !saved.CreatedAt.Equal(created) || !saved.UpdatedAt.After(created) {
+		t.Errorf("cmd.Edit() saved %q created %v and updated %v, expected the edit with its original date", saved.DecryptedContent, saved.CreatedAt, saved.UpdatedAt)
+	}
+	if len(saved.History) != 1 || saved.History[0].Content != "Helo World!" {
+		t.Errorf("cmd.Edit() saved history %v, expected the original text", saved.History)
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonathanwthom/quack/storage"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// defaultEditor is used when neither VISUAL nor EDITOR is set
+const defaultEditor = "vi"
+
+// runEditor opens path in the user's editor and waits for it to close. It is
+// a variable so tests can stand in for the editor.
+var runEditor = func(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = defaultEditor
+	}
+
+	// Editors are often set with arguments, e.g. "code --wait".
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	return cmd.Run()
+}
+
+// editText lets the user edit text in their editor and returns the result.
+// The text is only ever written to a file readable by the user alone, in
+// memory-backed /dev/shm where there is one, and is overwritten before the
+// file is removed.
+func editText(text string) (string, error) {
+	dir, err := ioutil.TempDir(secureTempDir(), "quack-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "entry.txt")
+	if err := ioutil.WriteFile(path, []byte(text), 0600); err != nil {
+		return "", err
+	}
+	defer shred(path)
+
+	if err := runEditor(path); err != nil {
+		return "", err
+	}
+
+	edited, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Editors end files with a newline the user didn't type.
+	return strings.TrimRight(string(edited), "\r\n"), nil
+}
+
+// keptEditDir is where edits that couldn't be saved are kept. It is a
+// variable so tests can keep them elsewhere.
+var keptEditDir = homedir.Dir
+
+// keepEdit keeps an edit of entry that couldn't be saved to the journal, so
+// it isn't lost, and says where. The edit is kept as a new entry in an
+// archive, encrypted like one from quack export, in a file only the user can
+// read, so quack import can add it to the journal later. If it can't be
+// written, the edit itself is returned to be printed.
+func keepEdit(entry storage.Entry, text string) string {
+	kept := storage.NewEntry(entry.CreatedAt)
+	kept.Mood, kept.Location = entry.Mood, entry.Location
+	if err := kept.Encrypt(text); err != nil {
+		return fmt.Sprintf(unkeptEditMsg, text)
+	}
+
+	dir, err := keptEditDir()
+	if err != nil {
+		return fmt.Sprintf(unkeptEditMsg, text)
+	}
+
+	f, err := ioutil.TempFile(dir, "quack-edit-*.txt")
+	if err != nil {
+		return fmt.Sprintf(unkeptEditMsg, text)
+	}
+	err = exportArchive(f, []storage.Entry{kept})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Sprintf(unkeptEditMsg, text)
+	}
+
+	return fmt.Sprintf(keptEditMsg, f.Name(), f.Name())
+}
+
+func secureTempDir() string {
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+
+	return os.TempDir()
+}
+
+// shred overwrites a file with zeros, as far as the file system allows
+func shred(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	f.Write(make([]byte, info.Size()))
+	f.Sync()
+}
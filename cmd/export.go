@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatMarkdown  = "md"
+	formatJSON      = "json"
+	formatJSONLines = "jsonl"
+	formatCSV       = "csv"
+	formatArchive   = "archive"
+)
+
+const (
+	invalidFormatError  = "Unable to export as %q. Please pass md, json, jsonl, csv or archive."
+	exportDecryptError  = "Unable to decrypt entry %s. Make sure your QUACKWORD environment variable is correct."
+	unableToExportError = "Unable to export entries: %v"
+	exportedMsg         = "Exported %d entries to %s."
+)
+
+var format string
+var output string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export every entry",
+	Long: `
+Run quack export to write out every entry, oldest first, with its unique
+id and when it was written and last edited. Pick a format with --format:
+
+  md       a Markdown document
+  json     a JSON array, with tags, mentions, mood, location and history
+  jsonl    the same as json, one entry per line
+  csv      a spreadsheet, one entry per row
+  archive  an encrypted backup of the journal as it is stored
+
+Everything but archive is decrypted, so keep it somewhere safe. An archive
+holds the entries' ciphertexts and the journal key, encrypted again as a
+whole with your QUACKWORD, and can be read anywhere the QUACKWORD is known.
+
+Entries are written to standard output, or to a file only you can read with
+--output.`,
+	Args: cobra.NoArgs,
+	Run:  ExportRunner,
+}
+
+// ExportRunner wraps Export for easier testing
+func ExportRunner(cmd *cobra.Command, args []string) {
+	result := Export(args...)
+	fmt.Println(result)
+}
+
+// exportedEntry is an entry as written by quack export in JSON
+type exportedEntry struct {
+	Key       string             `json:"key"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+	Content   string             `json:"content"`
+	Tags      []string           `json:"tags,omitempty"`
+	Mentions  []string           `json:"mentions,omitempty"`
+	Mood      string             `json:"mood,omitempty"`
+	Location  string             `json:"location,omitempty"`
+	History   []storage.Revision `json:"history,omitempty"`
+}
+
+func newExportedEntry(entry storage.Entry) exportedEntry {
+	return exportedEntry{
+		Key:       entry.Key,
+		CreatedAt: entry.CreatedAt.UTC(),
+		UpdatedAt: entry.UpdatedAt.UTC(),
+		Content:   entry.DecryptedContent,
+		Tags:      entry.Tags,
+		Mentions:  entry.Mentions,
+		Mood:      entry.Mood,
+		Location:  entry.Location,
+		History:   entry.History,
+	}
+}
+
+// exporters write decrypted entries in each format but archive
+var exporters = map[string]func(io.Writer, []storage.Entry) error{
+	formatMarkdown:  exportMarkdown,
+	formatJSON:      exportJSON,
+	formatJSONLines: exportJSONLines,
+	formatCSV:       exportCSV,
+}
+
+// Export writes every entry in the chosen format
+func Export(args ...string) string {
+	exporter, ok := exporters[format]
+	if !ok && format != formatArchive {
+		return fmt.Sprintf(invalidFormatError, format)
+	}
+
+	entries, err := store.Read()
+	if err != nil {
+		return unableToReadError
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].Key < entries[j].Key
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	var buf bytes.Buffer
+	if format == formatArchive {
+		err = exportArchive(&buf, entries)
+	} else {
+		for i := range entries {
+			if err := entries[i].SetDecryptedContent(); err != nil {
+				return fmt.Sprintf(exportDecryptError, entries[i].Key)
+			}
+		}
+		err = exporter(&buf, entries)
+	}
+	if err != nil {
+		return fmt.Sprintf(unableToExportError, err)
+	}
+
+	if output == "" {
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+
+	if err := ioutil.WriteFile(output, buf.Bytes(), 0600); err != nil {
+		return fmt.Sprintf(unableToExportError, err)
+	}
+
+	return fmt.Sprintf(exportedMsg, len(entries), output)
+}
+
+func exportMarkdown(w io.Writer, entries []storage.Entry) error {
+	loc := time.Now().Location()
+	fmt.Fprintln(w, "# Journal")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "\n## %s\n\n", entry.CreatedAt.In(loc).Format("January 2, 2006 - 3:04 PM MST"))
+		fmt.Fprintf(w, "%s\n\n", entry.DecryptedContent)
+		fmt.Fprintf(w, "- Key: `%s`\n", entry.Key)
+		fmt.Fprintf(w, "- Created: %s\n", entry.CreatedAt.UTC().Format(time.RFC3339))
+		if entry.UpdatedAt.After(entry.CreatedAt) {
+			fmt.Fprintf(w, "- Updated: %s\n", entry.UpdatedAt.UTC().Format(time.RFC3339))
+		}
+		if entry.Mood != "" {
+			fmt.Fprintf(w, "- Mood: %s\n", entry.Mood)
+		}
+		if entry.Location != "" {
+			fmt.Fprintf(w, "- Location: %s\n", entry.Location)
+		}
+	}
+
+	return nil
+}
+
+func exportJSON(w io.Writer, entries []storage.Entry) error {
+	exported := make([]exportedEntry, 0, len(entries))
+	for _, entry := range entries {
+		exported = append(exported, newExportedEntry(entry))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(exported)
+}
+
+func exportJSONLines(w io.Writer, entries []storage.Entry) error {
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(newExportedEntry(entry)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exportCSV(w io.Writer, entries []storage.Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"key", "created_at", "updated_at", "content", "tags", "mentions", "mood", "location"})
+	for _, entry := range entries {
+		cw.Write([]string{
+			entry.Key,
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			entry.UpdatedAt.UTC().Format(time.RFC3339),
+			entry.DecryptedContent,
+			strings.Join(entry.Tags, " "),
+			strings.Join(entry.Mentions, " "),
+			entry.Mood,
+			entry.Location,
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// exportArchive writes the entries as stored, and the journal header, as a
+// sealed storage.Archive
+func exportArchive(w io.Writer, entries []storage.Entry) error {
+	header, err := store.ReadHeader()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := storage.NewArchive(entries, header, time.Now()).Seal()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, sealed)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&format, "format", "f", formatMarkdown, "Format to export in: md, json, jsonl, csv or archive")
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of standard output")
+}
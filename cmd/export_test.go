@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestExport(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() { format, output = formatMarkdown, "" }()
+
+	older := storage.NewEntry(time.Date(2020, 3, 9, 15, 4, 0, 0, time.UTC))
+	older.Mood = "tired"
+	older.Encrypt("Standup, then #work with @sam")
+	newer := storage.NewEntry(time.Date(2020, 3, 10, 9, 0, 0, 0, time.UTC))
+	newer.Encrypt("Said \"hi\", then left")
+
+	tests := []struct {
+		format string
+		check  func(string) error
+	}{
+		{
+			format: formatMarkdown,
+			check: func(out string) error {
+				if !strings.HasPrefix(out, "# Journal") || !strings.Contains(out, "- Key: `"+older.Key+"`") || !strings.Contains(out, "- Mood: tired") {
+					return fmt.Errorf("missing the heading, key or mood")
+				}
+				if strings.Index(out, "Standup") > strings.Index(out, "Said") {
+					return fmt.Errorf("entries are not oldest first")
+				}
+				return nil
+			},
+		},
+		{
+			format: formatJSON,
+			check: func(out string) error {
+				var exported []exportedEntry
+				if err := json.Unmarshal([]byte(out), &exported); err != nil {
+					return err
+				}
+				if len(exported) != 2 || exported[0].Key != older.Key || exported[0].Content != "Standup, then #work with @sam" ||
+					exported[0].Tags[0] != "work" || exported[0].Mentions[0] != "sam" || !exported[1].CreatedAt.Equal(newer.CreatedAt) {
+					return fmt.Errorf("returned %+v", exported)
+				}
+				return nil
+			},
+		},
+		{
+			format: formatJSONLines,
+			check: func(out string) error {
+				lines := strings.Split(out, "\n")
+				var last exportedEntry
+				if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &last) != nil || last.Content != "Said \"hi\", then left" {
+					return fmt.Errorf("returned %d lines ending %s", len(lines), lines[len(lines)-1])
+				}
+				return nil
+			},
+		},
+		{
+			format: formatCSV,
+			check: func(out string) error {
+				rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+				if err != nil {
+					return err
+				}
+				if len(rows) != 3 || rows[0][0] != "key" || rows[2][3] != "Said \"hi\", then left" || rows[1][1] != "2020-03-09T15:04:00Z" {
+					return fmt.Errorf("returned %v", rows)
+				}
+				return nil
+			},
+		},
+		{
+			format: formatArchive,
+			check: func(out string) error {
+				a, err := storage.OpenArchive(out)
+				if err != nil {
+					return err
+				}
+				if len(a.Entries) != 2 || a.Entries[0].Content != older.Content {
+					return fmt.Errorf("returned an archive of %+v", a.Entries)
+				}
+				return nil
+			},
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		format = test.format
+		entriesMock = []storage.Entry{newer, older}
+
+		actual := Export()
+		if err := test.check(actual); err != nil {
+			t.Errorf("cmd.Export() as %s: %v", test.format, err)
+		}
+	}
+
+	format = "pdf"
+	if actual, expected := Export(), fmt.Sprintf(invalidFormatError, "pdf"); actual != expected {
+		t.Errorf("cmd.Export() as pdf returned %s, expected %s", actual, expected)
+	}
+}
+
+func TestExportToFile(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() { format, output = formatMarkdown, "" }()
+
+	dir, _ := ioutil.TempDir("", "quack-export")
+	defer os.RemoveAll(dir)
+
+	entry := storage.NewEntry(time.Now())
+	entry.Encrypt("Hello World!")
+	entriesMock = []storage.Entry{entry}
+	format, output = formatJSON, filepath.Join(dir, "journal.json")
+
+	expected := fmt.Sprintf(exportedMsg, 1, output)
+	if actual := Export(); actual != expected {
+		t.Errorf("cmd.Export() returned %s, expected %s", actual, expected)
+	}
+
+	info, err := os.Stat(output)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("cmd.Export() wrote %s with %v, %v, expected mode 0600", output, info, err)
+	}
+}
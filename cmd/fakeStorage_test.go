@@ -1,12 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"time"
+
 	"github.com/jonathanwthom/quack/storage"
 )
 
 type fakeStorage struct{}
 
-func (s *fakeStorage) Create(msg string) error {
+var createdMock storage.Entry
+
+func (s *fakeStorage) Create(e storage.Entry) error {
+	createdMock = e
 	return nil
 }
 
@@ -17,6 +23,14 @@ func (s *fakeStorage) Read() ([]storage.Entry, error) {
 	return entriesMock, errorMock
 }
 
+func (s *fakeStorage) Iterate(ctx context.Context, opts storage.IterateOptions) (*storage.Iterator, error) {
+	if errorMock != nil {
+		return nil, errorMock
+	}
+
+	return storage.IterateSlice(entriesMock, opts), nil
+}
+
 var readByKeyMock storage.Entry
 var readByKeyErrorMock error
 
@@ -24,10 +38,133 @@ func (s *fakeStorage) ReadByKey(key string) (storage.Entry, error) {
 	return readByKeyMock, readByKeyErrorMock
 }
 
-func (s *fakeStorage) Delete(key string) error {
+var deleteErrorMock error
+
+func (s *fakeStorage) Delete(key string, conds ...storage.Precondition) error {
+	return deleteErrorMock
+}
+
+var updatedMock storage.Entry
+var updateErrorMocks []error
+
+// Update fails with each of updateErrorMocks in turn, or succeeds where it
+// is nil and after they run out,
+// replacing the entry with the same key in entriesMock
+func (s *fakeStorage) Update(e storage.Entry, conds ...storage.Precondition) error {
+	if len(updateErrorMocks) > 0 {
+		err := updateErrorMocks[0]
+		updateErrorMocks = updateErrorMocks[1:]
+		if err != nil {
+			return err
+		}
+	}
+
+	updatedMock = e
+	entries := make([]storage.Entry, len(entriesMock))
+	for i, entry := range entriesMock {
+		if entry.Key == e.Key {
+			entry = e
+		}
+		entries[i] = entry
+	}
+	entriesMock = entries
 	return nil
 }
 
-func (s *fakeStorage) Update(e storage.Entry) error {
+var headerMock []byte
+
+func (s *fakeStorage) ReadHeader() ([]byte, error) {
+	return headerMock, nil
+}
+
+func (s *fakeStorage) WriteHeader(header []byte) error {
+	headerMock = header
+	return nil
+}
+
+var reportMock storage.Report
+var reportErrorMock error
+
+func (s *fakeStorage) Verify() (storage.Report, error) {
+	return reportMock, reportErrorMock
+}
+
+var migratedMock int
+var migrateErrorMock error
+
+func (s *fakeStorage) MigrateKeys(renamed func(oldKey, newKey string)) (int, error) {
+	return migratedMock, migrateErrorMock
+}
+
+var settingsMock storage.Settings
+
+func (s *fakeStorage) ReadSettings() (storage.Settings, error) {
+	return settingsMock, nil
+}
+
+func (s *fakeStorage) WriteSettings(settings storage.Settings) error {
+	settingsMock = settings
 	return nil
 }
+
+var rotationMock *storage.Rotation
+
+func (s *fakeStorage) ReadRotation() (*storage.Rotation, error) {
+	return rotationMock, nil
+}
+
+func (s *fakeStorage) WriteRotation(r storage.Rotation) error {
+	rotationMock = &r
+	return nil
+}
+
+func (s *fakeStorage) ClearRotation() error {
+	rotationMock = nil
+	return nil
+}
+
+var trashMock []storage.TrashedEntry
+var restoredKeyMock string
+var restoreErrorMock error
+
+func (s *fakeStorage) Trash() ([]storage.TrashedEntry, error) {
+	return trashMock, nil
+}
+
+func (s *fakeStorage) Restore(key string) error {
+	restoredKeyMock = key
+	return restoreErrorMock
+}
+
+var purgedMock []string
+var purgeErrorMock error
+var purgedBeforeMock time.Time
+
+func (s *fakeStorage) Purge(before time.Time) ([]string, error) {
+	purgedBeforeMock = before
+	return purgedMock, purgeErrorMock
+}
+
+// UpdateTrashed replaces the entry with the same key in trashMock
+func (s *fakeStorage) UpdateTrashed(e storage.Entry, conds ...storage.Precondition) error {
+	trash := make([]storage.TrashedEntry, len(trashMock))
+	for i, trashed := range trashMock {
+		if trashed.Key == e.Key {
+			trashed.Entry = e
+		}
+		trash[i] = trashed
+	}
+	trashMock = trash
+	return nil
+}
+
+var resolveKeyErrorMock error
+
+// ResolveKey takes every key as it is, unless resolveKeyErrorMock is set
+func (s *fakeStorage) ResolveKey(prefix string) (string, error) {
+	if resolveKeyErrorMock != nil {
+		return "", resolveKeyErrorMock
+	}
+
+	return prefix, nil
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonathanwthom/quack/importer"
+	"github.com/jonathanwthom/quack/query"
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	invalidImportError  = "Unable to import %q. Please pass --format %s."
+	unableToParseError  = "Unable to read %s: %v"
+	unableToImportError = "Unable to import the entry from %s after importing %d: %v\nRun quack import again to import the rest."
+	importedMsg         = "Imported %d entries."
+	dryRunImportMsg     = "Dry run: %d entries would be imported."
+	duplicatesMsg       = "Skipped %d entries already in the journal."
+	emptyEntriesMsg     = "Skipped %d empty entries."
+	tooLongEntriesMsg   = "Skipped %d entries longer than %d characters, from %s."
+	importDateLayout    = "2006-01-02 15:04"
+)
+
+var importFormat string
+var importDryRun bool
+
+// importInput is where import reads from when no file is passed
+var importInput io.Reader = os.Stdin
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import [file...]",
+	Short: "Import entries from another journal",
+	Long: `
+Run quack import to add entries exported from another journal, or from
+quack itself, keeping the dates they were written. Entries are read from
+the files passed, or from standard input. Pick what they were exported
+from with --format:
+
+  quack  quack export's json or jsonl, or an archive (the default)
+  json   a JSON array, Day One's JSON export, or JSON Lines
+  jrnl   a jrnl journal or its text export
+
+Entries already in the journal, with the same text written in the same
+minute, are skipped, so importing the same file again is safe. So are
+entries longer than the journal's limit; see quack limit. Pass --dry-run to
+see what would be imported without saving anything.`,
+	Run: ImportRunner,
+}
+
+// ImportRunner wraps Import for easier testing
+func ImportRunner(cmd *cobra.Command, args []string) {
+	result := Import(args...)
+	fmt.Println(result)
+}
+
+// Import saves the entries in the files passed, or standard input, as new
+// entries with the times they were written
+func Import(args ...string) string {
+	parse, ok := importer.Lookup(importFormat)
+	if !ok {
+		return fmt.Sprintf(invalidImportError, importFormat, strings.Join(importer.Names(), ", "))
+	}
+
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	var records []importer.Record
+	for _, name := range args {
+		parsed, err := parseFile(parse, name)
+		if err != nil {
+			return fmt.Sprintf(unableToParseError, name, err)
+		}
+		records = append(records, parsed...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	// Duplicates are found in storage itself, as a stale cache could let
+	// an entry be imported twice.
+	all, err := query.Parse("")
+	if err != nil {
+		return unableToReadError
+	}
+	existing, err := readStored(all, 0)
+	if err != nil {
+		return unableToReadError
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range existing {
+		seen[importer.Hash(entry.CreatedAt, entry.DecryptedContent)] = true
+	}
+
+	limit := journalLimit()
+	var pending []importer.Record
+	var duplicates, empty int
+	var tooLong []string
+	for _, record := range records {
+		hash := importer.Hash(record.CreatedAt, record.Content)
+		switch {
+		case strings.TrimSpace(record.Content) == "":
+			empty++
+		case seen[hash]:
+			duplicates++
+		case limit > 0 && storage.Length(record.Content) > limit:
+			tooLong = append(tooLong, record.CreatedAt.Format(importDateLayout))
+		default:
+			pending = append(pending, record)
+		}
+		seen[hash] = true
+	}
+
+	results := []string{fmt.Sprintf(importedMsg, len(pending))}
+	if importDryRun {
+		results[0] = fmt.Sprintf(dryRunImportMsg, len(pending))
+	}
+	if duplicates > 0 {
+		results = append(results, fmt.Sprintf(duplicatesMsg, duplicates))
+	}
+	if empty > 0 {
+		results = append(results, fmt.Sprintf(emptyEntriesMsg, empty))
+	}
+	if len(tooLong) > 0 {
+		results = append(results, fmt.Sprintf(tooLongEntriesMsg, len(tooLong), limit, strings.Join(tooLong, ", ")))
+	}
+
+	if !importDryRun {
+		for i, record := range pending {
+			if err := importRecord(record); err != nil {
+				return fmt.Sprintf(unableToImportError, record.CreatedAt.Format(importDateLayout), i, err)
+			}
+		}
+	}
+
+	return strings.Join(results, "\n")
+}
+
+// parseFile parses the file called name, or standard input for -
+func parseFile(parse importer.Parser, name string) ([]importer.Record, error) {
+	if name == "-" {
+		return parse(importInput)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parse(f)
+}
+
+// importRecord saves record as a new entry created when it was written
+func importRecord(record importer.Record) error {
+	entry := storage.NewEntry(record.CreatedAt)
+	entry.Mood = record.Mood
+	entry.Location = record.Location
+	entry.History = record.History
+	if record.UpdatedAt.After(entry.CreatedAt) {
+		entry.UpdatedAt = record.UpdatedAt.Truncate(time.Second)
+	}
+
+	if err := entry.Encrypt(record.Content); err != nil {
+		return err
+	}
+
+	return store.Create(entry)
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVarP(&importFormat, "format", "f", importer.QuackParserName, "Format to import from: quack, json or jrnl")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show what would be imported without saving anything")
+}
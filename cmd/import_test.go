@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestImport(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() {
+		importFormat, importDryRun, importInput, settingsMock = "quack", false, os.Stdin, storage.Settings{}
+		search = ""
+	}()
+	search = ""
+	settingsMock = storage.Settings{MaxLength: 20}
+
+	existing := storage.NewEntry(time.Date(2020, 3, 9, 15, 4, 5, 0, time.UTC))
+	existing.Encrypt("Already here")
+	entriesMock = []storage.Entry{existing}
+
+	input := `[
+		{"content": "Already here", "createdAt": "2020-03-09T15:04:30Z"},
+		{"content": "Shipped it", "createdAt": "2019-06-01T08:00:00Z", "mood": "proud"},
+		{"content": "Shipped it", "createdAt": "2019-06-01T08:00:00Z"},
+		{"content": "  ", "createdAt": "2019-06-02T08:00:00Z"},
+		{"content": "This one goes on for far too long", "createdAt": "2019-06-03T08:00:00Z"}
+	]`
+	tooLong := time.Date(2019, 6, 3, 8, 0, 0, 0, time.UTC).In(time.Local).Format(importDateLayout)
+	summary := strings.Join([]string{
+		fmt.Sprintf(duplicatesMsg, 2),
+		fmt.Sprintf(emptyEntriesMsg, 1),
+		fmt.Sprintf(tooLongEntriesMsg, 1, 20, tooLong),
+	}, "\n")
+
+	tests := []struct {
+		format   string
+		dryRun   bool
+		input    string
+		expected string
+	}{
+		{
+			format:   "day one",
+			expected: fmt.Sprintf(invalidImportError, "day one", "jrnl, json, quack"),
+		},
+		{
+			format:   "quack",
+			dryRun:   true,
+			input:    input,
+			expected: fmt.Sprintf(dryRunImportMsg, 1) + "\n" + summary,
+		},
+		{
+			format:   "json",
+			input:    input,
+			expected: fmt.Sprintf(importedMsg, 1) + "\n" + summary,
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		importFormat, importDryRun = test.format, test.dryRun
+		importInput = strings.NewReader(test.input)
+		createdMock = storage.Entry{}
+
+		actual := Import()
+		if actual != test.expected {
+			t.Errorf("cmd.Import() as %s returned %s, expected %s", test.format, actual, test.expected)
+		}
+
+		if test.dryRun && createdMock.Key != "" {
+			t.Errorf("cmd.Import() with --dry-run created entry %s", createdMock.Key)
+		}
+	}
+
+	expected := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	createdMock.SetDecryptedContent()
+	if !createdMock.CreatedAt.Equal(expected) || createdMock.DecryptedContent != "Shipped it" || createdMock.Mood != "proud" {
+		t.Errorf("cmd.Import() created %+v, expected Shipped it from %v", createdMock, expected)
+	}
+}
+
+func TestImportFile(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() { importFormat = "quack" }()
+	entriesMock = nil
+	search = ""
+
+	dir, _ := ioutil.TempDir("", "quack-import")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.txt")
+	ioutil.WriteFile(path, []byte("[2020-03-09 15:04] Shipped it.\n[2020-03-10 09:00] Then rested.\n"), 0600)
+
+	importFormat = "jrnl"
+	if actual, expected := Import(path), fmt.Sprintf(importedMsg, 2); actual != expected {
+		t.Errorf("cmd.Import(%s) returned %s, expected %s", path, actual, expected)
+	}
+
+	errorMock = errors.New("offline")
+	if actual := Import(path); actual != unableToReadError {
+		t.Errorf("cmd.Import(%s) returned %s when storage can't be read, expected %s", path, actual, unableToReadError)
+	}
+	errorMock = nil
+
+	missing := filepath.Join(dir, "missing.txt")
+	if actual := Import(missing); !strings.HasPrefix(actual, "Unable to read "+missing) {
+		t.Errorf("cmd.Import(%s) returned %s, expected it to be unreadable", missing, actual)
+	}
+}
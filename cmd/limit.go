@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	limitMsg           = "Entries can be up to %d characters long."
+	unlimitedMsg       = "Entries can be any length."
+	invalidLimitError  = "Unable to set the limit to %q. Please pass a number of characters, unlimited or default."
+	noSettingsError    = "This storage does not keep journal settings."
+	unableToLimitError = "Unable to read or save journal settings."
+	limitUnlimited     = "unlimited"
+	limitDefault       = "default"
+)
+
+// Configurable reads and saves settings kept with the journal
+type Configurable interface {
+	ReadSettings() (storage.Settings, error)
+	WriteSettings(storage.Settings) error
+}
+
+// limitCmd represents the limit command
+var limitCmd = &cobra.Command{
+	Use:   "limit [characters|unlimited|default]",
+	Short: "Show or set how long entries can be",
+	Long: `
+Run quack limit to see how many characters entries in this journal can have.
+Characters are counted the way they are seen, so an emoji or an accented
+letter counts as one however it is encoded.
+
+Set a new limit with quack limit 500, allow entries of any length with
+quack limit unlimited, or go back to 280 with quack limit default. The limit
+is saved with the journal, so it applies wherever the journal is written
+from. Entries already saved are kept as they are.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  LimitRunner,
+}
+
+// LimitRunner wraps Limit for easier testing
+func LimitRunner(cmd *cobra.Command, args []string) {
+	result := Limit(args...)
+	fmt.Println(result)
+}
+
+// Limit shows the journal's entry length limit, or sets it if one is passed
+func Limit(args ...string) string {
+	configurable, ok := store.(Configurable)
+	if !ok {
+		return noSettingsError
+	}
+
+	settings, err := configurable.ReadSettings()
+	if err != nil {
+		return unableToLimitError
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case limitUnlimited:
+			settings.MaxLength = storage.Unlimited
+		case limitDefault:
+			settings.MaxLength = 0
+		default:
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return fmt.Sprintf(invalidLimitError, args[0])
+			}
+			settings.MaxLength = n
+		}
+
+		if err := configurable.WriteSettings(settings); err != nil {
+			return unableToLimitError
+		}
+	}
+
+	if settings.Limit() == 0 {
+		return unlimitedMsg
+	}
+
+	return fmt.Sprintf(limitMsg, settings.Limit())
+}
+
+// journalLimit returns the most characters an entry can have, or zero if
+// there is no limit. The storage checks again when the entry is saved.
+func journalLimit() int {
+	if configurable, ok := store.(Configurable); ok {
+		if settings, err := configurable.ReadSettings(); err == nil {
+			return settings.Limit()
+		}
+	}
+
+	return storage.DefaultMaxLength
+}
+
+func init() {
+	rootCmd.AddCommand(limitCmd)
+}
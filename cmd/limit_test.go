@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestLimit(t *testing.T) {
+	store = new(fakeStorage)
+	defer func() { settingsMock = storage.Settings{} }()
+
+	tests := []struct {
+		args        []string
+		expected    string
+		maxLength   int
+		description string
+	}{
+		{
+			expected:    fmt.Sprintf(limitMsg, storage.DefaultMaxLength),
+			description: "when the journal has the default limit",
+		},
+		{
+			args:        []string{"500"},
+			expected:    fmt.Sprintf(limitMsg, 500),
+			maxLength:   500,
+			description: "when a limit is set",
+		},
+		{
+			args:        []string{"unlimited"},
+			expected:    unlimitedMsg,
+			maxLength:   storage.Unlimited,
+			description: "when the journal is made long-form",
+		},
+		{
+			args:        []string{"-3"},
+			expected:    fmt.Sprintf(invalidLimitError, "-3"),
+			maxLength:   storage.Unlimited,
+			description: "when the limit is invalid",
+		},
+		{
+			args:        []string{"default"},
+			expected:    fmt.Sprintf(limitMsg, storage.DefaultMaxLength),
+			maxLength:   0,
+			description: "when the limit is reset",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			actual := Limit(test.args...)
+			if actual != test.expected {
+				t.Errorf("cmd.Limit(%v) returned %s, expected %s", test.args, actual, test.expected)
+			}
+			if settingsMock.MaxLength != test.maxLength {
+				t.Errorf("cmd.Limit(%v) saved a max length of %d, expected %d", test.args, settingsMock.MaxLength, test.maxLength)
+			}
+		})
+	}
+}
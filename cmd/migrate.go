@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	migrateSuccessMsg  = "Renamed %d entries to time-sortable keys."
+	nothingToMigrate   = "All entries already have time-sortable keys."
+	noMigratorError    = "This storage does not support renaming entries."
+	unableToMigrateMsg = "Unable to rename entries after renaming %d: %v"
+)
+
+// Migrator renames entries to time-sortable keys
+type Migrator interface {
+	MigrateKeys(renamed func(oldKey, newKey string)) (int, error)
+}
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rename older entries to time-sortable keys",
+	Long: `
+Entries created by older versions of quack have random-looking unique ids.
+Run quack migrate to rename them to ids that start with the date they were
+written, e.g. 2020/03/09/01E2X..., so that they are listed in order.
+
+Each entry is re-encrypted under its new id. If the migration is interrupted,
+run it again to finish.`,
+	Run: MigrateRunner,
+}
+
+// MigrateRunner wraps Migrate for easier testing
+func MigrateRunner(cmd *cobra.Command, args []string) {
+	result := Migrate(args...)
+	fmt.Println(result)
+}
+
+// Migrate renames entries that don't have time-sortable keys yet
+func Migrate(args ...string) string {
+	migrator, ok := store.(Migrator)
+	if !ok {
+		return noMigratorError
+	}
+
+	n, err := migrator.MigrateKeys(func(oldKey, newKey string) {
+		fmt.Printf("%s -> %s\n", oldKey, newKey)
+	})
+	if err != nil {
+		return fmt.Sprintf(unableToMigrateMsg, n, err)
+	}
+
+	if n == 0 {
+		return nothingToMigrate
+	}
+
+	return fmt.Sprintf(migrateSuccessMsg, n)
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	store = new(fakeStorage)
+	defer func() { migratedMock, migrateErrorMock = 0, nil }()
+
+	tests := []struct {
+		migrated    int
+		err         error
+		expected    string
+		description string
+	}{
+		{
+			migrated:    3,
+			expected:    fmt.Sprintf(migrateSuccessMsg, 3),
+			description: "when entries are renamed",
+		},
+		{
+			expected:    nothingToMigrate,
+			description: "when every entry already has a time-sortable key",
+		},
+		{
+			migrated:    1,
+			err:         errors.New("bucket unavailable"),
+			expected:    fmt.Sprintf(unableToMigrateMsg, 1, "bucket unavailable"),
+			description: "when renaming fails part way",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			migratedMock = test.migrated
+			migrateErrorMock = test.err
+
+			actual := Migrate()
+
+			if actual != test.expected {
+				t.Errorf("cmd.Migrate() returned %s, expected %s", actual, test.expected)
+			}
+		})
+	}
+}
@@ -3,15 +3,19 @@ package cmd
 import (
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/jonathanwthom/quack/secure"
+	"github.com/jonathanwthom/quack/storage"
 	"github.com/spf13/cobra"
 )
 
 const (
 	successMsg        = "Entry saved."
-	tooManyCharsError = "Message must be shorter than 280 characters."
+	tooManyCharsError = "Entry is %d characters long, but this journal allows at most %d."
 	storageError      = "Failed to create entry."
+	nothingToSaveMsg  = "Entry is empty, nothing was saved."
+	discardedMsg      = "Entry discarded, nothing was saved."
+	composeError      = "Unable to read entry: %v"
 )
 
 // newCmd represents the new command
@@ -20,10 +24,21 @@ var newCmd = &cobra.Command{
 	Short: "Create a new entry",
 	Long: `
 Create a new entry like this:
-quack new "These are my deepest darkest secrets..."`,
+quack new "These are my deepest darkest secrets..."
+
+Entries passed as arguments end up in your shell history. Run quack new on
+its own to write the entry in $VISUAL or $EDITOR instead, or if neither is
+set, at a prompt that counts characters as you type and can span several
+lines. Entries can also be piped in, e.g. quack new < entry.txt
+
+Record how you felt and where you were with --mood and --location. Both are
+encrypted along with the entry.`,
 	Run: NewRunner,
 }
 
+var mood string
+var location string
+
 // NewRunner wraps New for easier testing
 func NewRunner(cmd *cobra.Command, args []string) {
 	result := New(args...)
@@ -33,17 +48,36 @@ func NewRunner(cmd *cobra.Command, args []string) {
 // New creates and stores a new message
 func New(args ...string) string {
 	msg := strings.Join(args, " ")
+	if len(args) == 0 {
+		var err error
+		msg, err = compose()
+		if err == errDiscarded {
+			return discardedMsg
+		}
+		if err != nil {
+			return fmt.Sprintf(composeError, err)
+		}
+	}
 
-	if len(msg) > 280 {
-		return tooManyCharsError
+	if strings.TrimSpace(msg) == "" {
+		return nothingToSaveMsg
 	}
 
-	encrypted, err := secure.Encrypt(msg)
+	if limit := journalLimit(); limit > 0 && storage.Length(msg) > limit {
+		return fmt.Sprintf(tooManyCharsError, storage.Length(msg), limit)
+	}
+
+	entry := storage.NewEntry(time.Now())
+	entry.Mood, entry.Location = mood, location
+	err := entry.Encrypt(msg)
 	if err != nil {
 		return err.Error()
 	}
 
-	err = store.Create(encrypted)
+	err = store.Create(entry)
+	if tooLong, ok := err.(*storage.TooLongError); ok {
+		return fmt.Sprintf(tooManyCharsError, tooLong.Length, tooLong.Limit)
+	}
 	if err != nil {
 		return storageError
 	}
@@ -53,4 +87,6 @@ func New(args ...string) string {
 
 func init() {
 	rootCmd.AddCommand(newCmd)
+	newCmd.Flags().StringVar(&mood, "mood", "", "How you're feeling, e.g. tired")
+	newCmd.Flags().StringVar(&location, "location", "", "Where you are, e.g. Portland")
 }
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/jonathanwthom/quack/storage"
 )
 
 func TestNew(t *testing.T) {
@@ -12,6 +15,7 @@ func TestNew(t *testing.T) {
 
 	var tests = []struct {
 		args        string
+		settings    storage.Settings
 		expected    string
 		description string
 	}{
@@ -21,20 +25,38 @@ func TestNew(t *testing.T) {
 			description: "when new entry is valid",
 		},
 		{
-			args: `
-				morethan280charactersmorethan280charactersmorethan280characters
-				morethan280charactersmorethan280charactersmorethan280characters
-				morethan280charactersmorethan280charactersmorethan280characters
-				morethan280charactersmorethan280charactersmorethan280characters
-				morethan280charactersmorethan280charactersmorethan280characters
-			`,
-			expected:    tooManyCharsError,
+			args:        strings.Repeat("🦆", 280),
+			expected:    successMsg,
+			description: "when new entry is at the limit",
+		},
+		{
+			args:        strings.Repeat("日本語", 90),
+			expected:    successMsg,
+			description: "when new entry is in a script that takes several bytes a character",
+		},
+		{
+			args:        strings.Repeat("🦆", 281),
+			expected:    fmt.Sprintf(tooManyCharsError, 281, 280),
 			description: "when new entry has too many characters",
 		},
+		{
+			args:        strings.Repeat("🦆", 11),
+			settings:    storage.Settings{MaxLength: 10},
+			expected:    fmt.Sprintf(tooManyCharsError, 11, 10),
+			description: "when new entry is over the journal's own limit",
+		},
+		{
+			args:        strings.Repeat("🦆", 1000),
+			settings:    storage.Settings{MaxLength: storage.Unlimited},
+			expected:    successMsg,
+			description: "when the journal is long-form",
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
+			settingsMock = test.settings
+			defer func() { settingsMock = storage.Settings{} }()
 			args := strings.Split(test.args, " ")
 			expected := test.expected
 			actual := New(args...)
@@ -45,3 +67,20 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWithMoodAndLocation(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	mood, location = "tired", "Portland"
+	defer func() { mood, location = "", "" }()
+
+	if actual := New("long", "day"); actual != successMsg {
+		t.Fatalf("cmd.New() returned %s, expected %s", actual, successMsg)
+	}
+
+	entry := createdMock
+	entry.Mood, entry.Location = "", ""
+	if err := entry.SetDecryptedContent(); err != nil || entry.Mood != mood || entry.Location != location {
+		t.Errorf("cmd.New() with mood %s and location %s stored %q and %q, %v", mood, location, entry.Mood, entry.Location, err)
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonathanwthom/quack/query"
+	"github.com/jonathanwthom/quack/storage"
+)
+
+const (
+	ambiguousKeyError = "%q matches more than one entry:\n%s\nPlease pass more of the unique id."
+	keyNotFoundError  = "No entry's unique id starts with %q. Run quack read -v to see them."
+	pickPrompt        = "Pick an entry by number, or search to narrow the list (Enter cancels): "
+	pickLine          = "%2d) %s - %s\n"
+	noPicksMsg        = "No entries match %q.\n"
+	invalidPickMsg    = "There is no entry %d.\n"
+	nothingPickedMsg  = "Nothing picked."
+	noEntriesToPick   = "There are no entries to pick from."
+	pickLimit         = 10
+	pickPreviewLength = 60
+)
+
+// KeyResolver finds the entry a unique prefix of its key refers to
+type KeyResolver interface {
+	ResolveKey(prefix string) (string, error)
+}
+
+// errNothingPicked is returned when the picker is left without choosing, and
+// errNoEntriesToPick when there is nothing to choose from
+var errNothingPicked = errors.New(nothingPickedMsg)
+var errNoEntriesToPick = errors.New(noEntriesToPick)
+
+// pickInput and pickOutput are where the picker reads and writes, so tests
+// can stand in for the terminal
+var pickInput io.Reader = os.Stdin
+var pickOutput io.Writer = os.Stderr
+
+// chooseKey returns the key of the entry named in args by a unique prefix of
+// its key, or picked from a list if pick is set, as it is with -i
+func chooseKey(args []string, pick bool) (string, error) {
+	if pick {
+		entry, err := pickEntry()
+		return entry.Key, err
+	}
+
+	resolver, ok := store.(KeyResolver)
+	if !ok {
+		return args[0], nil
+	}
+
+	return resolver.ResolveKey(args[0])
+}
+
+// choiceError describes err if it came from the key prefix in args matching
+// no entry or more than one, or from the picker
+func choiceError(err error, args []string) (string, bool) {
+	if err == errNothingPicked || err == errNoEntriesToPick {
+		return err.Error(), true
+	}
+	if err == storage.ErrKeyNotFound && len(args) > 0 {
+		return fmt.Sprintf(keyNotFoundError, args[0]), true
+	}
+
+	ambiguous, ok := err.(*storage.AmbiguousKeyError)
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprintf(ambiguousKeyError, ambiguous.Prefix, strings.Join(ambiguous.Keys, "\n")), true
+}
+
+// pickEntry lists the most recent entries and asks which one is meant.
+// Anything typed other than a number is a search that narrows the list.
+// Entries are only decrypted once they are listed or searched.
+func pickEntry() (storage.Entry, error) {
+	entries, err := store.Read()
+	if err != nil {
+		return storage.Entry{}, errors.New(unableToReadError)
+	}
+	if len(entries) == 0 {
+		return storage.Entry{}, errNoEntriesToPick
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	decrypted := make([]bool, len(entries))
+	decrypt := func(i int) error {
+		if decrypted[i] {
+			return nil
+		}
+		decrypted[i] = true
+		return entries[i].SetDecryptedContent()
+	}
+
+	// matches lists up to pickLimit entries, newest first, that q matches,
+	// or every entry if q is nil
+	matches := func(q *query.Query) ([]storage.Entry, error) {
+		var shown []storage.Entry
+		for i := 0; i < len(entries) && len(shown) < pickLimit; i++ {
+			if err := decrypt(i); err != nil {
+				return nil, err
+			}
+			if q == nil || q.Match(document(entries[i])) {
+				shown = append(shown, entries[i])
+			}
+		}
+		return shown, nil
+	}
+
+	shown, err := matches(nil)
+	if err != nil {
+		return storage.Entry{}, err
+	}
+	reader := bufio.NewReader(pickInput)
+	loc := time.Now().Location()
+	for {
+		for i, entry := range shown {
+			created := entry.CreatedAt.In(loc).Format("January 2, 2006 - 3:04 PM MST")
+			fmt.Fprintf(pickOutput, pickLine, i+1, created, preview(entry.DecryptedContent))
+		}
+		fmt.Fprint(pickOutput, pickPrompt)
+
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil && err != io.EOF {
+				return storage.Entry{}, err
+			}
+			return storage.Entry{}, errNothingPicked
+		}
+
+		if n, err := strconv.Atoi(line); err == nil {
+			if n >= 1 && n <= len(shown) {
+				return shown[n-1], nil
+			}
+			fmt.Fprintf(pickOutput, invalidPickMsg, n)
+			continue
+		}
+
+		q, err := query.Parse(line)
+		if err != nil {
+			fmt.Fprintf(pickOutput, "Invalid search: %v\n", err)
+			continue
+		}
+		found, err := matches(q)
+		if err != nil {
+			return storage.Entry{}, err
+		}
+		if len(found) == 0 {
+			fmt.Fprintf(pickOutput, noPicksMsg, line)
+			continue
+		}
+		shown = found
+	}
+}
+
+// preview returns the start of an entry's first line
+func preview(content string) string {
+	line := strings.SplitN(strings.TrimSpace(content), "\n", 2)[0]
+	runes := []rune(line)
+	if len(runes) > pickPreviewLength {
+		return string(runes[:pickPreviewLength-1]) + "…"
+	}
+
+	return line
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestPickEntry(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer resetJournalKey()
+	defer func() { entriesMock, pickInput, pickOutput = nil, os.Stdin, os.Stderr }()
+
+	now := time.Now()
+	var keys []string
+	entriesMock = nil
+	for i, content := range []string{"oldest standup", "retro notes", "newest standup"} {
+		entry := storage.NewEntry(now.Add(time.Duration(i) * time.Minute))
+		entry.Encrypt(content)
+		entriesMock = append(entriesMock, entry)
+		keys = append(keys, entry.Key)
+	}
+
+	tests := []struct {
+		input       string
+		expected    string
+		err         error
+		description string
+	}{
+		{
+			input:       "1\n",
+			expected:    keys[2],
+			description: "when picking the newest entry",
+		},
+		{
+			input:       "standup\n2\n",
+			expected:    keys[0],
+			description: "when narrowing the list with a search",
+		},
+		{
+			input:       "7\n3\n",
+			expected:    keys[0],
+			description: "when picking a number not listed first",
+		},
+		{
+			input:       "\n",
+			err:         errNothingPicked,
+			description: "when leaving without picking",
+		},
+		{
+			input:       "",
+			err:         errNothingPicked,
+			description: "when input ends",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var output bytes.Buffer
+			pickInput, pickOutput = strings.NewReader(test.input), &output
+
+			entry, err := pickEntry()
+
+			if entry.Key != test.expected || err != test.err {
+				t.Errorf("cmd.pickEntry() with input %q returned %s, %v, expected %s, %v", test.input, entry.Key, err, test.expected, test.err)
+			}
+			if !strings.Contains(output.String(), " 1) ") || !strings.Contains(output.String(), "newest standup") {
+				t.Errorf("cmd.pickEntry() listed %q, expected numbered entries", output.String())
+			}
+		})
+	}
+}
+
+func TestPickEntryDecryptsLazily(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer resetJournalKey()
+	defer func() { entriesMock, pickInput, pickOutput = nil, os.Stdin, os.Stderr }()
+
+	now := time.Now()
+	unreadable := storage.NewEntry(now.Add(-time.Hour))
+	unreadable.Content = "not encrypted"
+	entriesMock = []storage.Entry{unreadable}
+	for i := 0; i < pickLimit; i++ {
+		entry := storage.NewEntry(now.Add(time.Duration(i) * time.Minute))
+		entry.Encrypt("standup")
+		entriesMock = append(entriesMock, entry)
+	}
+
+	newest := entriesMock[pickLimit].Key
+	pickInput, pickOutput = strings.NewReader("1\n"), new(bytes.Buffer)
+	entry, err := pickEntry()
+	if err != nil || entry.Key != newest {
+		t.Errorf("cmd.pickEntry() returned %s, %v, expected the newest entry without reading older ones", entry.Key, err)
+	}
+}
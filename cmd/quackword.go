@@ -1,9 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/jonathanwthom/quack/secure"
+	"github.com/jonathanwthom/quack/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -12,8 +19,37 @@ const (
 	multiQuackwordError = "Please enter multi-word QUACKWORD in quotations."
 	updateSuccess       = "Successfully updated QUACKWORD. Please update QUACKWORD in your shell environment."
 	unableToUpdateError = "Unable to update QUACKWORD."
+	noRotatorError      = "This storage does not support changing the QUACKWORD."
+	keepsChangingError  = "entry %s keeps changing"
+	rotationStoppedMsg  = "Unable to update QUACKWORD after re-encrypting %d entries: %v\nYour QUACKWORD is unchanged. Run quack quackword again to pick up where it stopped."
+	reencryptingMsg     = "Re-encrypting entries with a new journal key..."
+	resumingMsg         = "Picking up after %d entries were re-encrypted..."
+	progressMsg         = "%d entries checked, %d re-encrypted"
+	reencryptedMsg      = "Re-encrypted %d entries with the new journal key."
+	dryRunRewrapMsg     = "Dry run: the journal key would be wrapped with the new QUACKWORD. No entries need re-encrypting."
+	dryRunReencryptMsg  = "Dry run: %d entries would be re-encrypted with a new journal key, which would then be wrapped with the new QUACKWORD."
+	dryRunResumeMsg     = "Dry run: picking up after %d entries were re-encrypted, %d more would be, then the journal key would be wrapped with the new QUACKWORD."
+	olderKeysMsg        = "%d entries are still encrypted with an older journal key. Re-encrypting them first..."
+	olderKeyInUseError  = "Unable to update QUACKWORD: %d entries are still encrypted with an older journal key, so it was kept. Run quack quackword again to re-encrypt them."
 )
 
+// conflictRetries is how many times an entry changed by someone else is read
+// again before giving up
+const conflictRetries = 3
+
+// checkpointEvery is how many entries are checked between saving progress
+const checkpointEvery = 20
+
+var dryRun bool
+var rekey bool
+
+// Rotator keeps the checkpoint of a QUACKWORD rotation in progress
+type Rotator interface {
+	ReadRotation() (*storage.Rotation, error)
+	WriteRotation(storage.Rotation) error
+	ClearRotation() error
+}
+
 // quackwordCmd represents the quackword command
 var quackwordCmd = &cobra.Command{
 	Use:   "quackword",
@@ -22,6 +58,16 @@ var quackwordCmd = &cobra.Command{
 Reset your QUACKWORD like this:
 quack quackword "newquackword"
 
+Entries are encrypted with a journal key, which is kept wrapped with your
+QUACKWORD, so changing the QUACKWORD only wraps that one key again.
+
+The first reset re-encrypts any entries from before the journal had a key,
+as does --rekey, which moves every entry to a fresh journal key. Progress
+is saved as it goes, and your QUACKWORD only changes once every entry,
+including those in the trash, is done, so if it is interrupted, run it
+again to pick up where it stopped.
+Pass --dry-run to see what would be done without changing anything.
+
 Be sure to change the QUACKWORD variable in your environment after the reset
 is complete.
 	`,
@@ -44,36 +90,332 @@ func Quackword(args ...string) string {
 		return multiQuackwordError
 	}
 
-	newQuackword := args[0]
-	entries, err := store.Read()
+	rotator, ok := store.(Rotator)
+	if !ok {
+		return noRotatorError
+	}
+
+	quackword, newQuackword := os.Getenv("QUACKWORD"), args[0]
+	job, err := rotator.ReadRotation()
 	if err != nil {
-		return unableToReadError
+		return unableToUpdateError
+	}
+
+	current, err := secure.DataKeyID()
+	if err != nil {
+		return unableToUpdateError
+	}
+
+	// A checkpoint for a key the journal no longer uses is left over from
+	// a rotation someone else finished or started over.
+	if job != nil && job.KeyID != hex.EncodeToString(current) {
+		job = nil
 	}
 
-	fmt.Println("entries")
-	fmt.Println(entries)
-	for i := 0; i < len(entries); i++ {
-		entry := entries[i]
-		decrypted, err := secure.Decrypt(entry.Content)
+	// Older keys are only dropped once no entry needs them. Entries left
+	// under one by a rotation that was superseded or never finished are
+	// moved to the current key first.
+	unfinished := false
+	if job == nil && current != nil && !rekey {
+		pending, err := pendingEntries(current, "")
 		if err != nil {
+			return unableToReadError
+		}
+		if pending == 0 {
+			if dryRun {
+				return dryRunRewrapMsg
+			}
+			return rewrap(rotator, current, quackword, newQuackword)
+		}
+
+		job = &storage.Rotation{KeyID: hex.EncodeToString(current), StartedAt: time.Now()}
+		unfinished = true
+	}
+
+	if dryRun {
+		return planRotation(job)
+	}
+
+	if unfinished {
+		pending, _ := pendingEntries(current, "")
+		if err := rotator.WriteRotation(*job); err != nil {
 			return unableToUpdateError
 		}
+		fmt.Printf(olderKeysMsg+"\n", pending)
+	} else if job == nil {
+		if err := checkQuackword(); err != nil {
+			return unableToReadError
+		}
 
-		encrypted, err := secure.EncryptWithNewQuackword(decrypted, newQuackword)
+		id, err := secure.AddDataKey(quackword)
 		if err != nil {
 			return unableToUpdateError
 		}
 
-		entry.Content = encrypted
-		err = store.Update(entry)
-		if err != nil {
+		job = &storage.Rotation{KeyID: hex.EncodeToString(id), StartedAt: time.Now()}
+		if err := rotator.WriteRotation(*job); err != nil {
 			return unableToUpdateError
 		}
+		fmt.Println(reencryptingMsg)
+	} else {
+		fmt.Printf(resumingMsg+"\n", job.Reencrypted)
+	}
+
+	if err := reencryptAll(rotator, job); err != nil {
+		return fmt.Sprintf(rotationStoppedMsg, job.Reencrypted, err)
+	}
+
+	// The manifest is signed with the journal key, and the old one is
+	// about to be dropped.
+	if s, ok := store.(*storage.Storage); ok {
+		if err := s.ResignManifest(secure.Signer{}); err != nil {
+			return fmt.Sprintf(rotationStoppedMsg, job.Reencrypted, err)
+		}
+	}
+
+	id, _ := hex.DecodeString(job.KeyID)
+	result := rewrap(rotator, id, quackword, newQuackword)
+
+	return strings.Join([]string{fmt.Sprintf(reencryptedMsg, job.Reencrypted), result}, "\n")
+}
+
+// rewrap switches the journal over to newQuackword in one write, dropping
+// older keys, then clears the checkpoint of the rotation that led up to it.
+// It refuses if any entry is still encrypted with an older key, such as one
+// written meanwhile by someone with a stale journal header.
+func rewrap(rotator Rotator, id []byte, quackword, newQuackword string) string {
+	pending, err := pendingEntries(id, "")
+	if err != nil {
+		return unableToReadError
+	}
+	if pending > 0 {
+		return fmt.Sprintf(olderKeyInUseError, pending)
+	}
+
+	if err := secure.Rewrap(id, quackword, newQuackword); err != nil {
+		return unableToUpdateError
+	}
+
+	if err := rotator.ClearRotation(); err != nil {
+		return unableToUpdateError
 	}
 
 	return updateSuccess
 }
 
+// planRotation describes the re-encryption a rotation would do, picking up
+// from job if there is one
+func planRotation(job *storage.Rotation) string {
+	var id []byte
+	var pageToken string
+	if job != nil {
+		id, _ = hex.DecodeString(job.KeyID)
+		pageToken = job.PageToken
+	}
+
+	pending, err := pendingEntries(id, pageToken)
+	if err != nil {
+		return unableToReadError
+	}
+
+	if job != nil {
+		return fmt.Sprintf(dryRunResumeMsg, job.Reencrypted, pending)
+	}
+
+	return fmt.Sprintf(dryRunReencryptMsg, pending)
+}
+
+// pendingEntries counts the entries from pageToken on, and those in the
+// trash, that aren't encrypted with the data key id, or all of them if id is
+// nil
+func pendingEntries(id []byte, pageToken string) (int, error) {
+	it, err := store.Iterate(context.Background(), storage.IterateOptions{PageToken: pageToken})
+	if err != nil {
+		return 0, err
+	}
+	defer it.Stop()
+
+	pending := 0
+	for {
+		entry, err := it.Next()
+		if err == io.EOF {
+			trashed, err := pendingTrash(id)
+			return pending + trashed, err
+		}
+		if err != nil {
+			return 0, err
+		}
+		if id == nil || !secure.EncryptedWith(entry.Content, id) {
+			pending++
+		}
+	}
+}
+
+// pendingTrash counts the entries in the trash that aren't encrypted with the
+// data key id, or all of them if id is nil
+func pendingTrash(id []byte) (int, error) {
+	trasher, ok := store.(Trasher)
+	if !ok {
+		return 0, nil
+	}
+
+	trash, err := trasher.Trash()
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, trashed := range trash {
+		if id == nil || !secure.EncryptedWith(trashed.Content, id) {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+// checkQuackword makes sure the QUACKWORD reads the journal before any of it
+// is re-encrypted
+func checkQuackword() error {
+	it, err := store.Iterate(context.Background(), storage.IterateOptions{Limit: 1})
+	if err != nil {
+		return err
+	}
+	defer it.Stop()
+
+	entry, err := it.Next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return entry.SetDecryptedContent()
+}
+
+// reencryptAll re-encrypts every entry after job's checkpoint that isn't
+// encrypted with job's key yet, saving progress as it goes, then those in the
+// trash
+func reencryptAll(rotator Rotator, job *storage.Rotation) error {
+	id, err := hex.DecodeString(job.KeyID)
+	if err != nil {
+		return err
+	}
+
+	it, err := store.Iterate(context.Background(), storage.IterateOptions{PageToken: job.PageToken})
+	if err != nil {
+		return err
+	}
+	defer it.Stop()
+
+	for checked := 1; ; checked++ {
+		entry, err := it.Next()
+		if err == io.EOF {
+			return reencryptTrash(rotator, job, id)
+		}
+		if err != nil {
+			return err
+		}
+
+		done, err := reencryptWithRetries(entry, id)
+		if err != nil {
+			rotator.WriteRotation(*job)
+			return err
+		}
+		if done {
+			job.Reencrypted++
+		}
+		job.PageToken = it.PageToken()
+
+		if checked%checkpointEvery == 0 {
+			if err := rotator.WriteRotation(*job); err != nil {
+				return err
+			}
+			fmt.Printf(progressMsg+"\n", checked, job.Reencrypted)
+		}
+	}
+}
+
+// reencryptTrash re-encrypts the entries in the trash that aren't encrypted
+// with the data key id yet, so they can still be restored once older keys
+// are dropped
+func reencryptTrash(rotator Rotator, job *storage.Rotation, id []byte) error {
+	trasher, ok := store.(Trasher)
+	if !ok {
+		return nil
+	}
+
+	trash, err := trasher.Trash()
+	if err != nil {
+		return err
+	}
+
+	for _, trashed := range trash {
+		entry := trashed.Entry
+		if secure.EncryptedWith(entry.Content, id) {
+			continue
+		}
+		if err := entry.SetDecryptedContent(); err != nil {
+			return err
+		}
+
+		unchanged := entry.Unchanged()
+		if err := entry.Encrypt(entry.DecryptedContent); err != nil {
+			return err
+		}
+		if err := trasher.UpdateTrashed(entry, unchanged); err != nil {
+			rotator.WriteRotation(*job)
+			return err
+		}
+		job.Reencrypted++
+	}
+
+	return nil
+}
+
+// reencryptWithRetries re-encrypts entry with the data key id unless it
+// already is, reading it again if someone else changes it in the meantime.
+// It reports whether it re-encrypted the entry.
+func reencryptWithRetries(entry storage.Entry, id []byte) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		if secure.EncryptedWith(entry.Content, id) {
+			return false, nil
+		}
+
+		err := reencrypt(entry)
+		if err != storage.ErrConflict {
+			return err == nil, err
+		}
+		if attempt == conflictRetries {
+			return false, fmt.Errorf(keepsChangingError, entry.Key)
+		}
+
+		// Someone else saved the entry since it was read, so start over
+		// from what they wrote.
+		if entry, err = store.ReadByKey(entry.Key); err != nil {
+			return false, err
+		}
+	}
+}
+
+// reencrypt encrypts entry with the current journal key, as long as it
+// hasn't changed in storage since it was read
+func reencrypt(entry storage.Entry) error {
+	if err := entry.SetDecryptedContent(); err != nil {
+		return err
+	}
+
+	unchanged := entry.Unchanged()
+	if err := entry.Encrypt(entry.DecryptedContent); err != nil {
+		return err
+	}
+
+	return store.Update(entry, unchanged)
+}
+
 func init() {
 	rootCmd.AddCommand(quackwordCmd)
+	quackwordCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be re-encrypted without changing anything")
+	quackwordCmd.Flags().BoolVar(&rekey, "rekey", false, "Re-encrypt every entry with a fresh journal key")
 }
@@ -1,18 +1,37 @@
 package cmd
 
 import (
-	"github.com/jonathanwthom/quack/storage"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/jonathanwthom/quack/secure"
+	"github.com/jonathanwthom/quack/storage"
 )
 
+// resetJournalKey starts the tests that follow on a journal without a header
+func resetJournalKey() {
+	headerMock = nil
+	secure.SetHeaderStore(journalHeader{})
+}
+
 func TestQuackword(t *testing.T) {
 	store = new(fakeStorage)
 	os.Setenv("QUACKWORD", "password")
+	defer func() { readByKeyMock, updateErrorMocks, rotationMock = storage.Entry{}, nil, nil }()
+	defer resetJournalKey()
+
+	// entry is changed by someone else while the QUACKWORD is being updated
+	entry := storage.NewEntry(time.Now())
+	entry.Encrypt("Hello World!")
+	readByKeyMock = entry
 
 	tests := []struct {
 		entries  []storage.Entry
+		conflict []error
 		args     string
 		expected string
 	}{
@@ -25,7 +44,19 @@ func TestQuackword(t *testing.T) {
 				},
 			},
 			args:     "new quackword",
-			expected: updateSuccess,
+			expected: fmt.Sprintf(reencryptedMsg, 1) + "\n" + updateSuccess,
+		},
+		{
+			entries:  []storage.Entry{entry},
+			conflict: []error{storage.ErrConflict},
+			args:     "new quackword",
+			expected: fmt.Sprintf(reencryptedMsg, 1) + "\n" + updateSuccess,
+		},
+		{
+			entries:  []storage.Entry{entry},
+			conflict: []error{storage.ErrConflict, storage.ErrConflict, storage.ErrConflict, storage.ErrConflict},
+			args:     "new quackword",
+			expected: fmt.Sprintf(rotationStoppedMsg, 0, fmt.Errorf(keepsChangingError, entry.Key)),
 		},
 	}
 
@@ -34,6 +65,9 @@ func TestQuackword(t *testing.T) {
 		args := test.args
 		expected := test.expected
 		entriesMock = test.entries
+		updateErrorMocks = test.conflict
+		rotationMock = nil
+		resetJournalKey()
 
 		actual := Quackword(args)
 
@@ -42,3 +76,130 @@ func TestQuackword(t *testing.T) {
 		}
 	}
 }
+
+func TestQuackwordRotation(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer os.Setenv("QUACKWORD", "password")
+	defer func() { updateErrorMocks, rotationMock, dryRun, rekey = nil, nil, false, false }()
+	defer resetJournalKey()
+	resetJournalKey()
+
+	first := storage.NewEntry(time.Now().Add(-time.Hour))
+	first.Encrypt("First")
+	second := storage.NewEntry(time.Now())
+	second.Encrypt("Second")
+	entriesMock = []storage.Entry{first, second}
+
+	steps := []struct {
+		quackword string
+		args      string
+		dryRun    bool
+		failures  []error
+		expected  string
+	}{
+		{
+			quackword: "password",
+			args:      "new quackword",
+			dryRun:    true,
+			expected:  fmt.Sprintf(dryRunReencryptMsg, 2),
+		},
+		{
+			// Saving the second entry fails, leaving a checkpoint after
+			// the first.
+			quackword: "password",
+			args:      "new quackword",
+			failures:  []error{nil, errors.New("offline")},
+			expected:  fmt.Sprintf(rotationStoppedMsg, 1, "offline"),
+		},
+		{
+			quackword: "password",
+			args:      "new quackword",
+			dryRun:    true,
+			expected:  fmt.Sprintf(dryRunResumeMsg, 1, 1),
+		},
+		{
+			quackword: "password",
+			args:      "new quackword",
+			expected:  fmt.Sprintf(reencryptedMsg, 2) + "\n" + updateSuccess,
+		},
+		{
+			quackword: "new quackword",
+			args:      "newer quackword",
+			dryRun:    true,
+			expected:  dryRunRewrapMsg,
+		},
+		{
+			quackword: "new quackword",
+			args:      "newer quackword",
+			expected:  updateSuccess,
+		},
+	}
+
+	for i := 0; i < len(steps); i++ {
+		step := steps[i]
+		os.Setenv("QUACKWORD", step.quackword)
+		dryRun = step.dryRun
+		updateErrorMocks = step.failures
+
+		actual := Quackword(step.args)
+
+		if actual != step.expected {
+			t.Errorf("cmd.Quackword(%v) at step %d returned %s, expected %s", step.args, i, actual, step.expected)
+		}
+	}
+
+	if rotationMock != nil {
+		t.Errorf("cmd.Quackword() left a checkpoint behind: %+v", rotationMock)
+	}
+
+	os.Setenv("QUACKWORD", "newer quackword")
+	rekey = true
+	expected := fmt.Sprintf(reencryptedMsg, 2) + "\n" + updateSuccess
+	if actual := Quackword("newest quackword"); actual != expected {
+		t.Errorf("cmd.Quackword(newest quackword) with --rekey returned %s, expected %s", actual, expected)
+	}
+
+	os.Setenv("QUACKWORD", "newest quackword")
+	if err := updatedMock.SetDecryptedContent(); err != nil || updatedMock.DecryptedContent != "Second" {
+		t.Errorf("entry re-encrypted by cmd.Quackword() decrypted to %s, %v, expected Second", updatedMock.DecryptedContent, err)
+	}
+}
+
+func TestQuackwordOlderKeys(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer os.Setenv("QUACKWORD", "password")
+	defer func() { rotationMock, trashMock = nil, nil }()
+	defer resetJournalKey()
+	resetJournalKey()
+
+	// A rotation was started elsewhere and superseded by another key, so
+	// one entry is still under the first key and the checkpoint is stale.
+	first, _ := secure.AddDataKey("password")
+	old := storage.NewEntry(time.Now())
+	old.Encrypt("Old")
+	entriesMock = []storage.Entry{old}
+	trashed := storage.NewEntry(time.Now())
+	trashed.Encrypt("Trashed")
+	trashMock = []storage.TrashedEntry{{Entry: trashed, DeletedAt: time.Now()}}
+	rotationMock = &storage.Rotation{KeyID: hex.EncodeToString(first)}
+	secure.AddDataKey("password")
+
+	expected := fmt.Sprintf(reencryptedMsg, 2) + "\n" + updateSuccess
+	if actual := Quackword("new quackword"); actual != expected {
+		t.Errorf("cmd.Quackword(new quackword) returned %s, expected %s", actual, expected)
+	}
+
+	os.Setenv("QUACKWORD", "new quackword")
+	secure.SetHeaderStore(journalHeader{})
+	entry := entriesMock[0]
+	if err := entry.SetDecryptedContent(); err != nil || entry.DecryptedContent != "Old" {
+		t.Errorf("entry under an older key decrypted to %s, %v after cmd.Quackword(), expected Old", entry.DecryptedContent, err)
+	}
+
+	entry = trashMock[0].Entry
+	if err := entry.SetDecryptedContent(); err != nil || entry.DecryptedContent != "Trashed" {
+		t.Errorf("trashed entry under an older key decrypted to %s, %v after cmd.Quackword(), expected Trashed", entry.DecryptedContent, err)
+	}
+}
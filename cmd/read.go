@@ -1,21 +1,38 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/jonathanwthom/quack/query"
 	"github.com/jonathanwthom/quack/storage"
 	"github.com/spf13/cobra"
+	"io"
 	"sort"
 	"strings"
+	"time"
+)
+
+const (
+	sortByDate      = "date"
+	sortByRelevance = "relevance"
 )
 
 const (
 	unableToReadError = "Unable to read entries."
+	invalidSortError  = "Unable to sort by %q. Please sort by date or relevance."
+	staleCacheNote    = "Unable to update the local cache (%v), showing cached entries."
+	invalidRangeError = "Unable to read entries since %s until %s, which is before it starts."
 )
 
 var verbose bool
 var search string
 var date string
 var number int
+var sortBy string
+var since string
+var until string
+var tagged []string
 
 // readCmd represents the read command
 var readCmd = &cobra.Command{
@@ -26,7 +43,33 @@ Run quack read to see last 10 entries in normal mode.
 See more entries by passing the -n flag, e.g quack read -n 30 for last 30 entries.
 Run quack read -v to read in verbose mode. Verbose mode
 includes each entry's unique identifier, which can be passed to
-quack delete`,
+quack delete
+
+Search with -s. Words match whole words in any case, and stand* matches any
+word starting with stand. "Quoted phrases" match words in order. Terms are
+all required unless combined with OR, and can be excluded with NOT or a
+leading -, and grouped with parentheses. tag:name or #name matches a
+hashtag, and date: matches a day, month or year, e.g. date:2020-03-09,
+date:2020-03 or date:2020, a range such as date:2020-01..2020-03, or dates
+before or after one with <, <=, > or >=. Dates are in your time zone.
+
+  quack read -s '"on call" OR pager -tag:work date:2026'
+
+Limit entries to a time span with --since and --until, which each take a
+date such as 2020-03-09, 2020-03-09T15:04, 2020-03, 2020, "March 2020",
+today, yesterday, "last week", "this month" or "3 days ago". The whole day,
+month or year named is included, so --since "last week" --until yesterday
+reads from the Monday of last week through the end of yesterday.
+
+Read entries with a tag with --tag standup, or that mention someone with
+--tag @name. Repeat --tag to require several.
+
+Pass --sort relevance to show the best matches first instead of the newest.
+
+Entries are kept decrypted in an encrypted cache under ~/.quack-cache, which
+is brought up to date before each read, so searches don't download the whole
+journal and reads still work offline. Pass --no-cache to read storage
+directly.`,
 	Run: ReadRunner,
 }
 
@@ -36,38 +79,209 @@ func ReadRunner(cmd *cobra.Command, args []string) {
 	fmt.Println(result)
 }
 
-// Read returns all entries
+// Read returns the most recent, or most relevant, entries that match the
+// search query and date, fetching only as many as are shown
 func Read(args ...string) string {
-	entries, err := store.Read()
+	q, err := readQuery()
 	if err != nil {
-		return unableToReadError
+		return err.Error()
 	}
 
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].CreatedAt.After(entries[j].CreatedAt)
-	})
+	if sortBy != sortByDate && sortBy != sortByRelevance {
+		return fmt.Sprintf(invalidSortError, sortBy)
+	}
+
+	limit := count()
+	if sortBy == sortByRelevance {
+		limit = 0
+	}
+
+	entries, note, err := readMatching(q, limit)
+	if err != nil {
+		return err.Error()
+	}
+
+	entries = rank(q, entries)
+	if len(entries) > count() {
+		entries = entries[:count()]
+	}
 
 	var results []string
+	if note != "" {
+		results = append(results, note)
+	}
 
-	for i := 0; i < count(entries); i++ {
-		result, err := entries[i].Transform(verbose, search, date)
+	for i := 0; i < len(entries); i++ {
+		result, err := entries[i].Format(verbose)
 		if err != nil {
 			return err.Error()
 		}
 
-		if result != "" {
-			results = append(results, result)
-		}
+		results = append(results, result)
 	}
 
 	return strings.Join(results, "\n\n")
 }
 
-func count(entries []storage.Entry) int {
-	if number != 0 && number <= len(entries) {
+// readQuery combines the search, date, since, until and tag flags into one
+// query
+func readQuery() (*query.Query, error) {
+	q, err := query.Parse(search)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid search: %v", err)
+	}
+
+	span, err := readSpan(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	q = query.And(q, query.During(span))
+
+	for _, tag := range tagged {
+		q = query.And(q, query.Tagged(tag))
+	}
+
+	if date == "" {
+		return q, nil
+	}
+
+	d, err := query.Parse(fmt.Sprintf("date:%q", date))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid date: %v", err)
+	}
+
+	return query.And(q, d), nil
+}
+
+// readSpan returns the time from the start of since to the end of until,
+// in now's time zone
+func readSpan(now time.Time) (query.Period, error) {
+	var span query.Period
+	if since != "" {
+		p, err := query.ParseDate(since, now)
+		if err != nil {
+			return span, fmt.Errorf("Invalid --since: %v", err)
+		}
+		span.Start = p.Start
+	}
+
+	if until != "" {
+		p, err := query.ParseDate(until, now)
+		if err != nil {
+			return span, fmt.Errorf("Invalid --until: %v", err)
+		}
+		span.End = p.End
+	}
+
+	if !span.Start.IsZero() && !span.End.IsZero() && !span.Start.Before(span.End) {
+		return span, fmt.Errorf(invalidRangeError, since, until)
+	}
+
+	return span, nil
+}
+
+func document(entry storage.Entry) query.Document {
+	return query.Document{
+		Content:   entry.DecryptedContent,
+		CreatedAt: entry.CreatedAt,
+		Tags:      entry.Tags,
+		Mentions:  entry.Mentions,
+	}
+}
+
+// rank orders matching entries newest first, or by relevance to q
+func rank(q *query.Query, entries []storage.Entry) []storage.Entry {
+	scores := make(map[string]float64, len(entries))
+	if sortBy == sortByRelevance {
+		docs := make([]query.Document, len(entries))
+		for i, entry := range entries {
+			docs[i] = document(entry)
+		}
+		for i, score := range q.Rank(docs) {
+			scores[entries[i].Key] = score
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := scores[entries[i].Key], scores[entries[j].Key]
+		if a != b {
+			return a > b
+		}
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+
+	return entries
+}
+
+// readMatching returns up to limit entries matching q, or all of them if
+// limit is zero, from the local cache if there is one or else from storage.
+// A note is returned if the cache couldn't be brought up to date.
+func readMatching(q *query.Query, limit int) ([]storage.Entry, string, error) {
+	entries, note, ok := readCached(q)
+	if ok {
+		return entries, note, nil
+	}
+
+	entries, err := readStored(q, limit)
+	return entries, "", err
+}
+
+// readStored reads entries newest first from storage until limit match, or
+// through the whole journal if limit is zero
+func readStored(q *query.Query, limit int) ([]storage.Entry, error) {
+	it, err := store.Iterate(context.Background(), storage.IterateOptions{Newest: true})
+	if err != nil {
+		return nil, errors.New(unableToReadError)
+	}
+	defer it.Stop()
+
+	var entries []storage.Entry
+	for limit == 0 || len(entries) < limit {
+		entry, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New(unableToReadError)
+		}
+
+		if err := entry.SetDecryptedContent(); err != nil {
+			return nil, err
+		}
+
+		if q.Match(document(entry)) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// readCached answers from the local cache after syncing it with storage. If
+// the sync fails, e.g. when offline, the cache is used as it is.
+func readCached(q *query.Query) ([]storage.Entry, string, bool) {
+	c, syncErr := openCache()
+	if c == nil {
+		return nil, "", false
+	}
+
+	var entries []storage.Entry
+	for _, entry := range c.Entries(q.Required()...) {
+		if q.Match(document(entry)) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if syncErr != nil {
+		return entries, fmt.Sprintf(staleCacheNote, syncErr), true
+	}
+
+	return entries, "", true
+}
+
+func count() int {
+	if number > 0 {
 		return number
-	} else if len(entries) < 10 {
-		return len(entries)
 	}
 
 	return 10
@@ -76,7 +290,11 @@ func count(entries []storage.Entry) int {
 func init() {
 	rootCmd.AddCommand(readCmd)
 	readCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Display entries in verbose mode")
-	readCmd.Flags().StringVarP(&search, "search", "s", "", "Search entries by text")
+	readCmd.Flags().StringVarP(&search, "search", "s", "", "Search entries, e.g. 'standup OR pager -tag:work'")
+	readCmd.Flags().StringVar(&sortBy, "sort", sortByDate, "Sort entries by date or relevance")
 	readCmd.Flags().StringVarP(&date, "date", "d", "", "Search entries by date in format:  \"March 9, 2020\"")
+	readCmd.Flags().StringVar(&since, "since", "", "Read entries from this date on, e.g. 2020-03, yesterday or \"3 days ago\"")
+	readCmd.Flags().StringVar(&until, "until", "", "Read entries up to the end of this date, e.g. 2020-03-09 or \"last week\"")
+	readCmd.Flags().StringArrayVarP(&tagged, "tag", "t", nil, "Read entries with a #tag, or an @mention, e.g. standup or @sam")
 	readCmd.Flags().IntVarP(&number, "number", "n", 0, "Return last n entries")
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/jonathanwthom/quack/storage"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -45,10 +46,12 @@ func TestRead(t *testing.T) {
 				{
 					CreatedAt: time.Date(2009, time.November, 10, 23, 0, 0, 0, time.Now().Location()),
 					Content:   "7ruS7L8Ksk8bHCtpWp1+OOJ0N9z92Xr5fFUJHARiTWwXpQwaJ6iBLQ==",
+					Key:       "newer",
 				},
 				{
 					CreatedAt: time.Date(2008, time.November, 10, 23, 0, 0, 0, time.Now().Location()),
 					Content:   "7ruS7L8Ksk8bHCtpWp1+OOJ0N9z92Xr5fFUJHARiTWwXpQwaJ6iBLQ==",
+					Key:       "older",
 				},
 			},
 			err:      nil,
@@ -71,3 +74,113 @@ func TestRead(t *testing.T) {
 		}
 	}
 }
+
+func TestReadQuery(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() {
+		search, date, since, until, tagged, sortBy, number, verbose = "", "", "", "", nil, sortByDate, 0, false
+	}()
+
+	var entries []storage.Entry
+	contents := []string{
+		"standing desk arrived #work",
+		"on call again with @sam, standing by the pager #oncall",
+		"standing all day at the standing desk",
+	}
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	for i, content := range contents {
+		entry := storage.NewEntry(start.Add(time.Duration(i) * 24 * time.Hour))
+		entry.Encrypt(content)
+		entries = append(entries, entry)
+	}
+	entriesMock = entries
+	errorMock = nil
+	number = 0
+
+	tests := []struct {
+		search   string
+		date     string
+		since    string
+		until    string
+		tags     []string
+		sort     string
+		expected []string
+	}{
+		{search: "standing", sort: sortByDate, expected: []string{contents[2], contents[1], contents[0]}},
+		{search: "standing", sort: sortByRelevance, expected: []string{contents[2], contents[0], contents[1]}},
+		{search: "desk -tag:work", sort: sortByDate, expected: []string{contents[2]}},
+		{search: `"standing by" OR arrived`, sort: sortByDate, expected: []string{contents[1], contents[0]}},
+		{search: "stand*", date: "October 17, 2026", sort: sortByDate, expected: []string{contents[1]}},
+		{search: "date:2026-10-16..2026-10-17", sort: sortByDate, expected: []string{contents[1], contents[0]}},
+		{search: "missing", sort: sortByDate, expected: nil},
+		{since: "2026-10-17", sort: sortByDate, expected: []string{contents[2], contents[1]}},
+		{until: "2026-10-17", sort: sortByDate, expected: []string{contents[1], contents[0]}},
+		{since: "2026-10", until: "October 16, 2026", sort: sortByDate, expected: []string{contents[0]}},
+		{search: "desk", since: "2026-10-17T00:00", sort: sortByDate, expected: []string{contents[2]}},
+		{tags: []string{"work"}, sort: sortByDate, expected: []string{contents[0]}},
+		{tags: []string{"#oncall", "@Sam"}, sort: sortByDate, expected: []string{contents[1]}},
+		{tags: []string{"work", "oncall"}, sort: sortByDate, expected: nil},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		search, date, since, until, tagged = test.search, test.date, test.since, test.until, test.tags
+		sortBy, verbose = test.sort, true
+
+		actual := Read()
+
+		var expected []string
+		for _, content := range test.expected {
+			for _, entry := range entries {
+				if entry.SetDecryptedContent(); entry.DecryptedContent == content {
+					formatted, _ := entry.Format(true)
+					expected = append(expected, formatted)
+				}
+			}
+		}
+
+		if actual != strings.Join(expected, "\n\n") {
+			t.Errorf("cmd.Read() with search %s, since %s, until %s, tags %v and sort %s returned %s, expected %v", test.search, test.since, test.until, test.tags, test.sort, actual, test.expected)
+		}
+	}
+
+	search, sortBy = "(unbalanced", sortByDate
+	if actual := Read(); !strings.HasPrefix(actual, "Invalid search") {
+		t.Errorf("cmd.Read() with search %s returned %s, expected an invalid search error", search, actual)
+	}
+
+	search, since, until = "", "2026-10-18", "2026-10-17"
+	if actual, expected := Read(), fmt.Sprintf(invalidRangeError, since, until); actual != expected {
+		t.Errorf("cmd.Read() since %s until %s returned %s, expected %s", since, until, actual, expected)
+	}
+
+	since, until = "someday", ""
+	if actual := Read(); !strings.HasPrefix(actual, "Invalid --since") {
+		t.Errorf("cmd.Read() since %s returned %s, expected an invalid --since error", since, actual)
+	}
+
+	search, since, sortBy = "", "", "alphabetical"
+	if actual, expected := Read(), fmt.Sprintf(invalidSortError, sortBy); actual != expected {
+		t.Errorf("cmd.Read() with sort %s returned %s, expected %s", sortBy, actual, expected)
+	}
+}
+
+func TestReadSpan(t *testing.T) {
+	defer func() { since, until = "", "" }()
+	now := time.Date(2026, 10, 21, 15, 30, 0, 0, time.Local)
+
+	since, until = "last week", "yesterday"
+	span, err := readSpan(now)
+	start, end := time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local), time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local)
+	if err != nil || !span.Start.Equal(start) || !span.End.Equal(end) {
+		t.Errorf("cmd.readSpan() since %s until %s returned %v, %v, expected %v to %v", since, until, span, err, start, end)
+	}
+
+	since, until = "3 days ago", ""
+	span, _ = readSpan(now)
+	start = time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)
+	if !span.Start.Equal(start) || !span.End.IsZero() {
+		t.Errorf("cmd.readSpan() since %s returned %v, expected %v onwards", since, span, start)
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	restoredMsg          = "Restored entry %s."
+	notInTrashError      = "Unable to find %s in the trash. Run quack trash list to see what can be restored."
+	restoreConflictError = "Unable to restore %s, another entry has been written under its unique id."
+	unableToRestoreError = "Unable to restore entry: %v"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <unique-id>",
+	Short: "Restore a deleted entry from the trash",
+	Long: `
+Bring a deleted entry back by running quack restore <unique-id>.
+The unique ids of deleted entries can be found by running quack trash list,
+and only as much of one as no other deleted entry's starts with is needed.`,
+	Args: cobra.ExactArgs(1),
+	Run:  RestoreRunner,
+}
+
+// RestoreRunner wraps Restore for easier testing
+func RestoreRunner(cmd *cobra.Command, args []string) {
+	result := Restore(args...)
+	fmt.Println(result)
+}
+
+// Restore moves an entry from the trash back into the journal
+func Restore(args ...string) string {
+	trasher, ok := store.(Trasher)
+	if !ok {
+		return noTrashError
+	}
+
+	trash, err := trasher.Trash()
+	if err != nil {
+		return fmt.Sprintf(unableToTrashError, err)
+	}
+	keys := make([]string, len(trash))
+	for i, trashed := range trash {
+		keys[i] = trashed.Key
+	}
+
+	key, err := storage.MatchKey(args[0], keys)
+	if err == storage.ErrKeyNotFound {
+		return fmt.Sprintf(notInTrashError, args[0])
+	}
+	if msg, ok := choiceError(err, args); ok {
+		return msg
+	}
+
+	err = trasher.Restore(key)
+	if err == storage.ErrNotInTrash {
+		return fmt.Sprintf(notInTrashError, key)
+	}
+	if err == storage.ErrConflict {
+		return fmt.Sprintf(restoreConflictError, key)
+	}
+	if err != nil {
+		return fmt.Sprintf(unableToRestoreError, err)
+	}
+
+	return fmt.Sprintf(restoredMsg, key)
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
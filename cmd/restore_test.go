@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestRestore(t *testing.T) {
+	store = new(fakeStorage)
+	defer func() { trashMock, restoredKeyMock, restoreErrorMock = nil, "", nil }()
+
+	key := "2026/10/18/01JAB3X5Y7Z9QWERTYUIOPASDF"
+	other := "2026/10/18/01JAB3X5Y7ZAAAAAAAAAAAAAAA"
+	trashMock = []storage.TrashedEntry{{Entry: storage.Entry{Key: key}}, {Entry: storage.Entry{Key: other}}}
+
+	tests := []struct {
+		prefix      string
+		err         error
+		restored    string
+		expected    string
+		description string
+	}{
+		{
+			prefix:      key,
+			restored:    key,
+			expected:    fmt.Sprintf(restoredMsg, key),
+			description: "when the entry is in the trash",
+		},
+		{
+			prefix:      "01JAB3X5Y7Z9",
+			restored:    key,
+			expected:    fmt.Sprintf(restoredMsg, key),
+			description: "when a unique prefix is passed",
+		},
+		{
+			prefix:      "01JAB3",
+			expected:    fmt.Sprintf(ambiguousKeyError, "01JAB3", key+"\n"+other),
+			description: "when the prefix matches more than one entry",
+		},
+		{
+			prefix:      "missing",
+			expected:    fmt.Sprintf(notInTrashError, "missing"),
+			description: "when the entry is not in the trash",
+		},
+		{
+			prefix:      key,
+			err:         storage.ErrConflict,
+			restored:    key,
+			expected:    fmt.Sprintf(restoreConflictError, key),
+			description: "when another entry has taken its key",
+		},
+		{
+			prefix:      key,
+			err:         errors.New("bucket unavailable"),
+			restored:    key,
+			expected:    fmt.Sprintf(unableToRestoreError, "bucket unavailable"),
+			description: "when restoring fails",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			restoredKeyMock, restoreErrorMock = "", test.err
+
+			actual := Restore(test.prefix)
+
+			if actual != test.expected {
+				t.Errorf("cmd.Restore(%s) returned %s, expected %s", test.prefix, actual, test.expected)
+			}
+			if restoredKeyMock != test.restored {
+				t.Errorf("cmd.Restore(%s) restored %q, expected %q", test.prefix, restoredKeyMock, test.restored)
+			}
+		})
+	}
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/cobra"
+	"io"
 	"os"
 
+	"github.com/jonathanwthom/quack/cache"
+	"github.com/jonathanwthom/quack/secure"
 	"github.com/jonathanwthom/quack/storage"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
@@ -14,11 +18,45 @@ var cfgFile string
 
 // Store has all CRUD methods and can be stubbed in tests
 type Store interface {
-	Create(string) error
+	Create(storage.Entry) error
 	Read() ([]storage.Entry, error)
+	Iterate(context.Context, storage.IterateOptions) (*storage.Iterator, error)
 	ReadByKey(string) (storage.Entry, error)
-	Delete(string) error
-	Update(storage.Entry) error
+	Delete(string, ...storage.Precondition) error
+	Update(storage.Entry, ...storage.Precondition) error
+	ReadHeader() ([]byte, error)
+	WriteHeader([]byte) error
+}
+
+// journalHeader lets secure load and save the journal header through
+// whichever store is currently in use
+type journalHeader struct{}
+
+func (journalHeader) ReadHeader() ([]byte, error) {
+	return store.ReadHeader()
+}
+
+func (journalHeader) WriteHeader(header []byte) error {
+	return store.WriteHeader(header)
+}
+
+// ReadHeaderVersion and WriteHeaderIf keep the header from being overwritten
+// with a stale copy, on stores that can tell
+func (journalHeader) ReadHeaderVersion() ([]byte, string, error) {
+	if versioned, ok := store.(secure.VersionedHeaderStore); ok {
+		return versioned.ReadHeaderVersion()
+	}
+
+	header, err := store.ReadHeader()
+	return header, "", err
+}
+
+func (journalHeader) WriteHeaderIf(header []byte, version string) error {
+	if versioned, ok := store.(secure.VersionedHeaderStore); ok {
+		return versioned.WriteHeaderIf(header, version)
+	}
+
+	return store.WriteHeader(header)
 }
 
 // Store is the global storage object
@@ -32,12 +70,19 @@ Entries are encrypted and can be stored locally or in the cloud.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: configureStore,
+	SilenceErrors:     true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	if closer, ok := store.(io.Closer); ok {
+		closer.Close()
+	}
+
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -46,7 +91,41 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	store = new(storage.Storage)
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (default is $HOME/.quack.yaml)")
+	rootCmd.PersistentFlags().String("backend", "", "Storage backend to use, e.g. file, s3, gcs or url")
+	rootCmd.PersistentFlags().String("bucket-url", "", "URL of the bucket to keep entries in, e.g. s3://my-bucket")
+	rootCmd.PersistentFlags().String("bucket-prefix", "", "Keep entries under this prefix within the bucket")
+	viper.BindPFlag(storage.ConfigKey("QUACK_BACKEND"), rootCmd.PersistentFlags().Lookup("backend"))
+	viper.BindPFlag(storage.ConfigKey("QUACK_BUCKET_URL"), rootCmd.PersistentFlags().Lookup("bucket-url"))
+	viper.BindPFlag(storage.ConfigKey("QUACK_BUCKET_PREFIX"), rootCmd.PersistentFlags().Lookup("bucket-prefix"))
+
+	store = &storage.Storage{Signer: secure.Signer{}}
+	secure.SetHeaderStore(journalHeader{})
+}
+
+// configureStore picks the storage backend from flags, environment and config
+// file before any command runs, so missing settings are reported up front.
+func configureStore(cmd *cobra.Command, args []string) error {
+	s, ok := store.(*storage.Storage)
+	if !ok {
+		return nil
+	}
+
+	err := s.Configure(storage.LoadConfig(viper.GetViper()))
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	// The newest manifest seen is noted next to the cache, whether or not
+	// the cache is used.
+	if s.Identity() != "" {
+		if path, err := cache.Path(s.Identity()); err == nil {
+			s.WatermarkPath = path + ".manifest"
+		}
+	}
+
+	return nil
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -71,6 +150,7 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// On stderr, so it stays out of output such as quack export.
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jonathanwthom/quack/secure"
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	noSyncDestinationError = "Please pass the bucket to sync with, e.g. --to s3://my-bucket."
+	invalidPreferError     = "Unable to prefer %q. Please pass --prefer from or --prefer to."
+	noSyncerError          = "This storage can't be synced. Please pass --from."
+	differentJournalsError = "Unable to sync: %s and %s hold different journals."
+	keysDivergedError      = "Unable to sync: %s and %s have each added a journal key since they were last synced.\nRun quack sync again with --prefer from or --prefer to to choose which encrypts new entries; both keys are kept."
+	unableToSyncError      = "Unable to sync: %v\nRun quack sync again to finish."
+	alreadyInSyncMsg       = "Already in sync."
+	syncCopiedMsg          = "Copied %d entries from %s to %s."
+	syncDeletedMsg         = "Deleted %d entries from %s."
+	syncHeaderMsg          = "Updated the journal header in %s."
+	syncConflictsMsg       = "Left %d entries changed on both sides as they are:\n%s\nRun quack sync again with --prefer from or --prefer to to keep one side's."
+	configuredJournal      = "your journal"
+)
+
+var syncFrom string
+var syncTo string
+var prefer string
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Copy entries between buckets and keep them in step",
+	Long: `
+Run quack sync --to <url> to copy your journal to another bucket, such as
+s3://my-bucket or file:///backups/quack, or to bring two copies back into
+step. Pass --from <url> to sync from a bucket other than the configured one.
+
+Entries are copied as they are stored, still encrypted, with the dates they
+were written. An entry written or edited on one side since the last sync is
+copied to the other, and one deleted on one side is deleted from the other.
+An entry changed on both sides, or changed on one and deleted on the other,
+is a conflict and is left alone unless you pass --prefer from or --prefer to.
+
+Both buckets must hold the same journal, or be empty.`,
+	Args: cobra.NoArgs,
+	Run:  SyncRunner,
+}
+
+// SyncRunner wraps Sync for easier testing
+func SyncRunner(cmd *cobra.Command, args []string) {
+	result := Sync(args...)
+	fmt.Println(result)
+}
+
+// Sync brings the entries in two buckets into step
+func Sync(args ...string) string {
+	if syncTo == "" {
+		return noSyncDestinationError
+	}
+	if prefer != "" && prefer != storage.PreferFrom && prefer != storage.PreferTo {
+		return fmt.Sprintf(invalidPreferError, prefer)
+	}
+
+	fromName := syncFrom
+	from, ok := store.(*storage.Storage)
+	if syncFrom != "" {
+		s, err := openSyncStorage(syncFrom)
+		if err != nil {
+			return fmt.Sprintf(unableToSyncError, err)
+		}
+		defer s.Close()
+		from, ok = s, true
+	} else {
+		fromName = configuredJournal
+	}
+	if !ok {
+		return noSyncerError
+	}
+
+	to, err := openSyncStorage(syncTo)
+	if err != nil {
+		return fmt.Sprintf(unableToSyncError, err)
+	}
+	defer to.Close()
+
+	// Both manifests are signed with keys from the journal header, which
+	// Sync brings up to date on both sides first.
+	secure.SetHeaderStore(from)
+	defer secure.SetHeaderStore(journalHeader{})
+
+	report, err := storage.Sync(context.Background(), from, to, storage.SyncOptions{Prefer: prefer})
+	if err == storage.ErrDifferentJournals {
+		return fmt.Sprintf(differentJournalsError, fromName, syncTo)
+	}
+	if err == storage.ErrKeysDiverged {
+		return fmt.Sprintf(keysDivergedError, fromName, syncTo)
+	}
+	if err != nil {
+		return fmt.Sprintf(unableToSyncError, err)
+	}
+
+	var lines []string
+	for _, side := range report.Header {
+		name := syncTo
+		if side == storage.PreferFrom {
+			name = fromName
+		}
+		lines = append(lines, fmt.Sprintf(syncHeaderMsg, name))
+	}
+	if n := len(report.Copied); n > 0 {
+		lines = append(lines, fmt.Sprintf(syncCopiedMsg, n, fromName, syncTo))
+	}
+	if n := len(report.CopiedBack); n > 0 {
+		lines = append(lines, fmt.Sprintf(syncCopiedMsg, n, syncTo, fromName))
+	}
+	if n := len(report.Deleted); n > 0 {
+		lines = append(lines, fmt.Sprintf(syncDeletedMsg, n, syncTo))
+	}
+	if n := len(report.DeletedBack); n > 0 {
+		lines = append(lines, fmt.Sprintf(syncDeletedMsg, n, fromName))
+	}
+	if n := len(report.Conflicts); n > 0 {
+		lines = append(lines, fmt.Sprintf(syncConflictsMsg, n, strings.Join(report.Conflicts, "\n")))
+	}
+
+	if len(lines) == 0 {
+		return alreadyInSyncMsg
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// openSyncStorage opens the bucket at a URL for syncing
+func openSyncStorage(url string) (*storage.Storage, error) {
+	backend, err := storage.NewURLBackend(url, "")
+	if err != nil {
+		return nil, err
+	}
+
+	s := storage.New(backend)
+	s.Signer = secure.Signer{}
+
+	return s, nil
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringVar(&syncFrom, "from", "", "URL of the bucket to sync from (default is the configured one)")
+	syncCmd.Flags().StringVar(&syncTo, "to", "", "URL of the bucket to sync with, e.g. s3://my-bucket")
+	syncCmd.Flags().StringVar(&prefer, "prefer", "", "Settle conflicts in favour of from or to")
+}
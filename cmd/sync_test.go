@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/secure"
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestSync(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() { syncFrom, syncTo, prefer = "", "", "" }()
+	defer resetJournalKey()
+
+	fromDir, _ := ioutil.TempDir("", "quack-sync-from")
+	defer os.RemoveAll(fromDir)
+	toDir, _ := ioutil.TempDir("", "quack-sync-to")
+	defer os.RemoveAll(toDir)
+	fromURL, toURL := "file://"+fromDir, "file://"+toDir
+
+	from, _ := openSyncStorage(fromURL)
+	secure.SetHeaderStore(from)
+	entry := storage.NewEntry(time.Now())
+	entry.Encrypt("Hello World!")
+	from.Create(entry)
+	from.Close()
+	resetJournalKey()
+
+	tests := []struct {
+		from        string
+		to          string
+		prefer      string
+		expected    string
+		description string
+	}{
+		{
+			expected:    noSyncDestinationError,
+			description: "when there is nothing to sync with",
+		},
+		{
+			to:          toURL,
+			prefer:      "mine",
+			expected:    fmt.Sprintf(invalidPreferError, "mine"),
+			description: "when --prefer is invalid",
+		},
+		{
+			to:          toURL,
+			expected:    noSyncerError,
+			description: "when the configured storage can't be synced",
+		},
+		{
+			from: fromURL,
+			to:   toURL,
+			expected: fmt.Sprintf(syncHeaderMsg, toURL) + "\n" +
+				fmt.Sprintf(syncCopiedMsg, 1, fromURL, toURL),
+			description: "when entries are copied",
+		},
+		{
+			from:        fromURL,
+			to:          toURL,
+			expected:    alreadyInSyncMsg,
+			description: "when the buckets are in sync",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			syncFrom, syncTo, prefer = test.from, test.to, test.prefer
+
+			actual := Sync()
+
+			if actual != test.expected {
+				t.Errorf("cmd.Sync() returned %s, expected %s", actual, test.expected)
+			}
+		})
+	}
+
+	to, _ := openSyncStorage(toURL)
+	defer to.Close()
+	secure.SetHeaderStore(to)
+	synced, err := to.ReadByKey(entry.Key)
+	if err != nil {
+		t.Fatalf("storage.ReadByKey(%s) returned error %v after cmd.Sync()", entry.Key, err)
+	}
+	if err := synced.SetDecryptedContent(); err != nil || synced.DecryptedContent != "Hello World!" {
+		t.Errorf("cmd.Sync() copied %q, %v, expected Hello World!", synced.DecryptedContent, err)
+	}
+}
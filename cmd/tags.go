@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonathanwthom/quack/query"
+	"github.com/spf13/cobra"
+)
+
+const noTagsMsg = "No tags yet. Tag entries with #name, or mention someone with @name."
+
+// tagsCmd represents the tags command
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "List tags and mentions",
+	Long: `
+Run quack tags to list every #tag and @mention in your journal, with how
+many entries use it and when it was last used. Pass a tag to quack read
+--tag to read its entries.`,
+	Run: TagsRunner,
+}
+
+// TagsRunner wraps Tags for easier testing
+func TagsRunner(cmd *cobra.Command, args []string) {
+	result := Tags(args...)
+	fmt.Println(result)
+}
+
+// tagUse is how often a tag or mention is used
+type tagUse struct {
+	name     string
+	count    int
+	lastUsed time.Time
+}
+
+// Tags lists every tag and mention, most used first
+func Tags(args ...string) string {
+	all, err := query.Parse("")
+	if err != nil {
+		return err.Error()
+	}
+
+	entries, note, err := readMatching(all, 0)
+	if err != nil {
+		return err.Error()
+	}
+
+	uses := make(map[string]*tagUse)
+	add := func(name string, createdAt time.Time) {
+		use, ok := uses[name]
+		if !ok {
+			use = &tagUse{name: name}
+			uses[name] = use
+		}
+		use.count++
+		if createdAt.After(use.lastUsed) {
+			use.lastUsed = createdAt
+		}
+	}
+
+	for _, entry := range entries {
+		for _, tag := range entry.Tags {
+			add("#"+tag, entry.CreatedAt)
+		}
+		for _, mention := range entry.Mentions {
+			add("@"+mention, entry.CreatedAt)
+		}
+	}
+
+	if len(uses) == 0 {
+		return noTagsMsg
+	}
+
+	sorted := make([]*tagUse, 0, len(uses))
+	for _, use := range uses {
+		sorted = append(sorted, use)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].name < sorted[j].name
+	})
+
+	var buf bytes.Buffer
+	if note != "" {
+		fmt.Fprintf(&buf, "%s\n\n", note)
+	}
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tENTRIES\tLAST USED")
+	for _, use := range sorted {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", use.name, use.count, use.lastUsed.In(time.Local).Format("January 2, 2006"))
+	}
+	w.Flush()
+
+	return string(bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+func init() {
+	rootCmd.AddCommand(tagsCmd)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestTags(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() { entriesMock = nil }()
+
+	entriesMock = nil
+	if actual := Tags(); actual != noTagsMsg {
+		t.Errorf("cmd.Tags() without tags returned %s, expected %s", actual, noTagsMsg)
+	}
+
+	contents := []string{
+		"#standup ran long, @sam presented",
+		"paged twice #oncall #standup",
+		"#Standup again",
+	}
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+	for i, content := range contents {
+		entry := storage.NewEntry(start.Add(time.Duration(i) * 24 * time.Hour))
+		entry.Encrypt(content)
+		entriesMock = append(entriesMock, entry)
+	}
+
+	expected := strings.Join([]string{
+		"TAG       ENTRIES  LAST USED",
+		"#standup  3        October 18, 2026",
+		"#oncall   1        October 17, 2026",
+		"@sam      1        October 16, 2026",
+	}, "\n")
+	if actual := Tags(); actual != expected {
+		t.Errorf("cmd.Tags() returned\n%s\nexpected\n%s", actual, expected)
+	}
+}
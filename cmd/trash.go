@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	noTrashError       = "This storage does not keep deleted entries."
+	unableToTrashError = "Unable to read the trash: %v"
+	emptyTrashMsg      = "The trash is empty."
+	trashedEntryFormat = "%s\nDeleted %s"
+	invalidAgeError    = "Unable to purge entries older than %q. Please pass a number of days, e.g. 30d, or a duration such as 12h."
+	unableToPurgeError = "Unable to purge the trash after deleting %d entries: %v"
+	purgedMsg          = "Permanently deleted %d entries from the trash."
+	nothingToPurgeMsg  = "No entries in the trash are older than %s."
+)
+
+// Trasher keeps deleted entries until they are restored or purged
+type Trasher interface {
+	Trash() ([]storage.TrashedEntry, error)
+	Restore(key string) error
+	Purge(before time.Time) ([]string, error)
+	UpdateTrashed(e storage.Entry, conds ...storage.Precondition) error
+}
+
+var olderThan string
+
+// trashCmd represents the trash command
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List or purge deleted entries",
+	Long: `
+Deleted entries are kept in the trash, still encrypted, until they are
+purged. Run quack trash list to see them, quack restore <unique-id> to bring
+one back, and quack trash purge to delete old ones for good.`,
+}
+
+// trashListCmd represents the trash list command
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List deleted entries",
+	Long: `
+Run quack trash list to see deleted entries, most recently deleted first,
+with their unique ids, which can be passed to quack restore.`,
+	Args: cobra.NoArgs,
+	Run:  TrashListRunner,
+}
+
+// trashPurgeCmd represents the trash purge command
+var trashPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently delete old entries from the trash",
+	Long: `
+Run quack trash purge to permanently delete entries that have been in the
+trash for longer than --older-than, 30 days unless you say otherwise, e.g.
+quack trash purge --older-than 7d. Pass --older-than 0d to empty the trash.`,
+	Args: cobra.NoArgs,
+	Run:  TrashPurgeRunner,
+}
+
+// TrashListRunner wraps TrashList for easier testing
+func TrashListRunner(cmd *cobra.Command, args []string) {
+	result := TrashList(args...)
+	fmt.Println(result)
+}
+
+// TrashList returns the deleted entries, most recently deleted first
+func TrashList(args ...string) string {
+	trasher, ok := store.(Trasher)
+	if !ok {
+		return noTrashError
+	}
+
+	trash, err := trasher.Trash()
+	if err != nil {
+		return fmt.Sprintf(unableToTrashError, err)
+	}
+	if len(trash) == 0 {
+		return emptyTrashMsg
+	}
+	sort.SliceStable(trash, func(i, j int) bool {
+		return trash[i].DeletedAt.After(trash[j].DeletedAt)
+	})
+
+	loc := time.Now().Location()
+	var results []string
+	for _, trashed := range trash {
+		entry := trashed.Entry
+		if err := entry.SetDecryptedContent(); err != nil {
+			return err.Error()
+		}
+
+		result, err := entry.Format(true)
+		if err != nil {
+			return err.Error()
+		}
+		deletedAt := trashed.DeletedAt.In(loc).Format("January 2, 2006 - 3:04 PM MST")
+		results = append(results, fmt.Sprintf(trashedEntryFormat, result, deletedAt))
+	}
+
+	return strings.Join(results, "\n\n")
+}
+
+// TrashPurgeRunner wraps TrashPurge for easier testing
+func TrashPurgeRunner(cmd *cobra.Command, args []string) {
+	result := TrashPurge(args...)
+	fmt.Println(result)
+}
+
+// TrashPurge permanently deletes entries that have been in the trash for
+// longer than --older-than
+func TrashPurge(args ...string) string {
+	trasher, ok := store.(Trasher)
+	if !ok {
+		return noTrashError
+	}
+
+	age, err := parseAge(olderThan)
+	if err != nil {
+		return fmt.Sprintf(invalidAgeError, olderThan)
+	}
+
+	purged, err := trasher.Purge(time.Now().Add(-age))
+	if err != nil {
+		return fmt.Sprintf(unableToPurgeError, len(purged), err)
+	}
+	if len(purged) == 0 {
+		return fmt.Sprintf(nothingToPurgeMsg, olderThan)
+	}
+
+	return fmt.Sprintf(purgedMsg, len(purged))
+}
+
+// parseAge reads a number of days or weeks, e.g. 30d or 2w, or a duration
+// time.ParseDuration understands, e.g. 12h
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+
+	return age, nil
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashPurgeCmd)
+	trashPurgeCmd.Flags().StringVar(&olderThan, "older-than", "30d", "Purge entries deleted longer ago than this, e.g. 30d, 2w or 12h")
+}
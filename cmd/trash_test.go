@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestTrashList(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() { trashMock = nil }()
+	defer resetJournalKey()
+
+	trashMock = nil
+	if actual := TrashList(); actual != emptyTrashMsg {
+		t.Errorf("cmd.TrashList() returned %s, expected %s", actual, emptyTrashMsg)
+	}
+
+	older := storage.NewEntry(time.Now())
+	older.Encrypt("deleted first")
+	newer := storage.NewEntry(time.Now())
+	newer.Encrypt("deleted last")
+	trashMock = []storage.TrashedEntry{
+		{Entry: older, DeletedAt: time.Now().Add(-time.Hour)},
+		{Entry: newer, DeletedAt: time.Now()},
+	}
+
+	actual := TrashList()
+	first, last := strings.Index(actual, "deleted last"), strings.Index(actual, "deleted first")
+	if first < 0 || last < 0 || first > last || !strings.Contains(actual, newer.Key) || !strings.Contains(actual, "\nDeleted ") {
+		t.Errorf("cmd.TrashList() returned %s, expected both entries with their ids, most recently deleted first", actual)
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	store = new(fakeStorage)
+	defer func() { olderThan, purgedMock, purgeErrorMock = "30d", nil, nil }()
+
+	tests := []struct {
+		olderThan   string
+		purged      []string
+		err         error
+		age         time.Duration
+		expected    string
+		description string
+	}{
+		{
+			olderThan:   "30d",
+			purged:      []string{"one", "two"},
+			age:         30 * 24 * time.Hour,
+			expected:    fmt.Sprintf(purgedMsg, 2),
+			description: "when old entries are purged",
+		},
+		{
+			olderThan:   "2w",
+			age:         14 * 24 * time.Hour,
+			expected:    fmt.Sprintf(nothingToPurgeMsg, "2w"),
+			description: "when nothing is old enough",
+		},
+		{
+			olderThan:   "12h",
+			purged:      []string{"one"},
+			err:         errors.New("bucket unavailable"),
+			age:         12 * time.Hour,
+			expected:    fmt.Sprintf(unableToPurgeError, 1, "bucket unavailable"),
+			description: "when purging fails part way",
+		},
+		{
+			olderThan:   "a month",
+			expected:    fmt.Sprintf(invalidAgeError, "a month"),
+			description: "when --older-than is invalid",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			olderThan, purgedMock, purgeErrorMock = test.olderThan, test.purged, test.err
+			purgedBeforeMock = time.Time{}
+
+			before := time.Now()
+			actual := TrashPurge()
+
+			if actual != test.expected {
+				t.Errorf("cmd.TrashPurge() returned %s, expected %s", actual, test.expected)
+			}
+			if test.age > 0 {
+				if cutoff := before.Add(-test.age); purgedBeforeMock.Before(cutoff) || purgedBeforeMock.After(cutoff.Add(time.Minute)) {
+					t.Errorf("cmd.TrashPurge() purged before %v, expected %v", purgedBeforeMock, cutoff)
+				}
+			}
+		})
+	}
+}
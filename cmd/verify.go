@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jonathanwthom/quack/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	verifySuccessMsg  = "All %d entries match the journal manifest."
+	verifyFailedMsg   = "Journal does not match its manifest."
+	noVerifierError   = "This storage does not keep a journal manifest."
+	unableToVerifyMsg = "Unable to verify journal: %v"
+	rolledBackMsg     = "Journal manifest is older than one already seen on this machine. The journal may have been rolled back to an earlier copy, undoing later changes."
+)
+
+// Verifier checks stored entries against the signed journal manifest
+type Verifier interface {
+	Verify() (storage.Report, error)
+}
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that no entries were removed, replaced or reordered",
+	Long: `
+Run quack verify to compare the entries in storage with the signed
+journal manifest. Entries that are missing, were added outside of quack,
+were altered, or had their dates changed are listed by unique id, as are
+entries that no longer decrypt with their key and date.`,
+	Run: VerifyRunner,
+}
+
+// VerifyRunner wraps Verify for easier testing
+func VerifyRunner(cmd *cobra.Command, args []string) {
+	result := Verify(args...)
+	fmt.Println(result)
+}
+
+// Verify reports any differences between storage and the journal manifest
+func Verify(args ...string) string {
+	verifier, ok := store.(Verifier)
+	if !ok {
+		return noVerifierError
+	}
+
+	report, err := verifier.Verify()
+	if err == storage.ErrRolledBack {
+		return rolledBackMsg
+	}
+	if err != nil {
+		return fmt.Sprintf(unableToVerifyMsg, err)
+	}
+
+	entries, err := store.Read()
+	if err != nil {
+		return unableToReadError
+	}
+
+	var undecryptable []string
+	for i := 0; i < len(entries); i++ {
+		if err := entries[i].SetDecryptedContent(); err != nil {
+			undecryptable = append(undecryptable, entries[i].Key)
+		}
+	}
+
+	if report.OK() && len(undecryptable) == 0 {
+		return fmt.Sprintf(verifySuccessMsg, report.Entries)
+	}
+
+	results := []string{verifyFailedMsg}
+	results = appendKeys(results, "Missing", report.Missing)
+	results = appendKeys(results, "Not in manifest", report.Unlisted)
+	results = appendKeys(results, "Altered", report.Altered)
+	results = appendKeys(results, "Reordered", report.Reordered)
+	results = appendKeys(results, "Unable to decrypt", undecryptable)
+
+	return strings.Join(results, "\n")
+}
+
+func appendKeys(results []string, label string, keys []string) []string {
+	if len(keys) == 0 {
+		return results
+	}
+
+	return append(results, fmt.Sprintf("%s (%d):\n  %s", label, len(keys), strings.Join(keys, "\n  ")))
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestVerify(t *testing.T) {
+	store = new(fakeStorage)
+	os.Setenv("QUACKWORD", "password")
+	defer func() { entriesMock, reportMock, reportErrorMock = nil, storage.Report{}, nil }()
+
+	entry := storage.NewEntry(time.Now())
+	entry.Encrypt("Hello World!")
+	swapped := entry
+	swapped.Key = "swapped"
+
+	tests := []struct {
+		entries     []storage.Entry
+		report      storage.Report
+		err         error
+		expected    string
+		description string
+	}{
+		{
+			entries:     []storage.Entry{entry},
+			report:      storage.Report{Entries: 1},
+			expected:    fmt.Sprintf(verifySuccessMsg, 1),
+			description: "when the journal matches its manifest",
+		},
+		{
+			entries:     []storage.Entry{entry},
+			report:      storage.Report{Entries: 2, Missing: []string{"gone"}},
+			expected:    verifyFailedMsg + "\nMissing (1):\n  gone",
+			description: "when an entry is missing",
+		},
+		{
+			entries:     []storage.Entry{entry, swapped},
+			report:      storage.Report{Entries: 2},
+			expected:    verifyFailedMsg + "\nUnable to decrypt (1):\n  swapped",
+			description: "when an entry's key was changed",
+		},
+		{
+			err:         errors.New("tampered"),
+			expected:    fmt.Sprintf(unableToVerifyMsg, "tampered"),
+			description: "when the manifest can't be verified",
+		},
+		{
+			err:         storage.ErrRolledBack,
+			expected:    rolledBackMsg,
+			description: "when the manifest was rolled back",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			entriesMock = test.entries
+			reportMock = test.report
+			reportErrorMock = test.err
+
+			actual := Verify()
+
+			if actual != test.expected {
+				t.Errorf("cmd.Verify() returned %s, expected %s", actual, test.expected)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ go 1.12
 
 require (
 	cloud.google.com/go v0.60.0 // indirect
-	cloud.google.com/go/storage v1.10.0 // indirect
+	cloud.google.com/go/storage v1.10.0
 	github.com/Azure/azure-amqp-common-go/v2 v2.1.0 // indirect
+	github.com/Azure/azure-pipeline-go v0.2.2
+	github.com/Azure/azure-storage-blob-go v0.9.0
 	github.com/aws/aws-sdk-go v1.33.1
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/grpc-ecosystem/grpc-gateway v1.9.2 // indirect
@@ -14,6 +16,7 @@ require (
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/mitchellh/mapstructure v1.3.2 // indirect
 	github.com/pelletier/go-toml v1.8.0 // indirect
+	github.com/rivo/uniseg v0.2.0
 	github.com/spf13/afero v1.3.1 // indirect
 	github.com/spf13/cast v1.3.1 // indirect
 	github.com/spf13/cobra v1.0.0
@@ -22,10 +25,13 @@ require (
 	github.com/spf13/viper v1.7.0
 	go.opencensus.io v0.22.4 // indirect
 	gocloud.dev v0.20.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/net v0.0.0-20200625001655-4c5254603344 // indirect
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
 	golang.org/x/text v0.3.3 // indirect
 	golang.org/x/tools v0.0.0-20200708003708-134513de8882 // indirect
+	google.golang.org/api v0.28.0
 	google.golang.org/genproto v0.0.0-20200702021140-07506425bd67 // indirect
 	google.golang.org/grpc v1.30.0 // indirect
 	gopkg.in/ini.v1 v1.57.0 // indirect
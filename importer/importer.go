@@ -0,0 +1,115 @@
+// Package importer reads entries exported from other journals, or from quack
+// itself, so they can be saved with the times they were first written.
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+// Record is an entry read from an export, before it is saved
+type Record struct {
+	CreatedAt time.Time
+	// UpdatedAt, if set, is when the entry was last edited
+	UpdatedAt time.Time
+	Content   string
+	Mood      string
+	Location  string
+	History   []storage.Revision
+}
+
+// Parser reads the records in an export
+type Parser func(r io.Reader) ([]Record, error)
+
+var (
+	parsersMu sync.Mutex
+	parsers   = map[string]Parser{}
+)
+
+// Built-in parser names
+const (
+	JSONParserName  = "json"
+	JrnlParserName  = "jrnl"
+	QuackParserName = "quack"
+)
+
+func init() {
+	Register(JSONParserName, ParseJSON)
+	Register(JrnlParserName, ParseJrnl)
+	Register(QuackParserName, ParseQuack)
+}
+
+// Register makes a parser available by name. Registering a name again
+// replaces the earlier parser.
+func Register(name string, p Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	parsers[name] = p
+}
+
+// Lookup returns the parser registered under name
+func Lookup(name string) (Parser, bool) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	p, ok := parsers[name]
+	return p, ok
+}
+
+// Names lists the registered parsers in order
+func Names() []string {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// errNoTime is returned for a record without a time it was written
+var errNoTime = errors.New("entry has no date")
+
+// Hash identifies an entry by its text and the minute it was written, so
+// importing the same export twice, or an export of entries already in the
+// journal, can be spotted. Exports that only keep times to the minute still
+// match.
+func Hash(createdAt time.Time, content string) string {
+	sum := sha256.Sum256([]byte(createdAt.UTC().Truncate(time.Minute).Format(time.RFC3339) + "\n" + strings.TrimSpace(content)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// timeLayouts are the formats dates in exports are read in, local time
+// unless they say otherwise
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
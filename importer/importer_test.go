@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Record
+		err      bool
+	}{
+		{
+			input: `[{"content": "Shipped it", "createdAt": "2020-03-09T15:04:05Z", "mood": "proud", "location": "Portland"}]`,
+			expected: []Record{
+				{CreatedAt: time.Date(2020, 3, 9, 15, 4, 5, 0, time.UTC), Content: "Shipped it", Mood: "proud", Location: "Portland"},
+			},
+		},
+		{
+			// Day One
+			input: `{"metadata": {"version": "1.0"}, "entries": [{"text": "Hiked", "creationDate": "2020-03-09T15:04:05Z", "modifiedDate": "2020-03-10T09:00:00Z", "location": {"localityName": "Portland", "administrativeArea": "Oregon"}}]}`,
+			expected: []Record{
+				{CreatedAt: time.Date(2020, 3, 9, 15, 4, 5, 0, time.UTC), UpdatedAt: time.Date(2020, 3, 10, 9, 0, 0, 0, time.UTC), Content: "Hiked", Location: "Portland, Oregon"},
+			},
+		},
+		{
+			// JSON Lines
+			input: "{\"body\": \"One\", \"date\": \"2020-03-09\"}\n{\"body\": \"Two\", \"date\": \"2020-03-10 08:30\"}\n",
+			expected: []Record{
+				{CreatedAt: time.Date(2020, 3, 9, 0, 0, 0, 0, time.Local), Content: "One"},
+				{CreatedAt: time.Date(2020, 3, 10, 8, 30, 0, 0, time.Local), Content: "Two"},
+			},
+		},
+		{
+			input: `[{"content": "When?"}]`,
+			err:   true,
+		},
+		{
+			input: `[{"content": `,
+			err:   true,
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+
+		actual, err := ParseJSON(strings.NewReader(test.input))
+		if test.err != (err != nil) {
+			t.Errorf("importer.ParseJSON(%s) returned error %v, expected error: %v", test.input, err, test.err)
+			continue
+		}
+		if !sameRecords(actual, test.expected) {
+			t.Errorf("importer.ParseJSON(%s) returned %+v, expected %+v", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestParseJrnl(t *testing.T) {
+	input := `[2020-03-09 15:04] Shipped it. The release went out.
+Nobody noticed.
+
+[2020-03-10 09:00] *Starred and short.
+2020-03-11 08:15 PM Older jrnl versions leave out the brackets.
+`
+	expected := []Record{
+		{CreatedAt: time.Date(2020, 3, 9, 15, 4, 0, 0, time.Local), Content: "Shipped it. The release went out.\nNobody noticed."},
+		{CreatedAt: time.Date(2020, 3, 10, 9, 0, 0, 0, time.Local), Content: "Starred and short."},
+		{CreatedAt: time.Date(2020, 3, 11, 20, 15, 0, 0, time.Local), Content: "Older jrnl versions leave out the brackets."},
+	}
+
+	actual, err := ParseJrnl(strings.NewReader(input))
+	if err != nil || !sameRecords(actual, expected) {
+		t.Errorf("importer.ParseJrnl() returned %+v, %v, expected %+v", actual, err, expected)
+	}
+}
+
+func TestParseQuack(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+
+	entry := storage.NewEntry(time.Date(2020, 3, 9, 15, 4, 5, 0, time.UTC))
+	entry.Mood = "proud"
+	entry.Encrypt("Shipped it")
+	archive, _ := storage.NewArchive([]storage.Entry{entry}, nil, time.Now()).Seal()
+
+	tests := []string{
+		`[{"key": "2020/03/09/01E2X", "createdAt": "2020-03-09T15:04:05Z", "updatedAt": "2020-03-09T15:04:05Z", "content": "Shipped it", "mood": "proud"}]`,
+		`{"key": "2020/03/09/01E2X", "createdAt": "2020-03-09T15:04:05Z", "updatedAt": "2020-03-09T15:04:05Z", "content": "Shipped it", "mood": "proud"}`,
+		archive + "\n",
+	}
+	expected := []Record{
+		{CreatedAt: entry.CreatedAt, UpdatedAt: entry.CreatedAt, Content: "Shipped it", Mood: "proud"},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		actual, err := ParseQuack(strings.NewReader(tests[i]))
+		if err != nil || !sameRecords(actual, expected) {
+			t.Errorf("importer.ParseQuack(%s) returned %+v, %v, expected %+v", tests[i], actual, err, expected)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	at := time.Date(2020, 3, 9, 15, 4, 5, 0, time.UTC)
+
+	if Hash(at, "Shipped it") != Hash(at.Truncate(time.Minute).In(time.Local), "Shipped it\n") {
+		t.Errorf("importer.Hash() differed for the same text written in the same minute")
+	}
+	if Hash(at, "Shipped it") == Hash(at.AddDate(0, 0, 1), "Shipped it") {
+		t.Errorf("importer.Hash() matched the same text written on different days")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{JSONParserName, JrnlParserName, QuackParserName} {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("importer.Lookup(%s) found no parser", name)
+		}
+	}
+
+	Register("lines", func(r io.Reader) ([]Record, error) { return nil, nil })
+	if names := Names(); len(names) != 4 || names[1] != "json" {
+		t.Errorf("importer.Names() returned %v", names)
+	}
+}
+
+func sameRecords(actual, expected []Record) bool {
+	if len(actual) != len(expected) {
+		return false
+	}
+	for i := range actual {
+		a, e := actual[i], expected[i]
+		if !a.CreatedAt.Equal(e.CreatedAt) || !a.UpdatedAt.Equal(e.UpdatedAt) || a.Content != e.Content || a.Mood != e.Mood || a.Location != e.Location {
+			return false
+		}
+	}
+
+	return true
+}
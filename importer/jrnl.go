@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jrnlHeading matches the line that starts a jrnl entry: its date and time,
+// in brackets in newer versions, then its title
+var jrnlHeading = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2} \d{1,2}:\d{2}(?::\d{2})?(?: ?[AaPp][Mm])?)\]? ?(.*)$`)
+
+// jrnlLayouts are the date formats jrnl writes by default, in 24 or 12 hour
+// time
+var jrnlLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 03:04 PM",
+	"2006-01-02 3:04 PM",
+	"2006-01-02 03:04PM",
+	"2006-01-02 3:04PM",
+}
+
+// ParseJrnl reads a jrnl journal file, or jrnl's text export. Each entry
+// starts with a line holding its date and title, e.g.
+// [2020-03-09 15:04] Shipped it., with its body on the lines after. Times
+// are local.
+func ParseJrnl(r io.Reader) ([]Record, error) {
+	var records []Record
+	var lines []string
+	var createdAt time.Time
+
+	flush := func() {
+		if createdAt.IsZero() {
+			return
+		}
+		records = append(records, Record{
+			CreatedAt: createdAt,
+			Content:   strings.TrimSpace(strings.Join(lines, "\n")),
+		})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := jrnlHeading.FindStringSubmatch(line); m != nil {
+			if t, ok := parseJrnlTime(m[1]); ok {
+				flush()
+				createdAt = t
+				// Starred entries have a * before the title.
+				lines = []string{strings.TrimPrefix(strings.TrimPrefix(m[2], "*"), " ")}
+				continue
+			}
+		}
+
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return records, nil
+}
+
+func parseJrnlTime(value string) (time.Time, bool) {
+	for _, layout := range jrnlLayouts {
+		if t, err := time.ParseInLocation(layout, strings.ToUpper(value), time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
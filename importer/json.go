@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+// jsonEntry is an entry in a JSON export. The field names quack, Day One and
+// other journals use are all understood.
+type jsonEntry struct {
+	Content      string             `json:"content"`
+	Text         string             `json:"text"`
+	Body         string             `json:"body"`
+	CreatedAt    string             `json:"createdAt"`
+	Created      string             `json:"created"`
+	CreationDate string             `json:"creationDate"`
+	Date         string             `json:"date"`
+	UpdatedAt    string             `json:"updatedAt"`
+	ModifiedDate string             `json:"modifiedDate"`
+	Mood         string             `json:"mood"`
+	Location     json.RawMessage    `json:"location"`
+	History      []storage.Revision `json:"history"`
+}
+
+// ParseJSON reads entries from a JSON array of entries, an object with an
+// "entries" array as Day One exports, or one entry per line as JSON Lines.
+// Each entry needs its text in content, text or body, and when it was
+// written in createdAt, created, creationDate or date.
+func ParseJSON(r io.Reader) ([]Record, error) {
+	var entries []jsonEntry
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 && raw[0] == '[' {
+			var list []jsonEntry
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, err
+			}
+			entries = append(entries, list...)
+			continue
+		}
+
+		var journal struct {
+			Entries *[]jsonEntry `json:"entries"`
+		}
+		if err := json.Unmarshal(raw, &journal); err != nil {
+			return nil, err
+		}
+		if journal.Entries != nil {
+			entries = append(entries, *journal.Entries...)
+			continue
+		}
+
+		var entry jsonEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	records := make([]Record, 0, len(entries))
+	for i, entry := range entries {
+		record, err := entry.record()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (e jsonEntry) record() (Record, error) {
+	record := Record{
+		Content:  firstOf(e.Content, e.Text, e.Body),
+		Mood:     e.Mood,
+		Location: location(e.Location),
+		History:  e.History,
+	}
+
+	createdAt, ok := parseTime(firstOf(e.CreatedAt, e.Created, e.CreationDate, e.Date))
+	if !ok {
+		return record, errNoTime
+	}
+	record.CreatedAt = createdAt
+	record.UpdatedAt, _ = parseTime(firstOf(e.UpdatedAt, e.ModifiedDate))
+
+	return record, nil
+}
+
+// location reads a location written as text, or as a place the way Day One
+// writes them
+func location(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+
+	var place struct {
+		PlaceName          string `json:"placeName"`
+		LocalityName       string `json:"localityName"`
+		AdministrativeArea string `json:"administrativeArea"`
+	}
+	if json.Unmarshal(raw, &place) != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, part := range []string{firstOf(place.LocalityName, place.PlaceName), place.AdministrativeArea} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+
+	return ""
+}
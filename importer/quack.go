@@ -0,0 +1,48 @@
+package importer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jonathanwthom/quack/storage"
+)
+
+// ParseQuack reads what quack export writes: the json and jsonl formats, or
+// an archive, which is opened with the QUACKWORD
+func ParseQuack(r io.Reader) ([]Record, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return ParseJSON(bytes.NewReader(trimmed))
+	}
+
+	a, err := storage.OpenArchive(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := a.Decrypted()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, Record{
+			CreatedAt: entry.CreatedAt,
+			UpdatedAt: entry.UpdatedAt,
+			Content:   entry.DecryptedContent,
+			Mood:      entry.Mood,
+			Location:  entry.Location,
+			History:   entry.History,
+		})
+	}
+
+	return records, nil
+}
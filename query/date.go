@@ -0,0 +1,209 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is a span of time, from Start up to but not including End. A zero
+// Start or End leaves that side open.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains reports whether t falls within the period
+func (p Period) Contains(t time.Time) bool {
+	return (p.Start.IsZero() || !t.Before(p.Start)) && (p.End.IsZero() || t.Before(p.End))
+}
+
+// dateLayouts are the formats a date can be written in, with how long the
+// period each one names lasts
+var dateLayouts = []struct {
+	layout string
+	length func(time.Time) time.Time
+}{
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{"2006-01-02T15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02 15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"January 2, 2006", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"Jan 2, 2006", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"January 2 2006", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"January 2006", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"Jan 2006", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+// units are the lengths of time relative dates can be counted in
+var units = map[string]bool{"minute": true, "hour": true, "day": true, "week": true, "month": true, "year": true}
+
+// ParseDate reads a single date into the period it names, in now's time
+// zone. Dates can be written as ISO 8601 dates and times such as 2020-03-09
+// or 2020-03-09T15:04, as months or years such as 2020-03, "March 2020" or
+// 2020, or relative to now, such as today, yesterday, "this week",
+// "last month" or "3 days ago". Weeks start on Monday.
+func ParseDate(value string, now time.Time) (Period, error) {
+	value = strings.TrimSpace(value)
+	loc := now.Location()
+	for _, l := range dateLayouts {
+		t, err := time.ParseInLocation(l.layout, value, loc)
+		if err == nil {
+			return Period{Start: t, End: l.length(t)}, nil
+		}
+	}
+
+	if p, ok := relative(strings.ToLower(value), now); ok {
+		return p, nil
+	}
+
+	return Period{}, fmt.Errorf("unrecognized date %q, expected e.g. 2020-03-09, 2020-03, 2020, \"March 9, 2020\", yesterday, \"last week\" or \"3 days ago\"", value)
+}
+
+// relative reads a date written relative to now
+func relative(value string, now time.Time) (Period, bool) {
+	switch value {
+	case "now":
+		return truncate(now, "second"), true
+	case "today":
+		return truncate(now, "day"), true
+	case "yesterday":
+		return truncate(now.AddDate(0, 0, -1), "day"), true
+	case "tomorrow":
+		return truncate(now.AddDate(0, 0, 1), "day"), true
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) == 2 && units[fields[1]] && fields[1] != "minute" && fields[1] != "hour" {
+		switch fields[0] {
+		case "this":
+			return ago(now, 0, fields[1]), true
+		case "last":
+			return ago(now, 1, fields[1]), true
+		case "next":
+			return ago(now, -1, fields[1]), true
+		}
+	}
+
+	if len(fields) == 3 && fields[2] == "ago" {
+		unit := strings.TrimSuffix(fields[1], "s")
+		if !units[unit] {
+			return Period{}, false
+		}
+
+		n, err := strconv.Atoi(fields[0])
+		if fields[0] == "a" || fields[0] == "an" || fields[0] == "one" {
+			n, err = 1, nil
+		}
+		if err != nil || n < 0 {
+			return Period{}, false
+		}
+
+		return ago(now, n, unit), true
+	}
+
+	return Period{}, false
+}
+
+// ago returns the whole unit, such as the day or week, n units before now
+func ago(now time.Time, n int, unit string) Period {
+	switch unit {
+	case "minute":
+		now = now.Add(-time.Duration(n) * time.Minute)
+	case "hour":
+		now = now.Add(-time.Duration(n) * time.Hour)
+	case "day":
+		now = now.AddDate(0, 0, -n)
+	case "week":
+		now = now.AddDate(0, 0, -7*n)
+	case "month":
+		// Count from the first of the month so e.g. March 31 doesn't land
+		// in March again.
+		now = time.Date(now.Year(), now.Month()-time.Month(n), 1, 0, 0, 0, 0, now.Location())
+	case "year":
+		now = time.Date(now.Year()-n, 1, 1, 0, 0, 0, 0, now.Location())
+	}
+
+	return truncate(now, unit)
+}
+
+// truncate returns the whole unit of time containing t, in t's time zone
+func truncate(t time.Time, unit string) Period {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case "second":
+		start := time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc)
+		return Period{Start: start, End: start.Add(time.Second)}
+	case "minute":
+		start := time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+		return Period{Start: start, End: start.Add(time.Minute)}
+	case "hour":
+		start := time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+		return Period{Start: start, End: start.Add(time.Hour)}
+	case "week":
+		start := time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+		return Period{Start: start, End: start.AddDate(0, 0, 7)}
+	case "month":
+		start := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		return Period{Start: start, End: start.AddDate(0, 1, 0)}
+	case "year":
+		start := time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+		return Period{Start: start, End: start.AddDate(1, 0, 0)}
+	}
+
+	start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	return Period{Start: start, End: start.AddDate(0, 0, 1)}
+}
+
+// parsePeriod reads the value of a date: qualifier. It can be a single
+// date, a range such as 2020-01..2020-03 with either end left open, or a
+// date after one of >, >=, < or <=.
+func parsePeriod(value string, now time.Time) (Period, error) {
+	if i := strings.Index(value, ".."); i >= 0 {
+		var p Period
+		if from := value[:i]; from != "" {
+			start, err := ParseDate(from, now)
+			if err != nil {
+				return Period{}, err
+			}
+			p.Start = start.Start
+		}
+		if to := value[i+2:]; to != "" {
+			end, err := ParseDate(to, now)
+			if err != nil {
+				return Period{}, err
+			}
+			p.End = end.End
+		}
+		return p, nil
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if !strings.HasPrefix(value, op) {
+			continue
+		}
+
+		day, err := ParseDate(value[len(op):], now)
+		if err != nil {
+			return Period{}, err
+		}
+
+		switch op {
+		case ">=":
+			return Period{Start: day.Start}, nil
+		case ">":
+			return Period{Start: day.End}, nil
+		case "<=":
+			return Period{End: day.End}, nil
+		default:
+			return Period{End: day.Start}, nil
+		}
+	}
+
+	return ParseDate(value, now)
+}
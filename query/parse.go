@@ -0,0 +1,307 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenQualifier
+	tokenOpen
+	tokenClose
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenEnd
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	field string
+}
+
+// qualifiers are the fields that can be searched with field:value
+var qualifiers = map[string]bool{"tag": true, "mention": true, "date": true}
+
+// lex splits a query into tokens
+func lex(text string) ([]token, error) {
+	var tokens []token
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot})
+			i++
+		case r == '"':
+			phrase, next, err := quoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenPhrase, text: phrase})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()\"", runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+
+			if colon := strings.Index(word, ":"); colon > 0 && qualifiers[strings.ToLower(word[:colon])] {
+				value := word[colon+1:]
+				if value == "" && i < len(runes) && runes[i] == '"' {
+					var err error
+					if value, i, err = quoted(runes, i); err != nil {
+						return nil, err
+					}
+				}
+				tokens = append(tokens, token{kind: tokenQualifier, field: strings.ToLower(word[:colon]), text: value})
+				continue
+			}
+
+			switch word {
+			case "AND":
+				tokens = append(tokens, token{kind: tokenAnd})
+			case "OR":
+				tokens = append(tokens, token{kind: tokenOr})
+			case "NOT":
+				tokens = append(tokens, token{kind: tokenNot})
+			default:
+				tokens = append(tokens, token{kind: tokenWord, text: word})
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd}), nil
+}
+
+// quoted reads the quoted string starting at runes[start], returning it and
+// the position after the closing quote
+func quoted(runes []rune, start int) (string, int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '"' {
+			return string(runes[start+1 : i]), i + 1, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("missing closing quote in %q", string(runes[start:]))
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+// Parse reads a search query, interpreting dates in the local time zone.
+//
+// Words match whole words in any case, and a trailing * matches any word
+// starting with what comes before it. "Quoted phrases" match words next to
+// each other. Terms next to each other must all match, and can be combined
+// with AND, OR, NOT (or a leading -) and parentheses. tag:name (or #name)
+// matches a hashtag and mention:name (or @name) a mention. date: matches
+// any date ParseDate reads, such as date:2020-03-09, date:2020-03 or
+// date:yesterday, a range such as date:2020-01..2020-03, or dates before or
+// after one with <, <=, > or >=.
+func Parse(text string) (*Query, error) {
+	return ParseIn(text, time.Local)
+}
+
+// ParseIn is like Parse, but interprets dates in loc
+func ParseIn(text string, loc *time.Location) (*Query, error) {
+	return parseAt(text, time.Now().In(loc))
+}
+
+// parseAt parses a query with relative dates counted back from now
+func parseAt(text string, now time.Time) (*Query, error) {
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, now: now}
+	if p.peek().kind == tokenEnd {
+		return &Query{root: allNode{}}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %s in query", describe(p.peek()))
+	}
+
+	return &Query{root: root}, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	var children []node
+	for {
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+
+		if p.peek().kind != tokenOr {
+			break
+		}
+		p.next()
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return orNode(children), nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	var children []node
+	for {
+		switch p.peek().kind {
+		case tokenOr, tokenClose, tokenEnd:
+			if len(children) == 0 {
+				return nil, fmt.Errorf("expected a search term before %s", describe(p.peek()))
+			}
+			if len(children) == 1 {
+				return children[0], nil
+			}
+			return andNode(children), nil
+		case tokenAnd:
+			if len(children) == 0 {
+				return nil, fmt.Errorf("expected a search term before AND")
+			}
+			p.next()
+			if kind := p.peek().kind; kind == tokenOr || kind == tokenClose || kind == tokenEnd || kind == tokenAnd {
+				return nil, fmt.Errorf("expected a search term after AND")
+			}
+		}
+
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().kind != tokenNot {
+		return p.parsePrimary()
+	}
+	p.next()
+
+	child, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	return notNode{child: child}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenOpen:
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenClose {
+			return nil, fmt.Errorf("missing closing parenthesis in query")
+		}
+		return child, nil
+	case tokenWord:
+		if strings.HasPrefix(t.text, "#") && len(t.text) > 1 {
+			return tagNode{tag: strings.ToLower(t.text[1:])}, nil
+		}
+		if strings.HasPrefix(t.text, "@") && len(t.text) > 1 {
+			return mentionNode{name: strings.ToLower(t.text[1:])}, nil
+		}
+		return phrase(t.text, strings.HasSuffix(t.text, "*"))
+	case tokenPhrase:
+		return phrase(t.text, false)
+	case tokenQualifier:
+		return p.qualifier(t)
+	}
+
+	return nil, fmt.Errorf("expected a search term, found %s", describe(t))
+}
+
+func (p *parser) qualifier(t token) (node, error) {
+	if t.text == "" {
+		return nil, fmt.Errorf("%s: needs a value", t.field)
+	}
+
+	switch t.field {
+	case "tag":
+		return tagNode{tag: strings.ToLower(strings.TrimPrefix(t.text, "#"))}, nil
+	case "mention":
+		return mentionNode{name: strings.ToLower(strings.TrimPrefix(t.text, "@"))}, nil
+	default:
+		period, err := parsePeriod(t.text, p.now)
+		if err != nil {
+			return nil, err
+		}
+		return dateNode{period: period}, nil
+	}
+}
+
+// phrase builds a node matching the words in text
+func phrase(text string, prefix bool) (node, error) {
+	ws := words(text)
+	if len(ws) == 0 {
+		return nil, fmt.Errorf("nothing to search for in %q", text)
+	}
+
+	return phraseNode{words: ws, prefix: prefix}, nil
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokenOpen:
+		return "("
+	case tokenClose:
+		return ")"
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenEnd:
+		return "end of query"
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
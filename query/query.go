@@ -0,0 +1,219 @@
+package query
+
+import (
+	"strings"
+	"time"
+)
+
+// Document is what a query is matched against
+type Document struct {
+	Content   string
+	CreatedAt time.Time
+	// Tags are the document's hashtags without the #, and Mentions its
+	// mentions without the @. If nil, they are read from Content.
+	Tags     []string
+	Mentions []string
+}
+
+// analyzed is a document broken into the pieces queries look at
+type analyzed struct {
+	words     []string
+	tags      map[string]bool
+	mentions  map[string]bool
+	createdAt time.Time
+}
+
+func analyze(doc Document) *analyzed {
+	tags := doc.Tags
+	if tags == nil {
+		tags = Tags(doc.Content)
+	}
+	mentions := doc.Mentions
+	if mentions == nil {
+		mentions = Mentions(doc.Content)
+	}
+
+	return &analyzed{
+		words:     words(doc.Content),
+		tags:      set(tags),
+		mentions:  set(mentions),
+		createdAt: doc.CreatedAt,
+	}
+}
+
+func set(names []string) map[string]bool {
+	s := make(map[string]bool, len(names))
+	for _, name := range names {
+		s[strings.ToLower(name)] = true
+	}
+
+	return s
+}
+
+// Query is a parsed search. See Parse for the syntax.
+type Query struct {
+	root node
+}
+
+// Match reports whether doc satisfies the query
+func (q *Query) Match(doc Document) bool {
+	return q.root.match(analyze(doc))
+}
+
+// Required returns words that every matching document contains somewhere
+// in its content, ignoring case. An index can use them to rule documents out
+// before matching; documents containing them all may still not match.
+func (q *Query) Required() []string {
+	return q.root.required()
+}
+
+// And returns a query matching documents that match every one of queries
+func And(queries ...*Query) *Query {
+	var children []node
+	for _, q := range queries {
+		if _, ok := q.root.(allNode); !ok {
+			children = append(children, q.root)
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return &Query{root: allNode{}}
+	case 1:
+		return &Query{root: children[0]}
+	}
+
+	return &Query{root: andNode(children)}
+}
+
+// Tagged returns a query matching documents tagged name, or mentioning it if
+// it starts with @. A leading # is optional.
+func Tagged(name string) *Query {
+	if strings.HasPrefix(name, "@") {
+		return &Query{root: mentionNode{name: strings.ToLower(name[1:])}}
+	}
+
+	return &Query{root: tagNode{tag: strings.ToLower(strings.TrimPrefix(name, "#"))}}
+}
+
+// During returns a query matching documents created within p
+func During(p Period) *Query {
+	if p.Start.IsZero() && p.End.IsZero() {
+		return &Query{root: allNode{}}
+	}
+
+	return &Query{root: dateNode{period: p}}
+}
+
+type node interface {
+	match(d *analyzed) bool
+	required() []string
+}
+
+// counter is a node that can say how often it occurs in a document, which
+// ranking is based on
+type counter interface {
+	node
+	count(d *analyzed) int
+}
+
+// allNode is the empty query, which matches everything
+type allNode struct{}
+
+func (allNode) match(d *analyzed) bool { return true }
+func (allNode) required() []string     { return nil }
+
+type andNode []node
+
+func (n andNode) match(d *analyzed) bool {
+	for _, child := range n {
+		if !child.match(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n andNode) required() []string {
+	var required []string
+	for _, child := range n {
+		required = append(required, child.required()...)
+	}
+	return required
+}
+
+type orNode []node
+
+func (n orNode) match(d *analyzed) bool {
+	for _, child := range n {
+		if child.match(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n orNode) required() []string { return nil }
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) match(d *analyzed) bool { return !n.child.match(d) }
+func (n notNode) required() []string     { return nil }
+
+// phraseNode matches words in order, next to each other. A single word is a
+// phrase of one. If prefix is set, the last word only has to start the
+// document's word.
+type phraseNode struct {
+	words  []string
+	prefix bool
+}
+
+func (n phraseNode) wordMatches(i int, word string) bool {
+	if n.prefix && i == len(n.words)-1 {
+		return strings.HasPrefix(word, n.words[i])
+	}
+	return word == n.words[i]
+}
+
+func (n phraseNode) count(d *analyzed) int {
+	count := 0
+	for i := 0; i+len(n.words) <= len(d.words); i++ {
+		found := true
+		for j := range n.words {
+			if !n.wordMatches(j, d.words[i+j]) {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+	return count
+}
+
+func (n phraseNode) match(d *analyzed) bool { return n.count(d) > 0 }
+func (n phraseNode) required() []string     { return n.words }
+
+type tagNode struct {
+	tag string
+}
+
+func (n tagNode) match(d *analyzed) bool { return d.tags[n.tag] }
+func (n tagNode) required() []string     { return nil }
+
+type mentionNode struct {
+	name string
+}
+
+func (n mentionNode) match(d *analyzed) bool { return d.mentions[n.name] }
+func (n mentionNode) required() []string     { return nil }
+
+type dateNode struct {
+	period Period
+}
+
+func (n dateNode) match(d *analyzed) bool { return n.period.Contains(d.createdAt) }
+func (n dateNode) required() []string     { return nil }
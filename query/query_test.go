@@ -0,0 +1,257 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var pacific = time.FixedZone("PDT", -7*60*60)
+
+var docs = []Document{
+	{Content: "Standup ran long again. #standup #work", CreatedAt: time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC)},
+	{Content: "On call this week with @Sam, pager went off twice. #oncall", CreatedAt: time.Date(2026, 10, 17, 18, 0, 0, 0, time.UTC)},
+	{Content: "Walked to the café on the corner", CreatedAt: time.Date(2026, 9, 30, 18, 0, 0, 0, time.UTC)},
+	{Content: "Standing desk arrived, standing all day", CreatedAt: time.Date(2025, 12, 31, 20, 0, 0, 0, time.UTC)},
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{query: "", expected: []int{0, 1, 2, 3}},
+		{query: "standup", expected: []int{0}},
+		{query: "STANDUP", expected: []int{0}},
+		{query: "stand", expected: nil},
+		{query: "stand*", expected: []int{0, 3}},
+		{query: "on call", expected: []int{1}},
+		{query: `"call this week"`, expected: []int{1}},
+		{query: `"week call"`, expected: nil},
+		{query: "standup OR café", expected: []int{0, 2}},
+		{query: "standup AND long", expected: []int{0}},
+		{query: "standup AND short", expected: nil},
+		{query: "stand* NOT desk", expected: []int{0}},
+		{query: "stand* -desk", expected: []int{0}},
+		{query: "(standup OR pager) -tag:work", expected: []int{1}},
+		{query: "tag:oncall", expected: []int{1}},
+		{query: "#standup", expected: []int{0}},
+		{query: "tag:#WORK", expected: []int{0}},
+		{query: "@sam", expected: []int{1}},
+		{query: "mention:@SAM -#work", expected: []int{1}},
+		{query: "mention:work", expected: nil},
+		{query: "date:2026-10-16", expected: []int{0}},
+		{query: "date:2026-10", expected: []int{0, 1}},
+		{query: "date:2025", expected: []int{3}},
+		{query: `date:"October 16, 2026"`, expected: []int{0}},
+		{query: "date:2026-09..2026-10", expected: []int{0, 1, 2}},
+		{query: "date:>=2026-10-01", expected: []int{0, 1}},
+		{query: "date:<2026", expected: []int{3}},
+		{query: "date:>2026-10-16", expected: []int{1}},
+		{query: "date:<=2026-09", expected: []int{2, 3}},
+		{query: "date:..2025", expected: []int{3}},
+		{query: "NOT NOT standup", expected: []int{0}},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		q, err := ParseIn(test.query, pacific)
+		if err != nil {
+			t.Errorf("query.Parse(%s) returned error %v", test.query, err)
+			continue
+		}
+
+		var actual []int
+		for j, doc := range docs {
+			if q.Match(doc) {
+				actual = append(actual, j)
+			}
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("query.Parse(%s) matched %v, expected %v", test.query, actual, test.expected)
+		}
+	}
+}
+
+func TestDatesUseTimeZone(t *testing.T) {
+	// 03:00 UTC on the 17th is still the 16th in Pacific time.
+	doc := Document{Content: "late night", CreatedAt: time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)}
+
+	utc, _ := ParseIn("date:2026-10-17", time.UTC)
+	local, _ := ParseIn("date:2026-10-16", pacific)
+
+	if !utc.Match(doc) || !local.Match(doc) {
+		t.Errorf("date: did not match %v in the query's time zone", doc.CreatedAt)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2026, 10, 21, 15, 30, 0, 0, pacific)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, pacific) }
+
+	tests := []struct {
+		value    string
+		expected Period
+	}{
+		{value: "2026-10-16", expected: Period{day(2026, 10, 16), day(2026, 10, 17)}},
+		{value: "2026-10", expected: Period{day(2026, 10, 1), day(2026, 11, 1)}},
+		{value: "2025", expected: Period{day(2025, 1, 1), day(2026, 1, 1)}},
+		{value: "March 2020", expected: Period{day(2020, 3, 1), day(2020, 4, 1)}},
+		{value: "2026-10-16T09:15", expected: Period{time.Date(2026, 10, 16, 9, 15, 0, 0, pacific), time.Date(2026, 10, 16, 9, 16, 0, 0, pacific)}},
+		{value: "2026-10-16T09:15:00Z", expected: Period{time.Date(2026, 10, 16, 9, 15, 0, 0, time.UTC), time.Date(2026, 10, 16, 9, 15, 1, 0, time.UTC)}},
+		{value: "today", expected: Period{day(2026, 10, 21), day(2026, 10, 22)}},
+		{value: "Yesterday", expected: Period{day(2026, 10, 20), day(2026, 10, 21)}},
+		{value: "this week", expected: Period{day(2026, 10, 19), day(2026, 10, 26)}},
+		{value: "last week", expected: Period{day(2026, 10, 12), day(2026, 10, 19)}},
+		{value: "last month", expected: Period{day(2026, 9, 1), day(2026, 10, 1)}},
+		{value: "last year", expected: Period{day(2025, 1, 1), day(2026, 1, 1)}},
+		{value: "3 days ago", expected: Period{day(2026, 10, 18), day(2026, 10, 19)}},
+		{value: "a week ago", expected: Period{day(2026, 10, 12), day(2026, 10, 19)}},
+		{value: "2 hours ago", expected: Period{time.Date(2026, 10, 21, 13, 0, 0, 0, pacific), time.Date(2026, 10, 21, 14, 0, 0, 0, pacific)}},
+		{value: "10 months ago", expected: Period{day(2025, 12, 1), day(2026, 1, 1)}},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		actual, err := ParseDate(test.value, now)
+		if err != nil || !actual.Start.Equal(test.expected.Start) || !actual.End.Equal(test.expected.End) {
+			t.Errorf("query.ParseDate(%s) returned %v, %v, expected %v", test.value, actual, err, test.expected)
+		}
+	}
+
+	for _, value := range []string{"someday", "3 fortnights ago", "-2 days ago", "last hour", "2026-13"} {
+		if _, err := ParseDate(value, now); err == nil {
+			t.Errorf("query.ParseDate(%s) returned no error", value)
+		}
+	}
+
+	q, _ := parseAt(`date:yesterday..today`, now)
+	if !q.Match(Document{CreatedAt: time.Date(2026, 10, 20, 9, 0, 0, 0, pacific)}) || q.Match(Document{CreatedAt: day(2026, 10, 19)}) {
+		t.Errorf("date:yesterday..today did not match from yesterday through today")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		`"unterminated`,
+		"(standup",
+		"standup)",
+		"OR standup",
+		"standup OR",
+		"standup AND",
+		"AND standup",
+		"NOT",
+		"()",
+		"date:yesterday-ish",
+		"date:",
+		"!!!",
+	}
+
+	for i := 0; i < len(tests); i++ {
+		if _, err := Parse(tests[i]); err == nil {
+			t.Errorf("query.Parse(%s) returned no error", tests[i])
+		}
+	}
+}
+
+func TestRequired(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{query: "standup", expected: []string{"standup"}},
+		{query: `stand* "call this"`, expected: []string{"stand", "call", "this"}},
+		{query: "standup OR pager", expected: nil},
+		{query: "standup -pager tag:work", expected: []string{"standup"}},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		q, _ := Parse(test.query)
+		actual := q.Required()
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("query.Parse(%s).Required() returned %v, expected %v", test.query, actual, test.expected)
+		}
+	}
+}
+
+func TestAnd(t *testing.T) {
+	a, _ := Parse("stand*")
+	b, _ := ParseIn("date:2026", pacific)
+	empty, _ := Parse("")
+
+	q := And(a, empty, b)
+	if !q.Match(docs[0]) || q.Match(docs[3]) {
+		t.Errorf("query.And() did not require both queries")
+	}
+
+	if !And(empty).Match(docs[0]) {
+		t.Errorf("query.And() of an empty query did not match everything")
+	}
+}
+
+func TestRank(t *testing.T) {
+	ranked := []Document{
+		{Content: "standing desk arrived"},
+		{Content: "standing all day at the standing desk, standing"},
+		{Content: "a long day, but no desk in sight at all today"},
+	}
+
+	q, _ := Parse("standing OR desk")
+	scores := q.Rank(ranked)
+
+	if !(scores[1] > scores[0] && scores[0] > scores[2] && scores[2] > 0) {
+		t.Errorf("query.Rank() returned %v, expected the most mentions of standing first", scores)
+	}
+
+	q, _ = Parse("-standing")
+	for _, score := range q.Rank(ranked) {
+		if score != 0 {
+			t.Errorf("query.Rank() scored a query with only excluded terms: %v", score)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "#standup ran long #Work #standup", expected: []string{"standup", "work"}},
+		{text: "(#on-call) and #oncall.", expected: []string{"on-call", "oncall"}},
+		{text: "C# and issue#4 and #1 and ##double", expected: nil},
+		{text: "#café time", expected: []string{"café"}},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		actual := Tags(test.text)
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("query.Tags(%s) returned %v, expected %v", test.text, actual, test.expected)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "lunch with @Sam and @alex-b, then @sam again", expected: []string{"sam", "alex-b"}},
+		{text: "mail sam@example.com, not @@sam or @42", expected: nil},
+		{text: "#standup with @sam", expected: []string{"sam"}},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		actual := Mentions(test.text)
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("query.Mentions(%s) returned %v, expected %v", test.text, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package query
+
+import "math"
+
+// BM25 tuning: k1 limits how much repeating a term helps, and b how much
+// longer documents are penalized
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Rank scores how relevant each of docs is to the query, using BM25 over the
+// words and phrases the query looks for. Terms that only appear under NOT
+// don't count. Scores are only comparable within one call.
+func (q *Query) Rank(docs []Document) []float64 {
+	counters := positive(q.root)
+	scores := make([]float64, len(docs))
+	if len(counters) == 0 || len(docs) == 0 {
+		return scores
+	}
+
+	analyzedDocs := make([]*analyzed, len(docs))
+	total := 0
+	for i, doc := range docs {
+		analyzedDocs[i] = analyze(doc)
+		total += len(analyzedDocs[i].words)
+	}
+	avgLen := float64(total) / float64(len(docs))
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	n := float64(len(docs))
+	for _, c := range counters {
+		counts := make([]int, len(docs))
+		df := 0
+		for i, d := range analyzedDocs {
+			counts[i] = c.count(d)
+			if counts[i] > 0 {
+				df++
+			}
+		}
+
+		idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+		for i, d := range analyzedDocs {
+			if counts[i] == 0 {
+				continue
+			}
+			tf := float64(counts[i])
+			norm := k1 * (1 - b + b*float64(len(d.words))/avgLen)
+			scores[i] += idf * tf * (k1 + 1) / (tf + norm)
+		}
+	}
+
+	return scores
+}
+
+// positive finds the words and phrases a matching document is rewarded for
+// containing
+func positive(n node) []counter {
+	switch n := n.(type) {
+	case andNode:
+		var counters []counter
+		for _, child := range n {
+			counters = append(counters, positive(child)...)
+		}
+		return counters
+	case orNode:
+		var counters []counter
+		for _, child := range n {
+			counters = append(counters, positive(child)...)
+		}
+		return counters
+	case counter:
+		return []counter{n}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+// isWordRune reports whether r can be part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// words splits text into lowercase words, dropping punctuation
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+// Tags returns the distinct hashtags in text, lowercased and without the #,
+// in the order they first appear. A # only starts a tag at the start of the
+// text or after a character that can't be part of a word, so "C#" and
+// "issue#4" aren't tags.
+func Tags(text string) []string {
+	return marked(text, '#')
+}
+
+// Mentions returns the distinct @mentions in text, lowercased and without
+// the @, in the order they first appear. Like tags, an @ inside a word, as in
+// an email address, doesn't start one.
+func Mentions(text string) []string {
+	return marked(text, '@')
+}
+
+// marked finds the names following mark, which must start a word
+func marked(text string, mark rune) []string {
+	var found []string
+	seen := make(map[string]bool)
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != mark || (i > 0 && (isWordRune(runes[i-1]) || runes[i-1] == mark)) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(runes) && (isWordRune(runes[j]) || (runes[j] == '-' && j+1 < len(runes) && isWordRune(runes[j+1]))) {
+			j++
+		}
+
+		// A tag needs at least one letter, so "#1" isn't one.
+		name := strings.ToLower(string(runes[i+1 : j]))
+		if strings.IndexFunc(name, unicode.IsLetter) >= 0 && !seen[name] {
+			seen[name] = true
+			found = append(found, name)
+		}
+		i = j - 1
+	}
+
+	return found
+}
@@ -0,0 +1,261 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+const (
+	dataKeyLabel        = "quack data key"
+	noDataKeyError      = "This journal has no data key yet."
+	unknownDataKeyError = "Entry was encrypted with a data key this journal no longer has."
+)
+
+// DataKey is one of the journal's data keys. Entries are encrypted with the
+// data key itself, which is only stored wrapped with a key derived from the
+// QUACKWORD, so changing the QUACKWORD only means wrapping it again.
+type DataKey struct {
+	ID []byte `json:"id"`
+	// Salt is used in place of the header's salt to derive the wrapping key
+	Salt    []byte `json:"salt"`
+	Wrapped []byte `json:"wrapped"`
+}
+
+// DataKeyID returns the ID of the data key new entries are encrypted with,
+// or nil if the journal still encrypts entries with the QUACKWORD directly
+func DataKeyID() ([]byte, error) {
+	h, err := storedHeader()
+	if err != nil || h == nil || len(h.Keys) == 0 {
+		return nil, err
+	}
+
+	return h.Keys[0].ID, nil
+}
+
+// EncryptedWith reports whether msg was encrypted with the data key id
+func EncryptedWith(msg string, id []byte) bool {
+	env, err := ParseEnvelope(msg)
+
+	return err == nil && env.KDF == KDFDataKey && bytes.Equal(env.KeyID, id)
+}
+
+// AddDataKey generates a data key, wrapped with the quackword, and encrypts
+// new entries with it from now on. Entries already encrypted with older keys
+// can still be read until Rewrap drops them.
+func AddDataKey(quackword string) ([]byte, error) {
+	key := make([]byte, keySize)
+	id := make([]byte, keyIDSize)
+	for _, b := range [][]byte{key, id} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+	}
+
+	var dk DataKey
+	err := updateHeader(func(h *Header) error {
+		// Every data key is wrapped with the same QUACKWORD, so make sure
+		// it's the one the others were wrapped with.
+		if len(h.Keys) > 0 {
+			if _, err := h.unwrap(h.Keys[0], quackword); err != nil {
+				return err
+			}
+		}
+
+		if dk.Wrapped == nil {
+			var err error
+			if dk, err = h.wrap(id, key, quackword); err != nil {
+				return err
+			}
+		}
+		h.Keys = append([]DataKey{dk}, h.Keys...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// Rewrap wraps the data key id with newQuackword in place of quackword and
+// drops any older data keys, in a single write of the journal header. Every
+// entry must already be encrypted with id, which must still be the current
+// data key, or else ErrHeaderChanged is returned.
+func Rewrap(id []byte, quackword, newQuackword string) error {
+	return updateHeader(func(h *Header) error {
+		if len(h.Keys) == 0 {
+			return errors.New(noDataKeyError)
+		}
+		if !bytes.Equal(h.Keys[0].ID, id) {
+			return ErrHeaderChanged
+		}
+
+		key, err := h.unwrap(h.Keys[0], quackword)
+		if err != nil {
+			return err
+		}
+
+		dk, err := h.wrap(id, key, newQuackword)
+		if err != nil {
+			return err
+		}
+		h.Keys = []DataKey{dk}
+
+		return nil
+	})
+}
+
+// dataKey unwraps the data key id with the quackword
+func (h *Header) dataKey(id []byte, quackword string) ([]byte, error) {
+	for _, dk := range h.Keys {
+		if bytes.Equal(dk.ID, id) {
+			return h.unwrap(dk, quackword)
+		}
+	}
+
+	return nil, errors.New(unknownDataKeyError)
+}
+
+// wrap encrypts key with a key derived from the quackword and a fresh salt,
+// using the header's cost parameters
+func (h *Header) wrap(id, key []byte, quackword string) (DataKey, error) {
+	dk := DataKey{ID: id, Salt: make([]byte, saltSize)}
+	if _, err := io.ReadFull(rand.Reader, dk.Salt); err != nil {
+		return DataKey{}, err
+	}
+
+	gcm, err := newGCM(h.wrappingKey(dk, quackword))
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return DataKey{}, err
+	}
+	dk.Wrapped = gcm.Seal(nonce, nonce, key, dk.additionalData())
+
+	return dk, nil
+}
+
+func (h *Header) unwrap(dk DataKey, quackword string) ([]byte, error) {
+	if len(dk.Wrapped) < gcmNonceSize {
+		return nil, errors.New(invalidHeaderError)
+	}
+
+	key, err := open(h.wrappingKey(dk, quackword), dk.Wrapped[:gcmNonceSize], dk.Wrapped[gcmNonceSize:], dk.additionalData())
+	if err != nil {
+		return nil, errors.New(unableToDecryptError)
+	}
+
+	return []byte(key), nil
+}
+
+func (h *Header) wrappingKey(dk DataKey, quackword string) []byte {
+	kek := *h
+	kek.Salt = dk.Salt
+
+	return kek.deriveKey(quackword)
+}
+
+func (dk DataKey) additionalData() []byte {
+	return append([]byte(dataKeyLabel), dk.ID...)
+}
+
+// headerRetries is how many times a header changed by someone else is read
+// again before giving up
+const headerRetries = 5
+
+// updateHeader applies change to the journal header and saves it. Where the
+// header store allows, the header is read fresh and only saved if nobody
+// else has changed it since. If they have, change is applied again to what
+// they wrote, so the data keys both sides added are kept.
+func updateHeader(change func(*Header) error) error {
+	headerMu.Lock()
+	hs := headerStore
+	headerMu.Unlock()
+
+	versioned, ok := hs.(VersionedHeaderStore)
+	if !ok {
+		h, err := currentHeader()
+		if err != nil {
+			return err
+		}
+		updated := h.clone()
+		if err := change(updated); err != nil {
+			return err
+		}
+		return saveHeader(updated)
+	}
+
+	for attempt := 0; attempt < headerRetries; attempt++ {
+		data, version, err := versioned.ReadHeaderVersion()
+		if err != nil {
+			return err
+		}
+
+		var h *Header
+		if data == nil {
+			h, err = NewHeader()
+		} else {
+			h, err = ParseHeader(data)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := change(h); err != nil {
+			return err
+		}
+		if data, err = h.Marshal(); err != nil {
+			return err
+		}
+
+		err = versioned.WriteHeaderIf(data, version)
+		if err == ErrHeaderChanged {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		headerMu.Lock()
+		header = h
+		headerMu.Unlock()
+
+		return nil
+	}
+
+	return ErrHeaderChanged
+}
+
+// saveHeader writes h to the header store and uses it from now on
+func saveHeader(h *Header) error {
+	headerMu.Lock()
+	defer headerMu.Unlock()
+
+	if headerStore != nil {
+		data, err := h.Marshal()
+		if err != nil {
+			return err
+		}
+
+		if err := headerStore.WriteHeader(data); err != nil {
+			return err
+		}
+	}
+	header = h
+
+	return nil
+}
+
+// clone copies h, so that changing the copy's data keys leaves h alone
+func (h *Header) clone() *Header {
+	c := *h
+	c.Keys = append([]DataKey(nil), h.Keys...)
+
+	return &c
+}
@@ -0,0 +1,209 @@
+package secure
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDataKey(t *testing.T) {
+	hs := new(memoryHeaderStore)
+	SetHeaderStore(hs)
+	defer SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+	defer os.Setenv("QUACKWORD", "password")
+
+	before, _ := Encrypt("before")
+	signature, _ := Signer{}.Sign([]byte("manifest"))
+
+	first, err := AddDataKey("password")
+	if err != nil {
+		t.Fatalf("secure.AddDataKey() returned error %v", err)
+	}
+
+	if _, err := AddDataKey("not the password"); err == nil {
+		t.Errorf("secure.AddDataKey() accepted a QUACKWORD that doesn't match the journal's")
+	}
+
+	if id, _ := DataKeyID(); string(id) != string(first) {
+		t.Errorf("secure.DataKeyID() returned %x, expected %x", id, first)
+	}
+
+	after, _ := Encrypt("after")
+	if !EncryptedWith(after, first) || EncryptedWith(before, first) {
+		t.Errorf("secure.Encrypt() did not encrypt with the data key %x", first)
+	}
+
+	if err := Rewrap(first, "not the password", "new password"); err == nil {
+		t.Errorf("secure.Rewrap() accepted the wrong QUACKWORD")
+	}
+	if err := Rewrap(first, "password", "new password"); err != nil {
+		t.Fatalf("secure.Rewrap() returned error %v", err)
+	}
+
+	// A fresh process with the new QUACKWORD reads entries written with the
+	// data key, and the manifest signed before with it.
+	SetHeaderStore(hs)
+	os.Setenv("QUACKWORD", "new password")
+	if actual, err := Decrypt(after); err != nil || actual != "after" {
+		t.Errorf("secure.Decrypt(%s) returned %s, %v, expected after", after, actual, err)
+	}
+	resigned, _ := Signer{Quackword: "password"}.Sign([]byte("manifest"))
+	if resigned != "" {
+		t.Errorf("signer.Sign() with the old QUACKWORD returned %s, expected an error", resigned)
+	}
+	current, _ := Signer{}.Sign([]byte("manifest"))
+	if err := (Signer{}).Verify([]byte("manifest"), current); err != nil {
+		t.Errorf("signer.Verify() returned error %v", err)
+	}
+	if err := (Signer{}).Verify([]byte("manifest"), signature); err == nil {
+		t.Errorf("signer.Verify() accepted a signature made with the old QUACKWORD")
+	}
+
+	os.Setenv("QUACKWORD", "password")
+	if actual, err := Decrypt(after); err == nil {
+		t.Errorf("secure.Decrypt(%s) returned %s with the old QUACKWORD", after, actual)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	hs := new(memoryHeaderStore)
+	SetHeaderStore(hs)
+	defer SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+
+	Encrypt("a header")
+	AddDataKey("password")
+	old, _ := Encrypt("old")
+	second, _ := AddDataKey("password")
+
+	// Entries written with the older key are readable until it's dropped.
+	if actual, err := Decrypt(old); err != nil || actual != "old" {
+		t.Errorf("secure.Decrypt(%s) returned %s, %v, expected old", old, actual, err)
+	}
+	if EncryptedWith(old, second) {
+		t.Errorf("secure.EncryptedWith(%s, %x) returned true, expected false", old, second)
+	}
+
+	Rewrap(second, "password", "password")
+	if actual, err := Decrypt(old); err == nil {
+		t.Errorf("secure.Decrypt(%s) returned %s after its data key was dropped", old, actual)
+	}
+}
+
+func TestEncryptStandalone(t *testing.T) {
+	hs := new(memoryHeaderStore)
+	SetHeaderStore(hs)
+	os.Setenv("QUACKWORD", "password")
+	Encrypt("a header")
+	AddDataKey("password")
+
+	encrypted, err := EncryptStandalone("backup", []byte("archive"))
+	if err != nil {
+		t.Fatalf("secure.EncryptStandalone() returned error %v", err)
+	}
+
+	// It doesn't need the journal header or its data key to be read.
+	SetHeaderStore(new(memoryHeaderStore))
+	defer SetHeaderStore(nil)
+	if actual, err := DecryptWithAD(encrypted, []byte("archive")); err != nil || actual != "backup" {
+		t.Errorf("secure.DecryptWithAD(%s) returned %s, %v, expected backup", encrypted, actual, err)
+	}
+}
+
+func TestDecryptWithHeader(t *testing.T) {
+	other := new(memoryHeaderStore)
+	SetHeaderStore(other)
+	defer SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+	Encrypt("a header")
+	AddDataKey("password")
+	encrypted, _ := EncryptWithAD("from another journal", []byte("ad"))
+
+	SetHeaderStore(new(memoryHeaderStore))
+	if actual, err := DecryptWithAD(encrypted, []byte("ad")); err == nil {
+		t.Errorf("secure.DecryptWithAD(%s) returned %s without the journal's data key", encrypted, actual)
+	}
+
+	actual, err := DecryptWithHeader(encrypted, other.data, []byte("ad"))
+	if err != nil || actual != "from another journal" {
+		t.Errorf("secure.DecryptWithHeader(%s) returned %s, %v, expected from another journal", encrypted, actual, err)
+	}
+}
+
+// versionedHeaderStore is a memoryHeaderStore that counts versions, and can
+// let someone else write the header just before it is next saved
+type versionedHeaderStore struct {
+	memoryHeaderStore
+	version   int
+	interfere func(*versionedHeaderStore)
+}
+
+func (m *versionedHeaderStore) WriteHeader(data []byte) error {
+	m.data = data
+	m.version++
+	return nil
+}
+
+func (m *versionedHeaderStore) ReadHeaderVersion() ([]byte, string, error) {
+	if m.data == nil {
+		return nil, "", nil
+	}
+
+	return m.data, strconv.Itoa(m.version), nil
+}
+
+func (m *versionedHeaderStore) WriteHeaderIf(data []byte, version string) error {
+	if interfere := m.interfere; interfere != nil {
+		m.interfere = nil
+		interfere(m)
+	}
+
+	if m.data != nil && version != strconv.Itoa(m.version) || m.data == nil && version != "" {
+		return ErrHeaderChanged
+	}
+
+	return m.WriteHeader(data)
+}
+
+func TestAddDataKeyKeepsOthers(t *testing.T) {
+	hs := new(versionedHeaderStore)
+	SetHeaderStore(hs)
+	defer SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+
+	first, _ := AddDataKey("password")
+
+	// Another machine adds a data key of its own, and the header saved
+	// here is now stale.
+	var other []byte
+	hs.interfere = func(m *versionedHeaderStore) {
+		h, _ := ParseHeader(m.data)
+		other = []byte("another machine")
+		dk, _ := h.wrap(other[:keyIDSize], make([]byte, keySize), "password")
+		h.Keys = append([]DataKey{dk}, h.Keys...)
+		data, _ := h.Marshal()
+		m.WriteHeader(data)
+	}
+
+	second, err := AddDataKey("password")
+	if err != nil {
+		t.Fatalf("secure.AddDataKey() returned error %v", err)
+	}
+
+	h, _ := ParseHeader(hs.data)
+	var ids []string
+	for _, dk := range h.Keys {
+		ids = append(ids, string(dk.ID))
+	}
+	expected := []string{string(second), string(other[:keyIDSize]), string(first)}
+	if strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Errorf("secure.AddDataKey() left data keys %q, expected %q", ids, expected)
+	}
+
+	// Rewrap won't drop keys from under a current key it didn't expect.
+	if err := Rewrap(first, "password", "new password"); err != ErrHeaderChanged {
+		t.Errorf("secure.Rewrap() of a superseded key returned %v, expected %v", err, ErrHeaderChanged)
+	}
+}
@@ -0,0 +1,193 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Envelope versions
+const (
+	// VersionLegacy is a bare nonce and ciphertext with no envelope
+	VersionLegacy = 0
+	// VersionEnvelope is the first self-describing envelope
+	VersionEnvelope = 1
+	// VersionBound also authenticates caller-supplied additional data, such
+	// as the entry's key and creation time
+	VersionBound = 2
+)
+
+// Cipher IDs
+const (
+	CipherAESGCM = 1
+)
+
+// KDF IDs
+const (
+	KDFLegacyMD5 = 0
+	KDFArgon2id  = 1
+	// KDFDataKey marks entries encrypted with one of the journal's data
+	// keys, named by the envelope's key ID, rather than a derived key
+	KDFDataKey = 2
+)
+
+const keyIDSize = 8
+
+var envelopeMagic = []byte("QK")
+
+var errNotEnvelope = errors.New("not a versioned envelope")
+
+// Envelope describes how an entry was encrypted. Everything in it except the
+// nonce and ciphertext is authenticated as additional data.
+type Envelope struct {
+	Version   byte
+	Cipher    byte
+	KDF       byte
+	KDFParams []byte
+	KeyID     []byte
+
+	nonce      []byte
+	ciphertext []byte
+}
+
+// ParseEnvelope reads the envelope of an encrypted entry. Entries written
+// before envelopes existed are reported as VersionLegacy.
+func ParseEnvelope(msg string) (Envelope, error) {
+	decoded, err := decodeBase64(msg)
+	if err != nil {
+		return Envelope{}, errors.New(unableToDecryptError)
+	}
+
+	env, err := parseEnvelope(decoded)
+	if err != nil {
+		return Envelope{Version: VersionLegacy, Cipher: CipherAESGCM, KDF: KDFLegacyMD5}, nil
+	}
+
+	return env, nil
+}
+
+// Legacy reports whether the entry predates versioned envelopes.
+func (e Envelope) Legacy() bool {
+	return e.Version == VersionLegacy
+}
+
+// additionalData returns everything GCM should authenticate: the envelope
+// header, plus the caller's additional data from VersionBound on.
+func (e Envelope) additionalData(extra []byte) []byte {
+	ad := e.header()
+	if e.Version >= VersionBound {
+		ad = append(ad, extra...)
+	}
+
+	return ad
+}
+
+// header returns the authenticated portion of the envelope.
+func (e Envelope) header() []byte {
+	var buf bytes.Buffer
+	buf.Write(envelopeMagic)
+	buf.WriteByte(e.Version)
+	buf.WriteByte(e.Cipher)
+	buf.WriteByte(e.KDF)
+	buf.WriteByte(byte(len(e.KDFParams)))
+	buf.Write(e.KDFParams)
+	buf.WriteByte(byte(len(e.KeyID)))
+	buf.Write(e.KeyID)
+
+	return buf.Bytes()
+}
+
+func (e Envelope) marshal() []byte {
+	out := e.header()
+	out = append(out, e.nonce...)
+
+	return append(out, e.ciphertext...)
+}
+
+func parseEnvelope(data []byte) (Envelope, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return Envelope{}, errNotEnvelope
+	}
+	r := bytes.NewReader(data[len(envelopeMagic):])
+
+	var e Envelope
+	fixed := make([]byte, 3)
+	if _, err := r.Read(fixed); err != nil {
+		return Envelope{}, errNotEnvelope
+	}
+	e.Version, e.Cipher, e.KDF = fixed[0], fixed[1], fixed[2]
+
+	if e.Version < VersionEnvelope || e.Version > VersionBound || e.Cipher != CipherAESGCM {
+		return Envelope{}, errNotEnvelope
+	}
+
+	var err error
+	if e.KDFParams, err = readField(r); err != nil {
+		return Envelope{}, err
+	}
+
+	if e.KeyID, err = readField(r); err != nil {
+		return Envelope{}, err
+	}
+
+	rest := data[len(data)-r.Len():]
+	if len(rest) < gcmNonceSize {
+		return Envelope{}, errNotEnvelope
+	}
+	e.nonce, e.ciphertext = rest[:gcmNonceSize], rest[gcmNonceSize:]
+
+	return e, nil
+}
+
+func readField(r *bytes.Reader) ([]byte, error) {
+	n, err := r.ReadByte()
+	if err != nil || int(n) > r.Len() {
+		return nil, errNotEnvelope
+	}
+
+	field := make([]byte, n)
+	_, err = r.Read(field)
+	if err != nil && n > 0 {
+		return nil, errNotEnvelope
+	}
+
+	return field, nil
+}
+
+// params encodes the header's cost parameters and salt for an envelope.
+func (h *Header) params() []byte {
+	out := make([]byte, 9, 9+len(h.Salt))
+	binary.BigEndian.PutUint32(out[0:4], h.Time)
+	binary.BigEndian.PutUint32(out[4:8], h.Memory)
+	out[8] = h.Threads
+
+	return append(out, h.Salt...)
+}
+
+// keyID identifies the key derived from this header without revealing it.
+func (h *Header) keyID() []byte {
+	sum := sha256.Sum256(append([]byte(h.KDF), h.params()...))
+
+	return sum[:keyIDSize]
+}
+
+// headerFromEnvelope rebuilds the key derivation settings an entry was
+// encrypted with.
+func headerFromEnvelope(e Envelope) (*Header, error) {
+	if e.KDF != KDFArgon2id || len(e.KDFParams) < 9 {
+		return nil, fmt.Errorf("unsupported key derivation function %d", e.KDF)
+	}
+
+	h := &Header{
+		Version: headerVersion,
+		KDF:     kdfArgon2id,
+		Time:    binary.BigEndian.Uint32(e.KDFParams[0:4]),
+		Memory:  binary.BigEndian.Uint32(e.KDFParams[4:8]),
+		Threads: e.KDFParams[8],
+		Salt:    e.KDFParams[9:],
+	}
+
+	return h, h.validate()
+}
@@ -0,0 +1,111 @@
+package secure
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+	encrypted, _ := Encrypt("foo")
+	h, _ := currentHeader()
+
+	tests := []struct {
+		msg     string
+		version byte
+		kdf     byte
+		keyID   []byte
+	}{
+		{
+			msg:     encrypted,
+			version: VersionBound,
+			kdf:     KDFArgon2id,
+			keyID:   h.keyID(),
+		},
+		{
+			msg:     "7ruS7L8Ksk8bHCtpWp1+OOJ0N9z92Xr5fFUJHARiTWwXpQwaJ6iBLQ==",
+			version: VersionLegacy,
+			kdf:     KDFLegacyMD5,
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+
+		env, err := ParseEnvelope(test.msg)
+		if err != nil {
+			t.Fatalf("secure.ParseEnvelope(%s) returned error %v", test.msg, err)
+		}
+
+		if env.Version != test.version || env.KDF != test.kdf || !bytes.Equal(env.KeyID, test.keyID) {
+			t.Errorf(
+				"secure.ParseEnvelope(%s) returned version %d, kdf %d, key %x, expected %d, %d, %x",
+				test.msg,
+				env.Version,
+				env.KDF,
+				env.KeyID,
+				test.version,
+				test.kdf,
+				test.keyID,
+			)
+		}
+	}
+}
+
+func TestEnvelopeTampering(t *testing.T) {
+	SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+	encrypted, _ := Encrypt("foo")
+	decoded, _ := decodeBase64(encrypted)
+
+	// The key ID plays no part in deriving the key, but is authenticated.
+	env, _ := parseEnvelope(decoded)
+	env.KeyID[0] ^= 0xff
+	tampered := encodeBase64(env.marshal())
+
+	if actual, err := Decrypt(tampered); err == nil {
+		t.Errorf("secure.Decrypt() accepted a tampered envelope and returned %s", actual)
+	}
+}
+
+func TestDecryptWithoutHeader(t *testing.T) {
+	SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+	encrypted, _ := Encrypt("foo")
+
+	// Versioned entries carry their own KDF parameters, so a journal whose
+	// header went missing can still be read.
+	SetHeaderStore(new(memoryHeaderStore))
+	defer SetHeaderStore(nil)
+
+	actual, err := Decrypt(encrypted)
+	if err != nil || actual != "foo" {
+		t.Errorf("secure.Decrypt(%s) returned %s, %v, expected foo", encrypted, actual, err)
+	}
+}
+
+func TestAdditionalData(t *testing.T) {
+	SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+	encrypted, _ := EncryptWithAD("foo", []byte("key\ncreated"))
+
+	tests := []struct {
+		additionalData []byte
+		expectedErr    bool
+	}{
+		{additionalData: []byte("key\ncreated")},
+		{additionalData: []byte("key\nsome other time"), expectedErr: true},
+		{additionalData: nil, expectedErr: true},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+
+		actual, err := DecryptWithAD(encrypted, test.additionalData)
+		if test.expectedErr != (err != nil) || (err == nil && actual != "foo") {
+			t.Errorf("secure.DecryptWithAD(%s, %s) returned %s, %v", encrypted, test.additionalData, actual, err)
+		}
+	}
+}
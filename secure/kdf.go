@@ -0,0 +1,275 @@
+package secure
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	headerVersion = 1
+	kdfArgon2id   = "argon2id"
+	saltSize      = 16
+	keySize       = 32
+
+	defaultKDFTime    = 1
+	defaultKDFMemory  = 64 * 1024
+	defaultKDFThreads = 4
+
+	// Limits stop a tampered header or envelope from demanding absurd work.
+	maxKDFTime   = 64
+	maxKDFMemory = 1 << 20
+
+	invalidHeaderError = "Unable to read journal header."
+)
+
+// Header holds the salt and cost parameters used to turn the QUACKWORD into
+// an encryption key. One header is kept next to the entries of each journal.
+type Header struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	// Keys holds the journal's data keys, the one new entries are
+	// encrypted with first. Journals without any encrypt entries with a key
+	// derived from the QUACKWORD and the salt above.
+	Keys []DataKey `json:"keys,omitempty"`
+}
+
+// HeaderStore persists the journal header alongside the entries.
+// ReadHeader should return nil bytes and a nil error if no header exists yet.
+type HeaderStore interface {
+	ReadHeader() ([]byte, error)
+	WriteHeader([]byte) error
+}
+
+// VersionedHeaderStore is a HeaderStore that can save the header only if it
+// is still the version that was read, so that data keys added elsewhere in
+// the meantime aren't lost. The version of a journal without a header is
+// empty. WriteHeaderIf returns ErrHeaderChanged if the version has moved on.
+type VersionedHeaderStore interface {
+	HeaderStore
+	ReadHeaderVersion() ([]byte, string, error)
+	WriteHeaderIf(header []byte, version string) error
+}
+
+// ErrHeaderChanged is returned when the journal header was changed by
+// someone else since it was read
+var ErrHeaderChanged = errors.New("journal header was changed since it was read")
+
+var (
+	headerMu    sync.Mutex
+	headerStore HeaderStore
+	header      *Header
+
+	keysMu sync.Mutex
+	keys   = map[string][]byte{}
+)
+
+// SetHeaderStore sets where the journal header is loaded from and saved to.
+// Without a store, a header is generated and kept in memory for the life of
+// the process.
+func SetHeaderStore(hs HeaderStore) {
+	headerMu.Lock()
+	defer headerMu.Unlock()
+
+	headerStore = hs
+	header = nil
+}
+
+// NewHeader creates a header with a random salt. Cost parameters default to
+// Argon2id recommendations and can be tuned with QUACK_KDF_TIME,
+// QUACK_KDF_MEMORY (in KiB) and QUACK_KDF_THREADS.
+func NewHeader() (*Header, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	h := &Header{
+		Version: headerVersion,
+		KDF:     kdfArgon2id,
+		Salt:    salt,
+		Time:    defaultKDFTime,
+		Memory:  defaultKDFMemory,
+		Threads: defaultKDFThreads,
+	}
+
+	if v, ok, err := envUint("QUACK_KDF_TIME", 32); err != nil {
+		return nil, err
+	} else if ok {
+		h.Time = uint32(v)
+	}
+
+	if v, ok, err := envUint("QUACK_KDF_MEMORY", 32); err != nil {
+		return nil, err
+	} else if ok {
+		h.Memory = uint32(v)
+	}
+
+	if v, ok, err := envUint("QUACK_KDF_THREADS", 8); err != nil {
+		return nil, err
+	} else if ok {
+		h.Threads = uint8(v)
+	}
+
+	return h, h.validate()
+}
+
+// ParseHeader decodes a header previously written by Marshal.
+func ParseHeader(data []byte) (*Header, error) {
+	h := new(Header)
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, errors.New(invalidHeaderError)
+	}
+
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Marshal encodes the header for storage.
+func (h *Header) Marshal() ([]byte, error) {
+	return json.Marshal(h)
+}
+
+func (h *Header) validate() error {
+	if h.KDF != kdfArgon2id {
+		return fmt.Errorf("unsupported key derivation function %q", h.KDF)
+	}
+
+	if len(h.Salt) < saltSize {
+		return errors.New("journal header salt is too short")
+	}
+
+	if h.Time < 1 || h.Memory < 8*uint32(h.Threads) || h.Threads < 1 {
+		return errors.New("journal header has invalid cost parameters")
+	}
+
+	if h.Time > maxKDFTime || h.Memory > maxKDFMemory {
+		return errors.New("journal header cost parameters are too high")
+	}
+
+	for _, dk := range h.Keys {
+		if len(dk.ID) != keyIDSize || len(dk.Salt) < saltSize {
+			return errors.New("journal header has an invalid data key")
+		}
+	}
+
+	return nil
+}
+
+// deriveKey stretches the quackword into an AES-256 key. Derivation is
+// deliberately slow, so keys are cached for the life of the process.
+func (h *Header) deriveKey(quackword string) []byte {
+	id := fmt.Sprintf("%s:%x:%d:%d:%d:%s", h.KDF, h.Salt, h.Time, h.Memory, h.Threads, quackword)
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	if key, ok := keys[id]; ok {
+		return key
+	}
+
+	key := argon2.IDKey([]byte(quackword), h.Salt, h.Time, h.Memory, h.Threads, keySize)
+	keys[id] = key
+
+	return key
+}
+
+// currentHeader returns the journal header, loading it from the header store
+// or creating and saving a new one if the journal has none.
+func currentHeader() (*Header, error) {
+	h, err := storedHeader()
+	if err != nil || h != nil {
+		return h, err
+	}
+
+	headerMu.Lock()
+	defer headerMu.Unlock()
+
+	if header != nil {
+		return header, nil
+	}
+
+	h, err = NewHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if headerStore != nil {
+		data, err := h.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := headerStore.WriteHeader(data); err != nil {
+			return nil, err
+		}
+	}
+	header = h
+
+	return h, nil
+}
+
+// storedHeader returns the journal header, or nil if the journal has none.
+func storedHeader() (*Header, error) {
+	headerMu.Lock()
+	defer headerMu.Unlock()
+
+	if header != nil || headerStore == nil {
+		return header, nil
+	}
+
+	data, err := headerStore.ReadHeader()
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	header = h
+
+	return h, nil
+}
+
+func envUint(name string, bits int) (uint64, bool, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0, false, nil
+	}
+
+	v, err := strconv.ParseUint(raw, 10, bits)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s must be a positive integer", name)
+	}
+
+	return v, true, nil
+}
+
+// createHash derives the legacy key: the hex-encoded, unsalted MD5 digest of
+// the quackword. It is only used to read entries written before headers.
+func createHash(key string) (string, error) {
+	hasher := md5.New()
+	_, err := hasher.Write([]byte(key))
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
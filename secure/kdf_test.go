@@ -0,0 +1,151 @@
+package secure
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+type memoryHeaderStore struct {
+	data []byte
+}
+
+func (m *memoryHeaderStore) ReadHeader() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *memoryHeaderStore) WriteHeader(data []byte) error {
+	m.data = data
+	return nil
+}
+
+func TestNewHeader(t *testing.T) {
+	tests := []struct {
+		env         map[string]string
+		expectedErr bool
+		time        uint32
+		memory      uint32
+	}{
+		{
+			env:    map[string]string{},
+			time:   defaultKDFTime,
+			memory: defaultKDFMemory,
+		},
+		{
+			env:    map[string]string{"QUACK_KDF_TIME": "3", "QUACK_KDF_MEMORY": "1024"},
+			time:   3,
+			memory: 1024,
+		},
+		{
+			env:         map[string]string{"QUACK_KDF_TIME": "lots"},
+			expectedErr: true,
+		},
+		{
+			env:         map[string]string{"QUACK_KDF_MEMORY": "4294967295"},
+			expectedErr: true,
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		for k, v := range test.env {
+			os.Setenv(k, v)
+		}
+
+		h, err := NewHeader()
+
+		for k := range test.env {
+			os.Unsetenv(k)
+		}
+
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("secure.NewHeader() with %v returned no error", test.env)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("secure.NewHeader() with %v returned error %v", test.env, err)
+		}
+
+		if h.Time != test.time || h.Memory != test.memory {
+			t.Errorf("secure.NewHeader() with %v returned time %d and memory %d, expected %d and %d", test.env, h.Time, h.Memory, test.time, test.memory)
+		}
+	}
+}
+
+func TestHeaderSalt(t *testing.T) {
+	a, _ := NewHeader()
+	b, _ := NewHeader()
+
+	if bytes.Equal(a.Salt, b.Salt) {
+		t.Errorf("secure.NewHeader() returned the same salt twice")
+	}
+
+	if bytes.Equal(a.deriveKey("password"), b.deriveKey("password")) {
+		t.Errorf("header.deriveKey() returned the same key for different salts")
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	h, _ := NewHeader()
+	data, _ := h.Marshal()
+
+	parsed, err := ParseHeader(data)
+	if err != nil {
+		t.Fatalf("secure.ParseHeader(%s) returned error %v", data, err)
+	}
+
+	if !bytes.Equal(parsed.Salt, h.Salt) {
+		t.Errorf("secure.ParseHeader(%s) returned salt %x, expected %x", data, parsed.Salt, h.Salt)
+	}
+
+	if _, err := ParseHeader([]byte(`{"kdf": "md5"}`)); err == nil {
+		t.Errorf("secure.ParseHeader() accepted an unsupported kdf")
+	}
+}
+
+func TestHeaderStore(t *testing.T) {
+	hs := new(memoryHeaderStore)
+	SetHeaderStore(hs)
+	defer SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+
+	encrypted, err := Encrypt("foo")
+	if err != nil {
+		t.Fatalf("secure.Encrypt(foo) returned error %v", err)
+	}
+
+	if hs.data == nil {
+		t.Fatalf("secure.Encrypt(foo) did not save a journal header")
+	}
+
+	// A fresh process should pick the saved header back up.
+	SetHeaderStore(hs)
+	actual, _ := Decrypt(encrypted)
+	if actual != "foo" {
+		t.Errorf("secure.Decrypt(%s) returned %s, expected foo", encrypted, actual)
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	SetHeaderStore(new(memoryHeaderStore))
+	defer SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+
+	legacy := "7ruS7L8Ksk8bHCtpWp1+OOJ0N9z92Xr5fFUJHARiTWwXpQwaJ6iBLQ=="
+	expected := "Hello World!"
+
+	// Decrypt with and without a header present.
+	for i := 0; i < 2; i++ {
+		actual, err := Decrypt(legacy)
+		if err != nil || actual != expected {
+			t.Errorf("secure.Decrypt(%s) returned %s, %v, expected %s", legacy, actual, err, expected)
+		}
+
+		if _, err := Encrypt("write a header"); err != nil {
+			t.Fatalf("secure.Encrypt() returned error %v", err)
+		}
+	}
+}
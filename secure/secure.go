@@ -3,15 +3,16 @@ package secure
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/md5"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/hex"
 	"errors"
 	"io"
 	"os"
+	"strings"
 )
 
+const gcmNonceSize = 12
+
 const (
 	setQuackwordError    = "Please set QUACKWORD environment variable with `export QUACKWORD=securepassword`."
 	unableToDecryptError = "Failed to retrieve entries. Make sure your QUACKWORD environment variable is correct."
@@ -29,12 +30,18 @@ func getQuackword() (string, error) {
 
 // Decrypt reads a previously encrypted entry
 func Decrypt(msg string) (string, error) {
+	return DecryptWithAD(msg, nil)
+}
+
+// DecryptWithAD reads an entry that was encrypted with EncryptWithAD. The
+// additional data must match what it was encrypted with.
+func DecryptWithAD(msg string, additionalData []byte) (string, error) {
 	quackword, err := getQuackword()
 	if err != nil {
 		return "", err
 	}
 
-	decrypted, err := decrypt(msg, quackword)
+	decrypted, err := decrypt(msg, quackword, additionalData)
 	if err != nil {
 		return "", errors.New(unableToDecryptError)
 	}
@@ -44,22 +51,41 @@ func Decrypt(msg string) (string, error) {
 
 // Encrypt encrypts an entry with the quackword
 func Encrypt(msg string) (string, error) {
+	return EncryptWithAD(msg, nil)
+}
+
+// DecryptWithHeader reads an entry encrypted under another journal's header,
+// such as one in a backup, rather than this journal's
+func DecryptWithHeader(msg string, header []byte, additionalData []byte) (string, error) {
 	quackword, err := getQuackword()
 	if err != nil {
 		return "", err
 	}
 
-	encrypted, err := encrypt(msg, quackword)
+	var h *Header
+	if header != nil {
+		if h, err = ParseHeader(header); err != nil {
+			return "", err
+		}
+	}
+
+	decrypted, err := decryptWith(func() (*Header, error) { return h, nil }, msg, quackword, additionalData)
 	if err != nil {
-		return "", errors.New(unableToEncryptError)
+		return "", errors.New(unableToDecryptError)
 	}
 
-	return encrypted, nil
+	return decrypted, nil
 }
 
-// EncryptWithNewQuackword encrypts an entry with a passed in quackword
-func EncryptWithNewQuackword(msg string, quackword string) (string, error) {
-	encrypted, err := encrypt(msg, quackword)
+// EncryptWithAD encrypts an entry with the quackword and authenticates, but
+// does not encrypt, the additional data along with it
+func EncryptWithAD(msg string, additionalData []byte) (string, error) {
+	quackword, err := getQuackword()
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := encrypt(msg, quackword, additionalData)
 	if err != nil {
 		return "", errors.New(unableToEncryptError)
 	}
@@ -67,76 +93,188 @@ func EncryptWithNewQuackword(msg string, quackword string) (string, error) {
 	return encrypted, nil
 }
 
-func decrypt(data, quackword string) (string, error) {
-	decoded := decodeBase64(data)
-	hash, err := createHash(quackword)
+// EncryptStandalone encrypts msg with a key derived from the QUACKWORD and a
+// fresh salt, which the envelope records, so it can be decrypted with
+// DecryptWithAD without the journal header, e.g. in a backup of the journal
+func EncryptStandalone(msg string, additionalData []byte) (string, error) {
+	quackword, err := getQuackword()
 	if err != nil {
 		return "", err
 	}
-	key := []byte(hash)
 
-	block, err := aes.NewCipher(key)
+	h, err := NewHeader()
 	if err != nil {
 		return "", err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	env := Envelope{
+		Version:   VersionBound,
+		Cipher:    CipherAESGCM,
+		KDF:       KDFArgon2id,
+		KDFParams: h.params(),
+		KeyID:     h.keyID(),
+	}
+
+	encrypted, err := seal(h.deriveKey(quackword), env, msg, additionalData)
+	if err != nil {
+		return "", errors.New(unableToEncryptError)
+	}
+
+	return encrypted, nil
+}
+
+func decrypt(data, quackword string, additionalData []byte) (string, error) {
+	return decryptWith(storedHeader, data, quackword, additionalData)
+}
+
+// decryptWith decrypts data, looking up the journal header with header only
+// if the entry needs it
+func decryptWith(header func() (*Header, error), data, quackword string, additionalData []byte) (string, error) {
+	decoded, err := decodeBase64(data)
 	if err != nil {
 		return "", err
 	}
 
-	nonceSize := gcm.NonceSize()
-	nonce, ciphertext := decoded[:nonceSize], decoded[nonceSize:]
-	plaintext, err := gcm.Open(nil, []byte(nonce), []byte(ciphertext), nil)
+	if env, err := parseEnvelope(decoded); err == nil {
+		plaintext, err := openEnvelope(header, env, quackword, additionalData)
+		if err == nil {
+			return plaintext, nil
+		}
+		// An unversioned entry can start with the envelope magic by chance,
+		// so fall through and try it as version 0.
+	}
+
+	return decryptLegacy(header, decoded, quackword)
+}
+
+func openEnvelope(header func() (*Header, error), env Envelope, quackword string, additionalData []byte) (string, error) {
+	if env.KDF == KDFDataKey {
+		h, err := header()
+		if err != nil || h == nil {
+			return "", errors.New(unknownDataKeyError)
+		}
+
+		key, err := h.dataKey(env.KeyID, quackword)
+		if err != nil {
+			return "", err
+		}
+
+		return open(key, env.nonce, env.ciphertext, env.additionalData(additionalData))
+	}
+
+	h, err := headerFromEnvelope(env)
 	if err != nil {
 		return "", err
 	}
 
-	return string(plaintext), nil
+	return open(h.deriveKey(quackword), env.nonce, env.ciphertext, env.additionalData(additionalData))
 }
 
-func encrypt(msg, quackword string) (string, error) {
-	hash, err := createHash(quackword)
+// decryptLegacy reads version 0 entries, which are a bare nonce and
+// ciphertext encrypted with either the journal header's key or the MD5 key.
+func decryptLegacy(header func() (*Header, error), decoded []byte, quackword string) (string, error) {
+	if len(decoded) < gcmNonceSize {
+		return "", errors.New(unableToDecryptError)
+	}
+	nonce, ciphertext := decoded[:gcmNonceSize], decoded[gcmNonceSize:]
+
+	h, err := header()
 	if err != nil {
 		return "", err
 	}
-	key := []byte(hash)
-	block, _ := aes.NewCipher(key)
 
-	gcm, err := cipher.NewGCM(block)
+	if h != nil {
+		plaintext, err := open(h.deriveKey(quackword), nonce, ciphertext, nil)
+		if err == nil {
+			return plaintext, nil
+		}
+	}
+
+	hash, err := createHash(quackword)
 	if err != nil {
 		return "", err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+	return open([]byte(hash), nonce, ciphertext, nil)
+}
+
+func encrypt(msg, quackword string, additionalData []byte) (string, error) {
+	h, err := currentHeader()
+	if err != nil {
 		return "", err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(msg), nil)
-	cipherString := encodeBase64(ciphertext)
+	if len(h.Keys) > 0 {
+		key, err := h.unwrap(h.Keys[0], quackword)
+		if err != nil {
+			return "", err
+		}
 
-	return cipherString, nil
+		env := Envelope{
+			Version: VersionBound,
+			Cipher:  CipherAESGCM,
+			KDF:     KDFDataKey,
+			KeyID:   h.Keys[0].ID,
+		}
+
+		return seal(key, env, msg, additionalData)
+	}
+
+	env := Envelope{
+		Version:   VersionBound,
+		Cipher:    CipherAESGCM,
+		KDF:       KDFArgon2id,
+		KDFParams: h.params(),
+		KeyID:     h.keyID(),
+	}
+
+	return seal(h.deriveKey(quackword), env, msg, additionalData)
 }
 
-func encodeBase64(b []byte) string {
-	return base64.StdEncoding.EncodeToString(b)
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
 }
 
-func decodeBase64(s string) []byte {
-	data, err := base64.StdEncoding.DecodeString(s)
+func open(key, nonce, ciphertext, additionalData []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return data
+
+	return string(plaintext), nil
 }
 
-func createHash(key string) (string, error) {
-	hasher := md5.New()
-	_, err := hasher.Write([]byte(key))
+func seal(key []byte, env Envelope, msg string, additionalData []byte) (string, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return "", err
 	}
 
-	return hex.EncodeToString(hasher.Sum(nil)), nil
+	env.nonce = make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, env.nonce); err != nil {
+		return "", err
+	}
+
+	env.ciphertext = gcm.Seal(nil, env.nonce, []byte(msg), env.additionalData(additionalData))
+	cipherString := encodeBase64(env.marshal())
+
+	return cipherString, nil
+}
+
+func encodeBase64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(s))
 }
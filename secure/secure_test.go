@@ -14,7 +14,7 @@ func TestEncrypt(t *testing.T) {
 		{
 			input:       "foo",
 			quackword:   "exists",
-			expectedLen: 44,
+			expectedLen: 96,
 		},
 		{
 			input:       "foo",
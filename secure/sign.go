@@ -0,0 +1,96 @@
+package secure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	signingLabel          = "quack manifest v1"
+	invalidSignatureError = "Journal manifest signature is invalid. It may have been tampered with, or signed with a different QUACKWORD."
+)
+
+// Signer signs journal metadata with a key derived from the QUACKWORD, so it
+// cannot be forged by anyone with only bucket access
+type Signer struct {
+	// Quackword overrides the QUACKWORD environment variable, e.g. while
+	// the QUACKWORD is being reset
+	Quackword string
+}
+
+// Sign returns a hex-encoded MAC of data
+func (s Signer) Sign(data []byte) (string, error) {
+	keys, err := s.keys()
+	if err != nil {
+		return "", err
+	}
+
+	return sign(keys[0], data), nil
+}
+
+// Verify checks a signature made by Sign, with any of the journal's keys
+func (s Signer) Verify(data []byte, signature string) error {
+	keys, err := s.keys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if hmac.Equal([]byte(sign(key, data)), []byte(signature)) {
+			return nil
+		}
+	}
+
+	return errors.New(invalidSignatureError)
+}
+
+func sign(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// keys derives signing keys that are separate from the encryption keys: one
+// from each of the journal's data keys, current first, then one from the
+// QUACKWORD itself, which signed manifests before the journal had data keys
+func (s Signer) keys() ([][]byte, error) {
+	quackword := s.Quackword
+	if quackword == "" {
+		var err error
+		quackword, err = getQuackword()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h, err := currentHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][]byte
+	for i, dk := range h.Keys {
+		// An older key merged in by sync may still be wrapped with an older
+		// QUACKWORD. Only the current key must unwrap.
+		key, err := h.unwrap(dk, quackword)
+		if err != nil && i > 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, signingKey(key))
+	}
+
+	return append(keys, signingKey(h.deriveKey(quackword))), nil
+}
+
+func signingKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingLabel))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,56 @@
+package secure
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	SetHeaderStore(nil)
+	os.Setenv("QUACKWORD", "password")
+	data := []byte("manifest")
+
+	signature, err := Signer{}.Sign(data)
+	if err != nil {
+		t.Fatalf("signer.Sign(%s) returned error %v", data, err)
+	}
+
+	tests := []struct {
+		signer      Signer
+		data        []byte
+		signature   string
+		expectedErr bool
+	}{
+		{
+			signer:    Signer{},
+			data:      data,
+			signature: signature,
+		},
+		{
+			signer:    Signer{Quackword: "password"},
+			data:      data,
+			signature: signature,
+		},
+		{
+			signer:      Signer{},
+			data:        []byte("manifest with an extra entry"),
+			signature:   signature,
+			expectedErr: true,
+		},
+		{
+			signer:      Signer{Quackword: "not the password"},
+			data:        data,
+			signature:   signature,
+			expectedErr: true,
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+
+		err := test.signer.Verify(test.data, test.signature)
+		if test.expectedErr != (err != nil) {
+			t.Errorf("signer.Verify(%s) returned error %v, expected error: %v", test.data, err, test.expectedErr)
+		}
+	}
+}
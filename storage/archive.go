@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jonathanwthom/quack/secure"
+)
+
+// archiveVersion 1 holds entries' ciphertexts, keys and creation times, and
+// the journal header
+const archiveVersion = 1
+
+// archiveLabel is authenticated with an archive, so nothing else encrypted
+// with the QUACKWORD can pass for one
+var archiveLabel = []byte("quack archive")
+
+// Archive is a portable backup of a journal: its entries as they are stored,
+// still encrypted, along with the journal header needed to decrypt them
+type Archive struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Header is the journal's _quack/header.json, if it has one
+	Header  []byte          `json:"header,omitempty"`
+	Entries []ArchivedEntry `json:"entries"`
+}
+
+// ArchivedEntry is an entry in an Archive
+type ArchivedEntry struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Content is the entry's ciphertext, exactly as stored
+	Content string `json:"content"`
+}
+
+// NewArchive archives entries, which need not be decrypted, and the journal
+// header they were encrypted under
+func NewArchive(entries []Entry, header []byte, at time.Time) Archive {
+	a := Archive{Version: archiveVersion, CreatedAt: at.UTC(), Header: header}
+	for _, entry := range entries {
+		a.Entries = append(a.Entries, ArchivedEntry{
+			Key:       entry.Key,
+			CreatedAt: entry.CreatedAt.UTC(),
+			Content:   entry.Content,
+		})
+	}
+
+	return a
+}
+
+// Seal encrypts the archive as a whole with the QUACKWORD. It can be opened
+// with OpenArchive anywhere the QUACKWORD is set, without the journal.
+func (a Archive) Seal() (string, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+
+	return secure.EncryptStandalone(string(data), archiveLabel)
+}
+
+// OpenArchive decrypts an archive made by Seal
+func OpenArchive(sealed string) (Archive, error) {
+	var a Archive
+	plaintext, err := secure.DecryptWithAD(sealed, archiveLabel)
+	if err != nil {
+		return a, err
+	}
+
+	if err := json.Unmarshal([]byte(plaintext), &a); err != nil {
+		return a, err
+	}
+	if a.Version < 1 || a.Version > archiveVersion {
+		return a, fmt.Errorf("unsupported archive version %d", a.Version)
+	}
+	for _, entry := range a.Entries {
+		if entry.Key == "" || entry.CreatedAt.IsZero() {
+			return a, errors.New("archive has an entry without a key or creation time")
+		}
+	}
+
+	return a, nil
+}
+
+// Entry returns the archived entry, still encrypted
+func (e ArchivedEntry) Entry() Entry {
+	return Entry{Key: e.Key, CreatedAt: e.CreatedAt, Content: e.Content}
+}
+
+// Decrypted returns the archived entries, decrypted with the archive's
+// header and the QUACKWORD
+func (a Archive) Decrypted() ([]Entry, error) {
+	entries := make([]Entry, 0, len(a.Entries))
+	for _, archived := range a.Entries {
+		entry := archived.Entry()
+		if err := entry.DecryptWithHeader(a.Header); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
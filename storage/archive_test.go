@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+
+	entry := NewEntry(time.Now())
+	entry.Encrypt("Hello World!")
+	header := []byte(`{"version":1}`)
+
+	sealed, err := NewArchive([]Entry{entry}, header, time.Now()).Seal()
+	if err != nil {
+		t.Fatalf("archive.Seal() returned error %v", err)
+	}
+
+	a, err := OpenArchive(sealed)
+	if err != nil {
+		t.Fatalf("storage.OpenArchive() returned error %v", err)
+	}
+	if string(a.Header) != string(header) || len(a.Entries) != 1 {
+		t.Fatalf("storage.OpenArchive() returned header %s and %d entries, expected %s and 1", a.Header, len(a.Entries), header)
+	}
+
+	archived := a.Entries[0].Entry()
+	if archived.Key != entry.Key || !archived.CreatedAt.Equal(entry.CreatedAt) || archived.Content != entry.Content {
+		t.Errorf("storage.OpenArchive() returned entry %+v, expected %+v", archived, entry)
+	}
+	if err := archived.SetDecryptedContent(); err != nil || archived.DecryptedContent != "Hello World!" {
+		t.Errorf("archived entry decrypted to %s, %v, expected Hello World!", archived.DecryptedContent, err)
+	}
+
+	os.Setenv("QUACKWORD", "not the password")
+	defer os.Setenv("QUACKWORD", "password")
+	if _, err := OpenArchive(sealed); err == nil {
+		t.Errorf("storage.OpenArchive() opened an archive with the wrong QUACKWORD")
+	}
+}
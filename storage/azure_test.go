@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+type fakeAzureList struct {
+	XMLName       xml.Name `xml:"EnumerationResults"`
+	ContainerName string   `xml:"ContainerName,attr"`
+	Prefix        string
+	MaxResults    int
+	Blobs         []fakeAzureListBlob `xml:"Blobs>Blob"`
+	NextMarker    string
+}
+
+type fakeAzureListBlob struct {
+	Name       string
+	Properties fakeAzureProperties
+}
+
+type fakeAzureProperties struct {
+	LastModified  string `xml:"Last-Modified"`
+	Etag          string
+	ContentLength int `xml:"Content-Length"`
+	BlobType      string
+}
+
+// newFakeAzurite stands in for the Azurite emulator's Blob API, checking that
+// each request is signed with the account's shared key
+func newFakeAzurite(account, key, container string) *fakeServer {
+	credential, _ := azblob.NewSharedKeyCredential(account, key)
+
+	return newFakeServer(fakeDialect{
+		root:           "/" + account + "/" + container + "/",
+		metadataPrefix: "x-ms-meta-",
+		headers:        http.Header{"X-Ms-Blob-Type": {"BlockBlob"}},
+		created:        http.StatusCreated,
+		deleted:        http.StatusAccepted,
+		notFound:       "BlobNotFound",
+		list: func(prefix string, objects []fakeListed) interface{} {
+			result := fakeAzureList{ContainerName: container, Prefix: prefix, MaxResults: 1000}
+			for _, obj := range objects {
+				result.Blobs = append(result.Blobs, fakeAzureListBlob{
+					Name: obj.key,
+					Properties: fakeAzureProperties{
+						LastModified:  obj.modTime.UTC().Format(http.TimeFormat),
+						Etag:          obj.etag(),
+						ContentLength: len(obj.body),
+						BlobType:      "BlockBlob",
+					},
+				})
+			}
+			return result
+		},
+		authorize: func(r *http.Request) error {
+			return checkSharedKey(credential, r)
+		},
+	})
+}
+
+// checkSharedKey signs a copy of r, as received, with credential and makes
+// sure it carries the same Authorization header
+func checkSharedKey(credential *azblob.SharedKeyCredential, r *http.Request) error {
+	got := r.Header.Get("Authorization")
+	if !strings.HasPrefix(got, "SharedKey "+credential.AccountName()+":") {
+		return fmt.Errorf("not signed with a shared key: %q", got)
+	}
+
+	u := *r.URL
+	u.Scheme, u.Host = "http", r.Host
+	signed, err := pipeline.NewRequest(r.Method, u, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range r.Header {
+		signed.Header[name] = values
+	}
+	signed.Header.Del("Authorization")
+
+	noop := pipeline.PolicyFunc(func(context.Context, pipeline.Request) (pipeline.Response, error) {
+		return nil, nil
+	})
+	credential.New(noop, nil).Do(context.Background(), signed)
+	if expected := signed.Header.Get("Authorization"); got != expected {
+		return fmt.Errorf("signature %q doesn't match the request, expected %q", got, expected)
+	}
+
+	return nil
+}
+
+// azuriteKey is the well-known development storage account key.
+const azuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+func TestAzureBackend(t *testing.T) {
+	fake := newFakeAzurite("devstoreaccount1", azuriteKey, "journal")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	testBackend(t, NewAzureBackend(AzureConfig{
+		Account:   "devstoreaccount1",
+		Key:       azuriteKey,
+		Container: "journal",
+		Endpoint:  server.URL + "/devstoreaccount1",
+	}))
+
+	if len(fake.authErrors) > 0 {
+		t.Errorf("requests to the Azure endpoint were not signed for the path it sees: %v", fake.authErrors)
+	}
+}
+
+func TestAzureConditionalDelete(t *testing.T) {
+	for _, prefix := range []string{"", "shared/"} {
+		fake := newFakeAzurite("devstoreaccount1", azuriteKey, "journal")
+		server := httptest.NewServer(fake)
+
+		var backend Backend = NewAzureBackend(AzureConfig{
+			Account:   "devstoreaccount1",
+			Key:       azuriteKey,
+			Container: "journal",
+			Endpoint:  server.URL + "/devstoreaccount1",
+		})
+		if prefix != "" {
+			backend = prefixedBackend{Backend: backend, prefix: prefix}
+		}
+		s := New(backend)
+
+		ctx := context.Background()
+		bucket, err := s.open(ctx)
+		if err != nil {
+			t.Fatalf("storage.open() returned error %v", err)
+		}
+		bucket.WriteAll(ctx, "entry", []byte("mine"), nil)
+		attrs, _ := bucket.Attributes(ctx, "entry")
+		time.Sleep(time.Millisecond)
+		bucket.WriteAll(ctx, "entry", []byte("theirs"), nil)
+
+		if err := deletePinned(ctx, bucket, s.prefix, "entry", attrs); err != ErrConflict {
+			t.Errorf("storage.deletePinned(%q) of a changed blob returned %v, expected %v", prefix, err, ErrConflict)
+		}
+		if _, ok := fake.objects[prefix+"entry"]; !ok {
+			t.Errorf("storage.deletePinned(%q) deleted a blob changed since it was checked", prefix)
+		}
+
+		attrs, _ = bucket.Attributes(ctx, "entry")
+		if err := deletePinned(ctx, bucket, s.prefix, "entry", attrs); err != nil {
+			t.Errorf("storage.deletePinned(%q) of an unchanged blob returned error %v", prefix, err)
+		}
+		if _, ok := fake.objects[prefix+"entry"]; ok {
+			t.Errorf("storage.deletePinned(%q) left the unchanged blob behind", prefix)
+		}
+
+		s.Close()
+		server.Close()
+	}
+}
+
+func TestValidateAzure(t *testing.T) {
+	cfg := Config{Azure: AzureConfig{Container: "journal", Account: "account"}}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "QUACK_AZURE_STORAGE_KEY") {
+		t.Errorf("config.Validate() returned %v, expected a missing key or SAS token", err)
+	}
+
+	cfg.Azure.SASToken = "sv=2019-02-02&sig=abc"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("config.Validate() with a SAS token returned error %v", err)
+	}
+}
+
+// TestAzurite runs against the Azurite emulator when one is available, e.g.
+// `docker run -p 10000:10000 mcr.microsoft.com/azure-storage/azurite
+// azurite-blob --blobHost 0.0.0.0` with a container created and
+// QUACK_TEST_AZURE_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1.
+func TestAzurite(t *testing.T) {
+	endpoint := os.Getenv("QUACK_TEST_AZURE_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("QUACK_TEST_AZURE_ENDPOINT not set")
+	}
+
+	testBackend(t, NewAzureBackend(AzureConfig{
+		Account:   "devstoreaccount1",
+		Key:       azuriteKey,
+		Container: os.Getenv("QUACK_TEST_AZURE_CONTAINER"),
+		Endpoint:  endpoint,
+	}))
+}
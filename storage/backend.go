@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/gcsblob"
+	"gocloud.dev/blob/memblob"
+	"gocloud.dev/gcp"
+	"golang.org/x/oauth2/google"
+)
+
+const gcsScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Backend opens the bucket that a journal's entries are kept in
+type Backend interface {
+	Open(ctx context.Context) (*blob.Bucket, error)
+}
+
+// BackendFunc adapts an ordinary function to the Backend interface
+type BackendFunc func(ctx context.Context) (*blob.Bucket, error)
+
+// Open calls f(ctx)
+func (f BackendFunc) Open(ctx context.Context) (*blob.Bucket, error) {
+	return f(ctx)
+}
+
+// Constructor builds a backend from the storage configuration
+type Constructor func(Config) (Backend, error)
+
+type registration struct {
+	name        string
+	configured  func(Config) bool
+	constructor Constructor
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []registration
+)
+
+// Built-in backend names
+const (
+	URLBackendName    = "url"
+	FileBackendName   = "file"
+	MemoryBackendName = "mem"
+	S3BackendName     = "s3"
+	GCSBackendName    = "gcs"
+	AzureBackendName  = "azblob"
+)
+
+func init() {
+	Register(URLBackendName, func(c Config) bool { return c.BucketURL != "" }, newURLBackendFromConfig)
+	Register(S3BackendName, func(c Config) bool { return c.S3.Bucket != "" }, newS3Backend)
+	Register(GCSBackendName, func(c Config) bool { return c.GCS.Bucket != "" }, newGCSBackend)
+	Register(AzureBackendName, func(c Config) bool { return c.Azure.Container != "" }, newAzureBackend)
+	Register(FileBackendName, nil, newDefaultFileBackend)
+	Register(MemoryBackendName, nil, func(Config) (Backend, error) { return NewMemoryBackend(), nil })
+}
+
+// Register makes a backend available by name. If configured is not nil and
+// reports true for a config, the backend is picked automatically when no
+// backend is named explicitly; backends are checked in the order they were
+// registered. Registering a name again replaces the earlier backend.
+func Register(name string, configured func(Config) bool, constructor Constructor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	reg := registration{name: name, configured: configured, constructor: constructor}
+	for i := range registry {
+		if registry[i].name == name {
+			registry[i] = reg
+			return
+		}
+	}
+
+	registry = append(registry, reg)
+}
+
+// Backends lists the names of all registered backends
+func Backends() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, len(registry))
+	for i, reg := range registry {
+		names[i] = reg.name
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewBackend builds the registered backend with the given name
+func NewBackend(name string, cfg Config) (Backend, error) {
+	registryMu.Lock()
+	var constructor Constructor
+	for _, reg := range registry {
+		if reg.name == name {
+			constructor = reg.constructor
+			break
+		}
+	}
+	registryMu.Unlock()
+
+	if constructor != nil {
+		return constructor(cfg)
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %q, expected one of %s", name, strings.Join(Backends(), ", "))
+}
+
+// SelectBackend validates cfg and builds the backend it names, or else the
+// first backend whose settings are present, falling back to local files. A
+// bucket URL is checked before the per-cloud settings.
+func SelectBackend(cfg Config) (Backend, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return NewBackend(cfg.backendName(), cfg)
+}
+
+// NewFileBackend stores entries as files in dir, creating it if needed
+func NewFileBackend(dir string) Backend {
+	return BackendFunc(func(ctx context.Context) (*blob.Bucket, error) {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, err
+		}
+
+		return fileblob.OpenBucket(dir, nil)
+	})
+}
+
+func newDefaultFileBackend(cfg Config) (Backend, error) {
+	if cfg.Dir != "" {
+		return NewFileBackend(cfg.Dir), nil
+	}
+
+	homeDir, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFileBackend(homeDir + "/.quack"), nil
+}
+
+type memoryBackend struct {
+	once   sync.Once
+	bucket *blob.Bucket
+}
+
+// NewMemoryBackend keeps entries in memory for the life of the process.
+// Every Open returns the same bucket.
+func NewMemoryBackend() Backend {
+	return new(memoryBackend)
+}
+
+func (m *memoryBackend) Open(ctx context.Context) (*blob.Bucket, error) {
+	m.once.Do(func() {
+		m.bucket = memblob.OpenBucket(nil)
+	})
+
+	return m.bucket, nil
+}
+
+// NewURLBackend opens any bucket gocloud.dev has a driver for, such as
+// s3://, gs://, azblob://, file:// or mem:// URLs. Keys are stored under
+// prefix, if one is given, so several journals can share a bucket.
+func NewURLBackend(urlstr, prefix string) (Backend, error) {
+	u, err := url.Parse(urlstr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket URL %q: %v", urlstr, err)
+	}
+
+	if !blob.DefaultURLMux().ValidBucketScheme(u.Scheme) {
+		return nil, fmt.Errorf("unsupported bucket URL scheme %q, expected one of %s",
+			u.Scheme, strings.Join(blob.DefaultURLMux().BucketSchemes(), ", "))
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	backend := BackendFunc(func(ctx context.Context) (*blob.Bucket, error) {
+		return blob.OpenBucket(ctx, urlstr)
+	})
+	if prefix != "" {
+		return prefixedBackend{Backend: backend, prefix: prefix}, nil
+	}
+
+	return backend, nil
+}
+
+// prefixedBackend keeps a journal's keys under prefix in a bucket it may
+// share with others
+type prefixedBackend struct {
+	Backend
+	prefix string
+}
+
+func (b prefixedBackend) Open(ctx context.Context) (*blob.Bucket, error) {
+	bucket, err := b.Backend.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.PrefixedBucket(bucket, b.prefix), nil
+}
+
+func newURLBackendFromConfig(cfg Config) (Backend, error) {
+	return NewURLBackend(cfg.BucketURL, cfg.BucketPrefix)
+}
+
+// NewGCSBackend opens a Google Cloud Storage bucket. A service account key
+// file is used if given, otherwise the default application credentials apply.
+func NewGCSBackend(cfg GCSConfig) Backend {
+	return BackendFunc(func(ctx context.Context) (*blob.Bucket, error) {
+		var creds *google.Credentials
+		var err error
+		if cfg.CredentialsFile != "" {
+			var data []byte
+			data, err = ioutil.ReadFile(cfg.CredentialsFile)
+			if err != nil {
+				return nil, err
+			}
+			creds, err = google.CredentialsFromJSON(ctx, data, gcsScope)
+		} else {
+			creds, err = gcp.DefaultCredentials(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := gcp.NewHTTPClient(gcp.DefaultTransport(), gcp.CredentialsTokenSource(creds))
+		if err != nil {
+			return nil, err
+		}
+
+		return gcsblob.OpenBucket(ctx, client, cfg.Bucket, nil)
+	})
+}
+
+func newGCSBackend(cfg Config) (Backend, error) {
+	return NewGCSBackend(cfg.GCS), nil
+}
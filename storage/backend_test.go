@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gocloud.dev/blob"
+)
+
+func TestSelectBackend(t *testing.T) {
+	custom := NewMemoryBackend()
+	Register("custom", func(Config) bool { return os.Getenv("CUSTOM_BUCKET") != "" }, func(Config) (Backend, error) {
+		return custom, nil
+	})
+
+	tests := []struct {
+		env         map[string]string
+		expected    Backend
+		expectedErr bool
+	}{
+		{
+			env:      map[string]string{"QUACK_BACKEND": "custom"},
+			expected: custom,
+		},
+		{
+			env:      map[string]string{"CUSTOM_BUCKET": "mine"},
+			expected: custom,
+		},
+		{
+			env:         map[string]string{"QUACK_BACKEND": "floppy"},
+			expectedErr: true,
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		for k, v := range test.env {
+			os.Setenv(k, v)
+		}
+
+		actual, err := SelectBackend(LoadConfig(viper.New()))
+
+		for k := range test.env {
+			os.Unsetenv(k)
+		}
+
+		if test.expectedErr != (err != nil) {
+			t.Errorf("storage.SelectBackend() with %v returned error %v", test.env, err)
+		}
+
+		if test.expected != nil && actual != test.expected {
+			t.Errorf("storage.SelectBackend() with %v returned %v, expected %v", test.env, actual, test.expected)
+		}
+	}
+}
+
+func TestBackends(t *testing.T) {
+	names := Backends()
+	for _, expected := range []string{FileBackendName, GCSBackendName, MemoryBackendName, S3BackendName} {
+		found := false
+		for _, name := range names {
+			found = found || name == expected
+		}
+
+		if !found {
+			t.Errorf("storage.Backends() returned %v, missing %s", names, expected)
+		}
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := New(NewFileBackend(dir + "/journal"))
+	s.Create(testEntry("encrypted"))
+	s.Close()
+
+	// Entries should survive reopening the directory.
+	s = New(NewFileBackend(dir + "/journal"))
+	defer s.Close()
+	entries, err := s.Read()
+	if err != nil || len(entries) != 1 {
+		t.Errorf("storage.Read() from file backend returned %v, %v", entries, err)
+	}
+}
+
+func TestBackendFunc(t *testing.T) {
+	opened := 0
+	s := New(BackendFunc(func(ctx context.Context) (*blob.Bucket, error) {
+		opened++
+		return NewMemoryBackend().Open(ctx)
+	}))
+	defer s.Close()
+
+	s.Create(testEntry("one"))
+	s.Create(testEntry("two"))
+	s.Read()
+
+	if opened != 1 {
+		t.Errorf("storage opened its bucket %d times, expected 1", opened)
+	}
+}
+
+func TestURLBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two journals sharing one bucket under different prefixes.
+	alice, err := NewURLBackend("file://"+dir, "alice")
+	if err != nil {
+		t.Fatalf("storage.NewURLBackend() returned error %v", err)
+	}
+	bob, _ := NewURLBackend("file://"+dir+"?prefix=bob/", "")
+
+	a := New(alice)
+	defer a.Close()
+	b := New(bob)
+	defer b.Close()
+
+	a.Create(testEntry("alice's entry"))
+	b.Create(testEntry("bob's entry"))
+	b.Create(testEntry("bob's other entry"))
+
+	aliceEntries, _ := a.Read()
+	bobEntries, _ := b.Read()
+	if len(aliceEntries) != 1 || len(bobEntries) != 2 {
+		t.Errorf("prefixed journals returned %d and %d entries, expected 1 and 2", len(aliceEntries), len(bobEntries))
+	}
+
+	if _, err := NewURLBackend("floppy://a", ""); err == nil {
+		t.Errorf("storage.NewURLBackend(floppy://a) returned no error")
+	}
+}
+
+func TestSelectURLBackend(t *testing.T) {
+	os.Setenv("QUACK_BUCKET_URL", "mem://")
+	// The URL takes priority over the per-cloud settings.
+	os.Setenv("QUACK_S3_BUCKET_NAME", "bucket")
+	defer os.Unsetenv("QUACK_BUCKET_URL")
+	defer os.Unsetenv("QUACK_S3_BUCKET_NAME")
+
+	s := new(Storage)
+	defer s.Close()
+	if err := s.Create(testEntry("encrypted")); err != nil {
+		t.Errorf("storage.Create() with QUACK_BUCKET_URL=mem:// returned error %v", err)
+	}
+}
+
+// testBackend checks that a backend behaves like every other for the CRUD
+// methods Storage offers.
+func testBackend(t *testing.T, backend Backend) {
+	s := New(backend)
+	defer s.Close()
+
+	if err := s.Create(testEntry("first")); err != nil {
+		t.Fatalf("storage.Create() returned error %v", err)
+	}
+	s.Create(testEntry("second"))
+
+	entries, err := s.Read()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("storage.Read() returned %v, %v, expected 2 entries", entries, err)
+	}
+
+	entry, err := s.ReadByKey(entries[0].Key)
+	if err != nil || entry.Content != entries[0].Content {
+		t.Errorf("storage.ReadByKey(%s) returned %v, %v, expected %v", entries[0].Key, entry, err, entries[0])
+	}
+
+	entry = entries[0]
+	entry.Content, entry.DecryptedContent = "updated", "updated"
+	if err := s.Update(entry); err != nil {
+		t.Errorf("storage.Update(%v) returned error %v", entry, err)
+	}
+
+	updated, _ := s.ReadByKey(entry.Key)
+	if updated.Content != "updated\n" {
+		t.Errorf("storage.ReadByKey(%s) returned %s after update, expected updated", entry.Key, updated.Content)
+	}
+
+	if err := s.Delete(entries[1].Key); err != nil {
+		t.Errorf("storage.Delete(%s) returned error %v", entries[1].Key, err)
+	}
+
+	if err := s.WriteHeader([]byte("header")); err != nil {
+		t.Errorf("storage.WriteHeader() returned error %v", err)
+	}
+
+	entries, err = s.Read()
+	if err != nil || len(entries) != 1 || !entries[0].CreatedAt.Equal(entry.CreatedAt) {
+		t.Errorf("storage.Read() returned %v, %v after update and delete", entries, err)
+	}
+
+	if _, err := s.ReadByKey("missing"); err == nil {
+		t.Errorf("storage.ReadByKey(missing) returned no error")
+	}
+}
+
+func TestMemoryBackendCRUD(t *testing.T) {
+	testBackend(t, NewMemoryBackend())
+}
+
+func TestFileBackendCRUD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testBackend(t, NewFileBackend(dir))
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Config holds the settings needed to pick and open a storage backend. Each
+// field is read through viper from the environment variable in its comment,
+// the lowercase key of the same name in ~/.quack.yaml, or a bound flag.
+type Config struct {
+	// Backend names a registered backend explicitly (QUACK_BACKEND)
+	Backend string
+	// BucketURL is any gocloud.dev bucket URL (QUACK_BUCKET_URL)
+	BucketURL string
+	// BucketPrefix keeps this journal's keys apart from others sharing a
+	// bucket (QUACK_BUCKET_PREFIX)
+	BucketPrefix string
+	// Dir is where the file backend keeps entries (QUACK_DIR), by default
+	// ~/.quack
+	Dir string
+
+	S3    S3Config
+	GCS   GCSConfig
+	Azure AzureConfig
+}
+
+// S3Config holds the settings for the S3 backend. Endpoint, ForcePathStyle
+// and DisableSSL allow S3-compatible services such as MinIO, Ceph or
+// LocalStack.
+type S3Config struct {
+	Region          string // QUACK_S3_BUCKET_REGION
+	Bucket          string // QUACK_S3_BUCKET_NAME
+	AccessKeyID     string // QUACK_AWS_ACCESS_KEY_ID
+	SecretAccessKey string // QUACK_AWS_SECRET_ACCESS_KEY
+	SessionToken    string // QUACK_AWS_SESSION_TOKEN
+	Endpoint        string // QUACK_S3_ENDPOINT
+	ForcePathStyle  bool   // QUACK_S3_FORCE_PATH_STYLE
+	DisableSSL      bool   // QUACK_S3_DISABLE_SSL
+}
+
+// GCSConfig holds the settings for the Google Cloud Storage backend
+type GCSConfig struct {
+	Bucket          string // QUACK_GOOGLE_BUCKET_NAME
+	CredentialsFile string // QUACK_GOOGLE_APPLICATION_CREDENTIALS
+}
+
+// AzureConfig holds the settings for the Azure Blob Storage backend. Either
+// Key or SASToken is required.
+type AzureConfig struct {
+	Account   string // QUACK_AZURE_STORAGE_ACCOUNT
+	Key       string // QUACK_AZURE_STORAGE_KEY
+	SASToken  string // QUACK_AZURE_STORAGE_SAS_TOKEN
+	Container string // QUACK_AZURE_CONTAINER_NAME
+	Domain    string // QUACK_AZURE_STORAGE_DOMAIN, by default blob.core.windows.net
+	Endpoint  string // QUACK_AZURE_ENDPOINT, for emulators such as Azurite
+}
+
+// setting ties a config field to the environment variable it is read from.
+// Exactly one of field and flag is set.
+type setting struct {
+	env   string
+	field func(*Config) *string
+	flag  func(*Config) *bool
+}
+
+var settings = []setting{
+	{"QUACK_BACKEND", func(c *Config) *string { return &c.Backend }, nil},
+	{"QUACK_BUCKET_URL", func(c *Config) *string { return &c.BucketURL }, nil},
+	{"QUACK_BUCKET_PREFIX", func(c *Config) *string { return &c.BucketPrefix }, nil},
+	{"QUACK_DIR", func(c *Config) *string { return &c.Dir }, nil},
+	{"QUACK_S3_BUCKET_REGION", func(c *Config) *string { return &c.S3.Region }, nil},
+	{"QUACK_S3_BUCKET_NAME", func(c *Config) *string { return &c.S3.Bucket }, nil},
+	{"QUACK_AWS_ACCESS_KEY_ID", func(c *Config) *string { return &c.S3.AccessKeyID }, nil},
+	{"QUACK_AWS_SECRET_ACCESS_KEY", func(c *Config) *string { return &c.S3.SecretAccessKey }, nil},
+	{"QUACK_AWS_SESSION_TOKEN", func(c *Config) *string { return &c.S3.SessionToken }, nil},
+	{"QUACK_S3_ENDPOINT", func(c *Config) *string { return &c.S3.Endpoint }, nil},
+	{"QUACK_S3_FORCE_PATH_STYLE", nil, func(c *Config) *bool { return &c.S3.ForcePathStyle }},
+	{"QUACK_S3_DISABLE_SSL", nil, func(c *Config) *bool { return &c.S3.DisableSSL }},
+	{"QUACK_GOOGLE_BUCKET_NAME", func(c *Config) *string { return &c.GCS.Bucket }, nil},
+	{"QUACK_GOOGLE_APPLICATION_CREDENTIALS", func(c *Config) *string { return &c.GCS.CredentialsFile }, nil},
+	{"QUACK_AZURE_STORAGE_ACCOUNT", func(c *Config) *string { return &c.Azure.Account }, nil},
+	{"QUACK_AZURE_STORAGE_KEY", func(c *Config) *string { return &c.Azure.Key }, nil},
+	{"QUACK_AZURE_STORAGE_SAS_TOKEN", func(c *Config) *string { return &c.Azure.SASToken }, nil},
+	{"QUACK_AZURE_CONTAINER_NAME", func(c *Config) *string { return &c.Azure.Container }, nil},
+	{"QUACK_AZURE_STORAGE_DOMAIN", func(c *Config) *string { return &c.Azure.Domain }, nil},
+	{"QUACK_AZURE_ENDPOINT", func(c *Config) *string { return &c.Azure.Endpoint }, nil},
+}
+
+// ConfigKey returns the viper key for an environment variable, which is what
+// flags should be bound to
+func ConfigKey(env string) string {
+	return strings.ToLower(env)
+}
+
+// LoadConfig reads the storage settings from v
+func LoadConfig(v *viper.Viper) Config {
+	var cfg Config
+	for _, s := range settings {
+		key := ConfigKey(s.env)
+		v.BindEnv(key, s.env)
+		if s.flag != nil {
+			*s.flag(&cfg) = v.GetBool(key)
+		} else {
+			*s.field(&cfg) = v.GetString(key)
+		}
+	}
+
+	return cfg
+}
+
+// Validate checks that the selected backend has everything it needs, naming
+// any missing settings
+func (c Config) Validate() error {
+	name := c.backendName()
+
+	var missing []string
+	require := func(value, env string) {
+		if value == "" {
+			missing = append(missing, env)
+		}
+	}
+
+	switch name {
+	case URLBackendName:
+		require(c.BucketURL, "QUACK_BUCKET_URL")
+	case S3BackendName:
+		require(c.S3.Bucket, "QUACK_S3_BUCKET_NAME")
+		if c.S3.Endpoint == "" {
+			require(c.S3.Region, "QUACK_S3_BUCKET_REGION")
+		}
+		if c.S3.AccessKeyID != "" || c.S3.SecretAccessKey != "" {
+			require(c.S3.AccessKeyID, "QUACK_AWS_ACCESS_KEY_ID")
+			require(c.S3.SecretAccessKey, "QUACK_AWS_SECRET_ACCESS_KEY")
+		}
+	case GCSBackendName:
+		require(c.GCS.Bucket, "QUACK_GOOGLE_BUCKET_NAME")
+	case AzureBackendName:
+		require(c.Azure.Account, "QUACK_AZURE_STORAGE_ACCOUNT")
+		require(c.Azure.Container, "QUACK_AZURE_CONTAINER_NAME")
+		if c.Azure.SASToken == "" {
+			require(c.Azure.Key, "QUACK_AZURE_STORAGE_KEY (or QUACK_AZURE_STORAGE_SAS_TOKEN)")
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"%s storage is missing %s. Please set the missing settings in your environment or ~/.quack.yaml.",
+			name,
+			strings.Join(missing, ", "),
+		)
+	}
+
+	return nil
+}
+
+// Identity names the journal this config points at, so that state kept
+// outside the bucket, such as the local cache, is never mixed up between
+// journals. It is empty for the memory backend.
+func (c Config) Identity() string {
+	name := c.backendName()
+	if name == MemoryBackendName {
+		return ""
+	}
+
+	return strings.Join([]string{
+		name,
+		c.BucketURL,
+		c.BucketPrefix,
+		c.Dir,
+		c.S3.Endpoint,
+		c.S3.Bucket,
+		c.GCS.Bucket,
+		c.Azure.Endpoint,
+		c.Azure.Account,
+		c.Azure.Container,
+	}, "|")
+}
+
+// backendName returns the explicit backend, or the first registered backend
+// whose settings are present, or the file backend
+func (c Config) backendName() string {
+	if c.Backend != "" {
+		return c.Backend
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, reg := range registry {
+		if reg.configured != nil && reg.configured(c) {
+			return reg.name
+		}
+	}
+
+	return FileBackendName
+}
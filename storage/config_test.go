@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadConfig(t *testing.T) {
+	os.Setenv("QUACK_S3_BUCKET_NAME", "from-env")
+	defer os.Unsetenv("QUACK_S3_BUCKET_NAME")
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(strings.NewReader("quack_s3_bucket_region: us-west-2\nquack_s3_bucket_name: from-file\n"))
+
+	cfg := LoadConfig(v)
+
+	// Environment variables win over the config file.
+	if cfg.S3.Bucket != "from-env" {
+		t.Errorf("storage.LoadConfig() returned S3 bucket %s, expected from-env", cfg.S3.Bucket)
+	}
+
+	if cfg.S3.Region != "us-west-2" {
+		t.Errorf("storage.LoadConfig() returned S3 region %s, expected us-west-2", cfg.S3.Region)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		config      Config
+		missing     []string
+		description string
+	}{
+		{
+			config:      Config{},
+			description: "when nothing is configured, files are used",
+		},
+		{
+			config:      Config{S3: S3Config{Bucket: "bucket", Region: "us-west-2"}},
+			description: "when S3 is fully configured",
+		},
+		{
+			config:      Config{S3: S3Config{Bucket: "bucket"}},
+			missing:     []string{"QUACK_S3_BUCKET_REGION"},
+			description: "when S3 region is missing",
+		},
+		{
+			config:      Config{S3: S3Config{Bucket: "bucket", Region: "us-west-2", AccessKeyID: "id"}},
+			missing:     []string{"QUACK_AWS_SECRET_ACCESS_KEY"},
+			description: "when only half of the S3 credentials are set",
+		},
+		{
+			config:      Config{Backend: S3BackendName},
+			missing:     []string{"QUACK_S3_BUCKET_NAME", "QUACK_S3_BUCKET_REGION"},
+			description: "when S3 is chosen explicitly without settings",
+		},
+		{
+			config:      Config{Backend: GCSBackendName},
+			missing:     []string{"QUACK_GOOGLE_BUCKET_NAME"},
+			description: "when GCS is chosen explicitly without a bucket",
+		},
+		{
+			config:      Config{GCS: GCSConfig{Bucket: "bucket"}},
+			description: "when GCS relies on default credentials",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := test.config.Validate()
+
+			if len(test.missing) == 0 {
+				if err != nil {
+					t.Errorf("config.Validate() returned error %v, expected none", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("config.Validate() returned no error, expected %v to be missing", test.missing)
+			}
+
+			for _, name := range test.missing {
+				if !strings.Contains(err.Error(), name) {
+					t.Errorf("config.Validate() returned %q, expected it to name %s", err, name)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	a := Config{S3: S3Config{Bucket: "journal", Region: "us-west-2"}}
+	b := Config{S3: S3Config{Bucket: "journal", Region: "us-west-2"}, BucketPrefix: "work"}
+	c := Config{Dir: "/tmp/journal"}
+
+	if a.Identity() == b.Identity() || a.Identity() == c.Identity() {
+		t.Errorf("storage.Config.Identity() returned the same identity for different journals")
+	}
+
+	if a.Identity() != (Config{S3: S3Config{Bucket: "journal", Region: "us-east-1"}}).Identity() {
+		t.Errorf("storage.Config.Identity() changed with a setting that doesn't change the journal")
+	}
+
+	if actual := (Config{Backend: MemoryBackendName}).Identity(); actual != "" {
+		t.Errorf("storage.Config.Identity() returned %q for the memory backend, expected none", actual)
+	}
+}
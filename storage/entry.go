@@ -15,22 +15,113 @@ type Entry struct {
 	Content          string
 	Key              string
 	DecryptedContent string
+	// ETag and ModTime describe the stored object when the entry was read,
+	// for Unchanged
+	ETag    string
+	ModTime time.Time
+	// The rest is kept encrypted along with the content, and set along with
+	// DecryptedContent. UpdatedAt is when the content was last written.
+	UpdatedAt time.Time
+	// Tags and Mentions are the #tags and @mentions in the entry, lowercased
+	// and without the # or @
+	Tags     []string
+	Mentions []string
+	Mood     string
+	Location string
+	// History holds what the entry said before each edit, oldest first
+	History []Revision
 }
 
-// SetDecryptedContent decrypts an entry's content and sets the plain value on the object
+// NewEntry starts an entry created at the given time, with a fresh
+// time-sortable key. createdAt is kept to the second, which is all bucket
+// metadata records.
+func NewEntry(createdAt time.Time) Entry {
+	return Entry{
+		CreatedAt: createdAt.Truncate(time.Second),
+		UpdatedAt: createdAt.Truncate(time.Second),
+		Key:       NewKey(createdAt),
+	}
+}
+
+// additionalData binds an entry's key and creation time to its ciphertext, so
+// neither can be changed in the bucket without decryption failing
+func (entry *Entry) additionalData() []byte {
+	return []byte(entry.Key + "\n" + entry.CreatedAt.UTC().Format(time.RFC3339))
+}
+
+// Encrypt encrypts msg as the entry's content, along with its tags,
+// mentions and the rest of its fields
+func (entry *Entry) Encrypt(msg string) error {
+	p := newPayload(entry, msg)
+	plaintext, err := p.marshal()
+	if err != nil {
+		return err
+	}
+
+	content, err := secure.EncryptWithAD(plaintext, entry.additionalData())
+	if err != nil {
+		return err
+	}
+
+	entry.Content = content
+	p.apply(entry)
+	return nil
+}
+
+// SetDecryptedContent decrypts an entry's content and sets the plain value,
+// and the fields encrypted with it, on the object
 func (entry *Entry) SetDecryptedContent() error {
-	content, err := secure.Decrypt(entry.Content)
+	plaintext, err := secure.DecryptWithAD(entry.Content, entry.additionalData())
 	if err != nil {
 		return err
 	}
 
-	entry.DecryptedContent = content
+	p, err := parsePayload(plaintext)
+	if err != nil {
+		return err
+	}
+
+	p.apply(entry)
+	return nil
+}
+
+// DecryptWithHeader is SetDecryptedContent for an entry from another
+// journal, such as one in an Archive, encrypted under that journal's header
+func (entry *Entry) DecryptWithHeader(header []byte) error {
+	plaintext, err := secure.DecryptWithHeader(entry.Content, header, entry.additionalData())
+	if err != nil {
+		return err
+	}
+
+	p, err := parsePayload(plaintext)
+	if err != nil {
+		return err
+	}
+
+	p.apply(entry)
+	return nil
+}
+
+// Edit replaces the entry's content with msg as of at, keeping what it said
+// before in its history, and encrypts it. The entry must be decrypted.
+func (entry *Entry) Edit(msg string, at time.Time) error {
+	edited := *entry
+	edited.History = append(append([]Revision(nil), entry.History...), Revision{
+		Content:   entry.DecryptedContent,
+		UpdatedAt: entry.UpdatedAt,
+	})
+	edited.UpdatedAt = at.Truncate(time.Second)
+	if err := edited.Encrypt(msg); err != nil {
+		return err
+	}
+
+	*entry = edited
 	return nil
 }
 
 // Filter filters entries down by search term and date
 func (entry *Entry) Filter(search, date string) (*Entry, bool) {
-	if date != "" && entry.CreatedAt.Format("January 2, 2006") != date {
+	if date != "" && entry.CreatedAt.In(time.Local).Format("January 2, 2006") != date {
 		return entry, false
 	}
 
@@ -64,9 +155,28 @@ func (entry *Entry) Format(verbose bool) (string, error) {
 	if verbose {
 		key := entry.Key
 		result = fmt.Sprintf("%v - %s\n%s", formatted, key, entry.DecryptedContent)
+		if details := entry.details(loc); details != "" {
+			result = fmt.Sprintf("%v - %s\n%s\n%s", formatted, key, details, entry.DecryptedContent)
+		}
 	} else {
 		result = fmt.Sprintf("%v\n%s", formatted, entry.DecryptedContent)
 	}
 
 	return result, nil
 }
+
+// details describes an entry's mood, location and last edit, if it has them
+func (entry *Entry) details(loc *time.Location) string {
+	var details []string
+	if entry.Mood != "" {
+		details = append(details, "Mood: "+entry.Mood)
+	}
+	if entry.Location != "" {
+		details = append(details, "Location: "+entry.Location)
+	}
+	if entry.UpdatedAt.After(entry.CreatedAt) {
+		details = append(details, "Edited "+entry.UpdatedAt.In(loc).Format("January 2, 2006 - 3:04 PM MST"))
+	}
+
+	return strings.Join(details, ", ")
+}
@@ -3,8 +3,12 @@ package storage
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/jonathanwthom/quack/secure"
 )
 
 func TestTransform(t *testing.T) {
@@ -128,7 +132,120 @@ func TestFilter(t *testing.T) {
 	}
 }
 
+func TestFilterUsesLocalTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("PST", -8*60*60)
+	defer func() { time.Local = local }()
+
+	// 03:00 UTC on the 11th is still the 10th in Pacific time.
+	entry := Entry{DecryptedContent: "Foo", CreatedAt: time.Date(2009, time.November, 11, 3, 0, 0, 0, time.UTC)}
+	if _, ok := entry.Filter("", "November 10, 2009"); !ok {
+		t.Errorf("entry.Filter(, November 10, 2009) with %v returned false, expected true", entry)
+	}
+}
+
 func TestSetDecryptedContent(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+	msg := "#standup ran long, @sam presented #Work"
+
+	entry := NewEntry(time.Now())
+	entry.Encrypt(msg)
+
+	// Entries written before payloads existed hold just the message.
+	legacy := NewEntry(time.Now())
+	legacy.Content, _ = secure.EncryptWithAD(msg, legacy.additionalData())
+
+	for _, e := range []Entry{entry, legacy} {
+		e.DecryptedContent, e.Tags, e.Mentions = "", nil, nil
+		if err := e.SetDecryptedContent(); err != nil {
+			t.Fatalf("entry.SetDecryptedContent() returned error %v", err)
+		}
+
+		if e.DecryptedContent != msg || !reflect.DeepEqual(e.Tags, []string{"standup", "work"}) || !reflect.DeepEqual(e.Mentions, []string{"sam"}) {
+			t.Errorf("entry.SetDecryptedContent() set %q, %v, %v, expected %q with its tags and mentions", e.DecryptedContent, e.Tags, e.Mentions, msg)
+		}
+	}
+
+	if strings.Contains(entry.Content, "standup") {
+		t.Errorf("entry.Encrypt() left tags in plain text")
+	}
+}
+
+func TestPayloadMarker(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+	created := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	// An entry that reads like a payload is still kept as it was typed.
+	typed := NewEntry(created)
+	typed.Encrypt(`{"version":2,"content":"spoofed"}`)
+
+	// Entries written before payloads are kept as they were typed, even if
+	// they read like a payload.
+	legacy := NewEntry(created)
+	legacy.Content, _ = secure.EncryptWithAD(`{"version":1,"content":"x"}`, legacy.additionalData())
+
+	// A payload decrypts to its content and the rest of the entry.
+	marked := NewEntry(created)
+	marked.Mood = "calm"
+	marked.Encrypt("marked")
+
+	tests := []struct {
+		entry    Entry
+		expected string
+		mood     string
+	}{
+		{entry: typed, expected: `{"version":2,"content":"spoofed"}`},
+		{entry: legacy, expected: `{"version":1,"content":"x"}`},
+		{entry: marked, expected: "marked", mood: "calm"},
+	}
+
+	for _, test := range tests {
+		stored := Entry{Key: test.entry.Key, CreatedAt: test.entry.CreatedAt, Content: test.entry.Content}
+		if err := stored.SetDecryptedContent(); err != nil || stored.DecryptedContent != test.expected || stored.Mood != test.mood {
+			t.Errorf("entry.SetDecryptedContent() set %q with mood %q, %v, expected %q with mood %q", stored.DecryptedContent, stored.Mood, err, test.expected, test.mood)
+		}
+	}
+
+	corrupt := NewEntry(created)
+	corrupt.Content, _ = secure.EncryptWithAD(payloadMarker+"{", corrupt.additionalData())
+	if err := corrupt.SetDecryptedContent(); err == nil || err.Error() != invalidPayloadError {
+		t.Errorf("entry.SetDecryptedContent() of a broken payload returned %v, expected %s", err, invalidPayloadError)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+	created := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	entry := NewEntry(created)
+	entry.Mood, entry.Location = "tired", "Portland"
+	entry.Encrypt("first draft")
+	entry.Edit("second draft #work", created.Add(time.Hour))
+	entry.Edit("final draft", created.Add(2*time.Hour))
+
+	stored := Entry{Key: entry.Key, CreatedAt: entry.CreatedAt, Content: entry.Content}
+	if err := stored.SetDecryptedContent(); err != nil {
+		t.Fatalf("entry.SetDecryptedContent() returned error %v", err)
+	}
+
+	history := []Revision{
+		{Content: "first draft", UpdatedAt: created},
+		{Content: "second draft #work", UpdatedAt: created.Add(time.Hour)},
+	}
+	if stored.DecryptedContent != "final draft" || !stored.UpdatedAt.Equal(created.Add(2*time.Hour)) || stored.Tags != nil {
+		t.Errorf("entry.Edit() stored %q updated at %v with tags %v, expected the final draft", stored.DecryptedContent, stored.UpdatedAt, stored.Tags)
+	}
+	if stored.Mood != "tired" || stored.Location != "Portland" {
+		t.Errorf("entry.Edit() stored mood %q and location %q, expected them kept", stored.Mood, stored.Location)
+	}
+	if len(stored.History) != len(history) {
+		t.Fatalf("entry.Edit() stored history %v, expected %v", stored.History, history)
+	}
+	for i, revision := range stored.History {
+		if revision.Content != history[i].Content || !revision.UpdatedAt.Equal(history[i].UpdatedAt) {
+			t.Errorf("entry.Edit() stored revision %v, expected %v", revision, history[i])
+		}
+	}
 }
 
 func TestFormat(t *testing.T) {
@@ -156,6 +273,17 @@ func TestFormat(t *testing.T) {
 			verbose:  true,
 			expected: fmt.Sprintf("%s - %s %s - %s\n%s", "November 10, 2009", "11:00 PM", zone, "obfuscatedkey", "Oh hey there"),
 		},
+		{
+			entry: Entry{
+				CreatedAt:        time.Date(2009, time.November, 10, 23, 0, 0, 0, time.Now().Location()),
+				UpdatedAt:        time.Date(2009, time.November, 10, 23, 30, 0, 0, time.Now().Location()),
+				DecryptedContent: "Oh hey there",
+				Key:              "obfuscatedkey",
+				Mood:             "tired",
+			},
+			verbose:  true,
+			expected: fmt.Sprintf("%s - %s %s - %s\nMood: tired, Edited %s - %s %s\n%s", "November 10, 2009", "11:00 PM", zone, "obfuscatedkey", "November 10, 2009", "11:30 PM", zone, "Oh hey there"),
+		},
 	}
 
 	for i := 0; i < len(tests); i++ {
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeServer is a minimal in-memory object store behind a path-style HTTP
+// API, enough for the S3 and Azure drivers to create, read, list and delete
+// objects. Its dialect shapes requests and responses like one of them.
+type fakeServer struct {
+	mu      sync.Mutex
+	dialect fakeDialect
+	objects map[string]fakeObject
+	// authErrors lists requests whose Authorization header was refused
+	authErrors []string
+}
+
+// fakeDialect is what differs between the APIs fakeServer stands in for
+type fakeDialect struct {
+	// root is the path before each key, e.g. /bucket/
+	root           string
+	metadataPrefix string
+	// headers are sent with every object read
+	headers  http.Header
+	created  int
+	deleted  int
+	notFound string
+	// list encodes the objects under prefix, in key order
+	list func(prefix string, objects []fakeListed) interface{}
+	// authorize checks a request's Authorization header
+	authorize func(r *http.Request) error
+}
+
+type fakeObject struct {
+	body     []byte
+	metadata http.Header
+	modTime  time.Time
+}
+
+type fakeListed struct {
+	key string
+	fakeObject
+}
+
+func (o fakeObject) etag() string {
+	return fmt.Sprintf(`"0x%X"`, o.modTime.UnixNano())
+}
+
+func newFakeServer(dialect fakeDialect) *fakeServer {
+	return &fakeServer{dialect: dialect, objects: map[string]fakeObject{}}
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.dialect.authorize(r); err != nil {
+		f.authErrors = append(f.authErrors, fmt.Sprintf("%s %s: %v", r.Method, r.URL.Path, err))
+		f.error(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path+"/", f.dialect.root) {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key, _ := url.PathUnescape(strings.TrimPrefix(r.URL.Path, f.dialect.root))
+	if key == "" || key == strings.TrimSuffix(f.dialect.root, "/") {
+		f.list(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		metadata := http.Header{}
+		for name, values := range r.Header {
+			if strings.HasPrefix(strings.ToLower(name), f.dialect.metadataPrefix) {
+				metadata[name] = values
+			}
+		}
+		obj := fakeObject{body: body, metadata: metadata, modTime: time.Now()}
+		f.objects[key] = obj
+		w.Header().Set("ETag", obj.etag())
+		w.WriteHeader(f.dialect.created)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, f.dialect.notFound)
+			return
+		}
+		for name, values := range obj.metadata {
+			w.Header()[name] = values
+		}
+		for name, values := range f.dialect.headers {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj.body)))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", obj.etag())
+		if r.Method == http.MethodGet {
+			w.Write(obj.body)
+		}
+	case http.MethodDelete:
+		obj, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, f.dialect.notFound)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && match != obj.etag() {
+			f.error(w, http.StatusPreconditionFailed, "ConditionNotMet")
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(f.dialect.deleted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeServer) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	listed := make([]fakeListed, len(keys))
+	for i, key := range keys {
+		listed[i] = fakeListed{key: key, fakeObject: f.objects[key]}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(f.dialect.list(prefix, listed))
+}
+
+func (f *fakeServer) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
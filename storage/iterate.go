@@ -0,0 +1,435 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+// DefaultWorkers is how many entries Iterate fetches at once by default
+const DefaultWorkers = 8
+
+// IterateOptions controls which entries Iterate returns, and in what order
+type IterateOptions struct {
+	// Limit stops iteration after this many entries, if above zero
+	Limit int
+	// PageToken resumes after the last entry returned by an earlier
+	// iteration with the same options. See Iterator.PageToken.
+	PageToken string
+	// Newest returns the most recent entries first. Every key in range is
+	// listed before the first entry is fetched, which is cheap next to
+	// fetching. Entries are ordered by the time in their key, or for keys
+	// that predate time-sortable keys, by the creation time in their
+	// metadata, which takes a request per key to read.
+	Newest bool
+	// Prefix only lists keys starting with it, such as "2026/10/" for
+	// entries created in October 2026 (UTC)
+	Prefix string
+	// Since and Until, if set, limit iteration to entries whose keys were
+	// created at or after Since and before Until. Entries with keys that
+	// predate time-sortable keys are left out.
+	Since time.Time
+	Until time.Time
+	// Keys, if set, fetches just these entries in this order instead of
+	// listing the bucket. Limit still applies.
+	Keys []string
+	// Workers bounds how many entries are fetched concurrently. It
+	// defaults to DefaultWorkers.
+	Workers int
+}
+
+// listed is an object found while listing, before it has been fetched
+type listed struct {
+	key string
+	// createdAt is when the entry was created, for keys that predate
+	// time-sortable keys and so don't say
+	createdAt time.Time
+}
+
+// sortTime is when the object's entry was created
+func (l listed) sortTime() time.Time {
+	if t, ok := KeyTime(l.key); ok {
+		return t
+	}
+
+	return l.createdAt
+}
+
+// token identifies where an iteration is up to
+func (l listed) token(opts IterateOptions) string {
+	if opts.Newest {
+		return fmt.Sprintf("%d/%s", l.sortTime().UnixNano(), l.key)
+	}
+
+	return l.key
+}
+
+// parseNewestToken reads back a token made for Newest iteration
+func parseNewestToken(token string) (*listed, error) {
+	parts := strings.SplitN(token, "/", 2)
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 {
+		return nil, fmt.Errorf("invalid page token %q", token)
+	}
+
+	return &listed{key: parts[1], createdAt: time.Unix(0, nanos)}, nil
+}
+
+// newer orders objects most recent first, by key when tied
+func (l listed) newer(other listed) bool {
+	a, b := l.sortTime(), other.sortTime()
+	if !a.Equal(b) {
+		return a.After(b)
+	}
+
+	return l.key > other.key
+}
+
+// lister lists objects starting with prefix in key order, skipping any keys
+// up to and including after, until yield returns false
+type lister func(ctx context.Context, prefix, after string, yield func(listed) bool) error
+
+type fetcher func(ctx context.Context, key string) (Entry, error)
+
+type fetched struct {
+	entry Entry
+	token string
+	err   error
+}
+
+type fetchJob struct {
+	key    string
+	token  string
+	result chan fetched
+}
+
+// Iterator streams entries out of storage. Entries are fetched concurrently
+// but returned in listing order. Call Stop when done with an iterator that
+// has not returned an error or io.EOF.
+type Iterator struct {
+	queue  chan chan fetched
+	ctx    context.Context
+	cancel context.CancelFunc
+	token  string
+	err    error
+}
+
+// Next returns the next entry, or io.EOF when there are no more
+func (it *Iterator) Next() (Entry, error) {
+	if it.err == nil {
+		it.err = it.ctx.Err()
+	}
+	if it.err != nil {
+		return Entry{}, it.err
+	}
+
+	result, ok := <-it.queue
+	if !ok {
+		it.err = io.EOF
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+		}
+		it.cancel()
+		return Entry{}, it.err
+	}
+
+	f := <-result
+	if f.err != nil {
+		it.err = f.err
+		it.cancel()
+		return Entry{}, it.err
+	}
+
+	it.token = f.token
+	return f.entry, nil
+}
+
+// PageToken returns a token that resumes iteration after the last entry
+// returned by Next, or "" if Next has not returned an entry
+func (it *Iterator) PageToken() string {
+	return it.token
+}
+
+// Stop ends iteration early, abandoning any fetches in flight
+func (it *Iterator) Stop() {
+	it.cancel()
+	if it.err == nil {
+		it.err = io.EOF
+	}
+}
+
+// Iterate streams entries from the configured backend, fetching at most
+// opts.Workers at a time.
+func (s *Storage) Iterate(ctx context.Context, opts IterateOptions) (*Iterator, error) {
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return iterateBucket(ctx, bucket, opts), nil
+}
+
+// IterateSlice iterates over entries already in memory as if they were in a
+// bucket, using CreatedAt as the time they were written. Keys must be unique.
+func IterateSlice(entries []Entry, opts IterateOptions) *Iterator {
+	byKey := make(map[string]Entry, len(entries))
+	objects := make([]listed, 0, len(entries))
+	for _, entry := range entries {
+		byKey[entry.Key] = entry
+		objects = append(objects, listed{key: entry.Key, createdAt: entry.CreatedAt})
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].key < objects[j].key
+	})
+
+	list := func(ctx context.Context, prefix, after string, yield func(listed) bool) error {
+		for _, obj := range objects {
+			if !strings.HasPrefix(obj.key, prefix) || (after != "" && obj.key <= after) {
+				continue
+			}
+			if !yield(obj) {
+				break
+			}
+		}
+		return nil
+	}
+
+	fetch := func(ctx context.Context, key string) (Entry, error) {
+		return byKey[key], nil
+	}
+
+	return newIterator(context.Background(), opts, list, fetch)
+}
+
+func iterateBucket(ctx context.Context, bucket *blob.Bucket, opts IterateOptions) *Iterator {
+	list := func(ctx context.Context, prefix, after string, yield func(listed) bool) error {
+		// gocloud.dev can't start a listing part way through, so earlier
+		// keys are listed and skipped.
+		var err error
+		listErr := listEntries(ctx, bucket, prefix, func(obj *blob.ListObject) bool {
+			if obj.Key <= after {
+				return true
+			}
+
+			// Keys that predate time-sortable keys are sorted by when
+			// their entry was created, which only its metadata records.
+			l := listed{key: obj.Key}
+			if _, ok := KeyTime(obj.Key); !ok && opts.Newest {
+				if l.createdAt, err = readCreatedAt(ctx, bucket, obj.Key); err != nil {
+					return false
+				}
+			}
+
+			return yield(l)
+		})
+		if listErr != nil {
+			return listErr
+		}
+
+		return err
+	}
+
+	fetch := func(ctx context.Context, key string) (Entry, error) {
+		return readFromBucketByKey(ctx, bucket, key)
+	}
+
+	return newIterator(ctx, opts, list, fetch)
+}
+
+// newIterator lists keys in the background and hands them to a pool of
+// workers. A result channel per key is queued in listing order, which both
+// keeps entries in order and bounds how far fetching can run ahead of Next.
+func newIterator(parent context.Context, opts IterateOptions, list lister, fetch fetcher) *Iterator {
+	ctx, cancel := context.WithCancel(parent)
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	it := &Iterator{
+		queue:  make(chan chan fetched, workers),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	jobs := make(chan fetchJob)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				entry, err := fetch(ctx, job.key)
+				job.result <- fetched{entry: entry, token: job.token, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(it.queue)
+
+		err := listInOrder(ctx, opts, list, func(obj listed) bool {
+			result := make(chan fetched, 1)
+			select {
+			case it.queue <- result:
+			case <-ctx.Done():
+				return false
+			}
+
+			select {
+			case jobs <- fetchJob{key: obj.key, token: obj.token(opts), result: result}:
+				return true
+			case <-ctx.Done():
+				result <- fetched{err: ctx.Err()}
+				return false
+			}
+		})
+
+		if err != nil {
+			result := make(chan fetched, 1)
+			result <- fetched{err: err}
+			select {
+			case it.queue <- result:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return it
+}
+
+// listInOrder sends objects to send in the order the options ask for,
+// starting after the page token and stopping at the limit.
+func listInOrder(ctx context.Context, opts IterateOptions, list lister, send func(listed) bool) error {
+	sent := 0
+	limited := func(obj listed) bool {
+		if opts.Limit > 0 && sent >= opts.Limit {
+			return false
+		}
+		sent++
+		return send(obj)
+	}
+
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = rangePrefix(opts.Since, opts.Until)
+	}
+
+	// Keys sort by time, so listing stops at the first key past the range.
+	start, end := keyRange(opts.Since, opts.Until)
+	ranged := func(next func(listed) bool) func(listed) bool {
+		if start == "" && end == "" {
+			return next
+		}
+
+		return func(obj listed) bool {
+			if _, ok := KeyTime(obj.key); !ok || obj.key < start {
+				return true
+			}
+			if end != "" && obj.key >= end {
+				return false
+			}
+			return next(obj)
+		}
+	}
+
+	if opts.Keys != nil {
+		for _, key := range opts.Keys {
+			if !limited(listed{key: key}) {
+				break
+			}
+		}
+		return nil
+	}
+
+	if !opts.Newest {
+		return list(ctx, prefix, opts.PageToken, ranged(limited))
+	}
+
+	var objects []listed
+	err := list(ctx, prefix, "", ranged(func(obj listed) bool {
+		objects = append(objects, obj)
+		return true
+	}))
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].newer(objects[j])
+	})
+
+	var after *listed
+	if opts.PageToken != "" {
+		if after, err = parseNewestToken(opts.PageToken); err != nil {
+			return err
+		}
+	}
+
+	for _, obj := range objects {
+		if after != nil && !after.newer(obj) {
+			continue
+		}
+		if !limited(obj) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Object describes a stored entry without fetching it
+type Object struct {
+	Key     string
+	ModTime time.Time
+	// ETag changes whenever the entry is rewritten. It is the hex MD5 of
+	// the object where the backend reports one.
+	ETag string
+}
+
+// Objects lists every entry in the configured backend, in key order, without
+// fetching any of them
+func (s *Storage) Objects(ctx context.Context) ([]Object, error) {
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	err = listEntries(ctx, bucket, "", func(obj *blob.ListObject) bool {
+		objects = append(objects, Object{
+			Key:     obj.Key,
+			ModTime: obj.ModTime,
+			ETag:    hex.EncodeToString(obj.MD5),
+		})
+		return true
+	})
+
+	return objects, err
+}
+
+// listEntries lists the entries under prefix in key order, leaving out
+// bookkeeping objects and the trash, until yield returns false
+func listEntries(ctx context.Context, bucket *blob.Bucket, prefix string, yield func(*blob.ListObject) bool) error {
+	iter := bucket.List(&blob.ListOptions{Prefix: prefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if obj.IsDir || strings.HasPrefix(obj.Key, reservedPrefix) {
+			continue
+		}
+		if !yield(obj) {
+			return nil
+		}
+	}
+}
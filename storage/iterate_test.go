@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// collect drains an iterator, returning the keys it produced
+func collect(t *testing.T, it *Iterator) []string {
+	var keys []string
+	for {
+		entry, err := it.Next()
+		if err == io.EOF {
+			return keys
+		}
+		if err != nil {
+			t.Fatalf("Iterator.Next() returned error %v", err)
+		}
+		keys = append(keys, entry.Key)
+	}
+}
+
+func testEntries(n int) []Entry {
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	var entries []Entry
+	for i := 0; i < n; i++ {
+		entry := NewEntry(start.Add(time.Duration(i) * time.Minute))
+		entry.Key = fmt.Sprintf("key-%02d", i)
+		entry.Content, entry.DecryptedContent = "encrypted", "encrypted"
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestIterate(t *testing.T) {
+	s := New(NewMemoryBackend())
+	for _, entry := range testEntries(20) {
+		s.Create(entry)
+	}
+	s.WriteHeader([]byte("{}"))
+
+	it, err := s.Iterate(context.Background(), IterateOptions{Workers: 3})
+	if err != nil {
+		t.Fatalf("storage.Iterate() returned error %v", err)
+	}
+
+	actual := collect(t, it)
+	var expected []string
+	for _, entry := range testEntries(20) {
+		expected = append(expected, entry.Key)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("storage.Iterate() returned %v, expected %v", actual, expected)
+	}
+}
+
+func TestIteratePages(t *testing.T) {
+	entries := testEntries(7)
+
+	for _, newest := range []bool{false, true} {
+		var pages [][]string
+		token := ""
+		for {
+			it := IterateSlice(entries, IterateOptions{Limit: 3, PageToken: token, Newest: newest})
+			page := collect(t, it)
+			if len(page) == 0 {
+				break
+			}
+			pages = append(pages, page)
+			token = it.PageToken()
+		}
+
+		expected := [][]string{
+			{"key-00", "key-01", "key-02"},
+			{"key-03", "key-04", "key-05"},
+			{"key-06"},
+		}
+		if newest {
+			expected = [][]string{
+				{"key-06", "key-05", "key-04"},
+				{"key-03", "key-02", "key-01"},
+				{"key-00"},
+			}
+		}
+
+		if !reflect.DeepEqual(pages, expected) {
+			t.Errorf("storage.IterateSlice() with newest %t returned pages %v, expected %v", newest, pages, expected)
+		}
+	}
+}
+
+func TestIterateFetchesOnlyWhatIsRead(t *testing.T) {
+	var fetches int32
+	list := func(ctx context.Context, prefix, after string, yield func(listed) bool) error {
+		for i := 0; i < 100; i++ {
+			if !yield(listed{key: fmt.Sprintf("key-%02d", i)}) {
+				break
+			}
+		}
+		return nil
+	}
+	fetch := func(ctx context.Context, key string) (Entry, error) {
+		atomic.AddInt32(&fetches, 1)
+		return Entry{Key: key}, nil
+	}
+
+	it := newIterator(context.Background(), IterateOptions{Limit: 10, Workers: 4}, list, fetch)
+	if keys := collect(t, it); len(keys) != 10 {
+		t.Errorf("Iterator with limit 10 returned %d entries", len(keys))
+	}
+	if fetches != 10 {
+		t.Errorf("Iterator with limit 10 fetched %d entries", fetches)
+	}
+
+	// Stopping early leaves at most a queue's worth of fetches behind.
+	atomic.StoreInt32(&fetches, 0)
+	it = newIterator(context.Background(), IterateOptions{Workers: 4}, list, fetch)
+	it.Next()
+	it.Stop()
+	time.Sleep(10 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&fetches); n > 10 {
+		t.Errorf("Iterator stopped after one entry fetched %d entries", n)
+	}
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("Iterator.Next() after Stop returned %v, expected %v", err, io.EOF)
+	}
+}
+
+func TestIterateErrors(t *testing.T) {
+	list := func(ctx context.Context, prefix, after string, yield func(listed) bool) error {
+		yield(listed{key: "ok"})
+		yield(listed{key: "broken"})
+		return nil
+	}
+	fetch := func(ctx context.Context, key string) (Entry, error) {
+		if key == "broken" {
+			return Entry{}, errors.New("broken")
+		}
+		return Entry{Key: key}, nil
+	}
+
+	it := newIterator(context.Background(), IterateOptions{}, list, fetch)
+	if entry, err := it.Next(); err != nil || entry.Key != "ok" {
+		t.Errorf("Iterator.Next() returned %v, %v, expected ok", entry.Key, err)
+	}
+	if _, err := it.Next(); err == nil || err.Error() != "broken" {
+		t.Errorf("Iterator.Next() returned %v, expected broken", err)
+	}
+
+	listErr := func(ctx context.Context, prefix, after string, yield func(listed) bool) error {
+		return errors.New("listing failed")
+	}
+	it = newIterator(context.Background(), IterateOptions{}, listErr, fetch)
+	if _, err := it.Next(); err == nil || err.Error() != "listing failed" {
+		t.Errorf("Iterator.Next() returned %v, expected listing failed", err)
+	}
+
+	it = IterateSlice(testEntries(1), IterateOptions{Newest: true, PageToken: "nonsense"})
+	if _, err := it.Next(); err == nil {
+		t.Errorf("Iterator.Next() accepted an invalid page token")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it = newIterator(ctx, IterateOptions{}, list, fetch)
+	if _, err := it.Next(); err != context.Canceled {
+		t.Errorf("Iterator.Next() with a canceled context returned %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestIterateRange(t *testing.T) {
+	s := New(NewMemoryBackend())
+	start := time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC)
+	var entries []Entry
+	for i := 0; i < 5; i++ {
+		entry := NewEntry(start.Add(time.Duration(i) * 24 * time.Hour))
+		entry.Content, entry.DecryptedContent = "encrypted", "encrypted"
+		s.Create(entry)
+		entries = append(entries, entry)
+	}
+
+	legacy := testEntry("encrypted")
+	legacy.Key = "7b0ed6ec5e1bfce2e0a3c92fb1a0a2fd0a9dd8c5efb3e4d43e0bbff8d16d2a77"
+	s.Create(legacy)
+
+	tests := []struct {
+		opts     IterateOptions
+		expected []string
+	}{
+		{
+			opts:     IterateOptions{Prefix: "2026/10/"},
+			expected: []string{entries[1].Key, entries[2].Key, entries[3].Key, entries[4].Key},
+		},
+		{
+			opts: IterateOptions{
+				Since: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+				Until: time.Date(2026, 10, 3, 12, 0, 0, 0, time.UTC),
+			},
+			expected: []string{entries[1].Key, entries[2].Key},
+		},
+		{
+			opts: IterateOptions{
+				Since:  time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+				Newest: true,
+			},
+			expected: []string{entries[4].Key, entries[3].Key, entries[2].Key, entries[1].Key},
+		},
+		{
+			opts:     IterateOptions{Until: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+			expected: []string{entries[0].Key},
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		it, _ := s.Iterate(context.Background(), test.opts)
+		actual := collect(t, it)
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("storage.Iterate(%+v) returned %v, expected %v", test.opts, actual, test.expected)
+		}
+	}
+}
+
+func TestIterateNewestLegacyKeys(t *testing.T) {
+	s := New(NewMemoryBackend())
+	start := time.Date(2019, 3, 9, 12, 0, 0, 0, time.UTC)
+
+	older := NewEntry(start)
+	older.Key = "1a" + strings.Repeat("0", 62)
+	older.Content, older.DecryptedContent = "encrypted", "encrypted"
+	newer := NewEntry(start.Add(time.Hour))
+	newer.Key = "0b" + strings.Repeat("0", 62)
+	newer.Content, newer.DecryptedContent = "encrypted", "encrypted"
+	newest := NewEntry(start.Add(2 * time.Hour))
+	newest.Content, newest.DecryptedContent = "encrypted", "encrypted"
+	for _, entry := range []Entry{older, newer, newest} {
+		s.Create(entry)
+	}
+
+	// Editing the older entry writes it last, but doesn't make it newer.
+	older.Content, older.DecryptedContent = "edited", "edited"
+	s.Update(older)
+
+	it, _ := s.Iterate(context.Background(), IterateOptions{Newest: true})
+	expected := []string{newest.Key, newer.Key, older.Key}
+	if actual := collect(t, it); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("storage.Iterate(Newest) returned %v, expected %v", actual, expected)
+	}
+}
+
+func TestIterateKeys(t *testing.T) {
+	s := New(NewMemoryBackend())
+	for _, entry := range testEntries(5) {
+		s.Create(entry)
+	}
+
+	keys := []string{"key-03", "key-00", "key-04"}
+	it, _ := s.Iterate(context.Background(), IterateOptions{Keys: keys, Limit: 2})
+	actual := collect(t, it)
+
+	if !reflect.DeepEqual(actual, keys[:2]) {
+		t.Errorf("storage.Iterate() with keys %v returned %v, expected %v", keys, actual, keys[:2])
+	}
+}
+
+func TestObjects(t *testing.T) {
+	s := New(NewMemoryBackend())
+	entries := testEntries(2)
+	for _, entry := range entries {
+		s.Create(entry)
+	}
+	s.WriteHeader([]byte("{}"))
+
+	before, err := s.Objects(context.Background())
+	if err != nil || len(before) != 2 || before[0].Key != "key-00" || before[0].ETag == "" {
+		t.Fatalf("storage.Objects() returned %+v, %v, expected 2 entries with ETags", before, err)
+	}
+
+	entries[0].Content, entries[0].DecryptedContent = "rewritten", "rewritten"
+	s.Update(entries[0])
+	after, _ := s.Objects(context.Background())
+
+	if after[0].ETag == before[0].ETag || after[1].ETag != before[1].ETag {
+		t.Errorf("storage.Objects() ETags went from %+v to %+v, expected only the first to change", before, after)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+// Entry keys look like 2026/10/18/01JAB3X5Y7Z9QWERTYUIOPASDF: the UTC day the
+// entry was created, then a ULID. A ULID is a 48-bit millisecond timestamp
+// followed by 80 random bits, written in Crockford's base32 so that keys sort
+// in the order entries were created.
+const (
+	keyDateLayout = "2006/01/02/"
+	ulidLength    = 26
+	ulidAlphabet  = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// NewKey returns a fresh, time-sortable key for an entry created at createdAt.
+// It panics if the system's random number generator fails, as keys made
+// without randomness could collide and overwrite other entries.
+func NewKey(createdAt time.Time) string {
+	entropy := make([]byte, 10)
+	if _, err := io.ReadFull(rand.Reader, entropy); err != nil {
+		panic(fmt.Sprintf("storage: unable to read random bytes for a key: %v", err))
+	}
+
+	return timeKey(createdAt, entropy)
+}
+
+// migratedKey returns the time-sortable key an entry with an older key is
+// renamed to. It is the same every time, so an interrupted migration can be
+// run again without leaving duplicates.
+func migratedKey(oldKey string, createdAt time.Time) string {
+	sum := sha256.Sum256([]byte(oldKey))
+
+	return timeKey(createdAt, sum[:10])
+}
+
+func timeKey(createdAt time.Time, entropy []byte) string {
+	ms := uint64(createdAt.UnixNano() / int64(time.Millisecond))
+	id := make([]byte, 16)
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> uint(40-8*i))
+	}
+	copy(id[6:], entropy)
+
+	return createdAt.UTC().Format(keyDateLayout) + encodeULID(id)
+}
+
+func encodeULID(id []byte) string {
+	n := new(big.Int).SetBytes(id)
+	base := big.NewInt(32)
+	digit := new(big.Int)
+
+	out := make([]byte, ulidLength)
+	for i := ulidLength - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		out[i] = ulidAlphabet[digit.Int64()]
+	}
+
+	return string(out)
+}
+
+// KeyTime returns the creation time encoded in a time-sortable key, to the
+// millisecond. It reports false for keys made before keys were time-sortable.
+func KeyTime(key string) (time.Time, bool) {
+	if len(key) != len(keyDateLayout)+ulidLength {
+		return time.Time{}, false
+	}
+
+	if _, err := time.Parse(keyDateLayout, key[:len(keyDateLayout)]); err != nil {
+		return time.Time{}, false
+	}
+
+	// The first ten characters hold the timestamp, the first of them only
+	// three bits of it.
+	var ms uint64
+	for _, c := range key[len(keyDateLayout) : len(keyDateLayout)+10] {
+		i := strings.IndexRune(ulidAlphabet, c)
+		if i < 0 {
+			return time.Time{}, false
+		}
+		ms = ms<<5 | uint64(i)
+	}
+
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC(), true
+}
+
+// keyRange returns the first key at or after since and the first key at or
+// after until. A zero time leaves that end of the range open.
+func keyRange(since, until time.Time) (string, string) {
+	var start, end string
+	if !since.IsZero() {
+		start = timeKey(since, make([]byte, 10))
+	}
+	if !until.IsZero() {
+		end = timeKey(until, make([]byte, 10))
+	}
+
+	return start, end
+}
+
+// rangePrefix returns the longest date prefix shared by every key between
+// since and until, so listing can skip the rest of the bucket
+func rangePrefix(since, until time.Time) string {
+	if since.IsZero() || until.IsZero() {
+		return ""
+	}
+
+	a := since.UTC().Format(keyDateLayout)
+	b := until.UTC().Format(keyDateLayout)
+	i := 0
+	for i < len(a) && a[i] == b[i] {
+		i++
+	}
+
+	return a[:strings.LastIndex(a[:i], "/")+1]
+}
+
+// ErrKeyNotFound is returned when no entry's key starts with a prefix
+var ErrKeyNotFound = errors.New("no entry has that key")
+
+// AmbiguousKeyError is returned when more than one entry's key starts with a
+// prefix
+type AmbiguousKeyError struct {
+	Prefix string
+	Keys   []string
+}
+
+func (e *AmbiguousKeyError) Error() string {
+	return fmt.Sprintf("%q matches %d entries", e.Prefix, len(e.Keys))
+}
+
+// MatchKey returns the one key in keys that is prefix or starts with it, the
+// way git accepts a unique prefix of a commit's SHA. The ULID of a
+// time-sortable key can be given without its date, and case doesn't matter.
+// It returns ErrKeyNotFound if no key matches, and an *AmbiguousKeyError if
+// several do.
+func MatchKey(prefix string, keys []string) (string, error) {
+	if prefix == "" {
+		return "", ErrKeyNotFound
+	}
+
+	var matches []string
+	for _, key := range keys {
+		if key == prefix {
+			return key, nil
+		}
+		if keyHasPrefix(key, prefix) {
+			matches = append(matches, key)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", ErrKeyNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return "", &AmbiguousKeyError{Prefix: prefix, Keys: matches}
+	}
+}
+
+func keyHasPrefix(key, prefix string) bool {
+	key, prefix = strings.ToUpper(key), strings.ToUpper(prefix)
+	if strings.HasPrefix(key, prefix) {
+		return true
+	}
+
+	if _, ok := KeyTime(key); ok {
+		return strings.HasPrefix(key[len(keyDateLayout):], prefix)
+	}
+
+	return false
+}
+
+// ResolveKey returns the key of the one entry whose key is prefix or starts
+// with it, as MatchKey does
+func (s *Storage) ResolveKey(prefix string) (string, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var keys []string
+	err = listEntries(ctx, bucket, "", func(obj *blob.ListObject) bool {
+		if obj.Key == prefix || keyHasPrefix(obj.Key, prefix) {
+			keys = append(keys, obj.Key)
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return MatchKey(prefix, keys)
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"crypto/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewKey(t *testing.T) {
+	createdAt := time.Date(2026, 10, 18, 9, 30, 15, 123000000, time.FixedZone("PDT", -7*60*60))
+	key := NewKey(createdAt)
+
+	if !strings.HasPrefix(key, "2026/10/18/") || len(key) != 37 {
+		t.Errorf("storage.NewKey(%v) returned %s, expected 2026/10/18/<ulid>", createdAt, key)
+	}
+
+	actual, ok := KeyTime(key)
+	if !ok || !actual.Equal(createdAt) {
+		t.Errorf("storage.KeyTime(%s) returned %v, %t, expected %v", key, actual, ok, createdAt)
+	}
+
+	if key == NewKey(createdAt) {
+		t.Errorf("storage.NewKey(%v) returned the same key twice", createdAt)
+	}
+}
+
+func TestNewKeyWithoutRandomness(t *testing.T) {
+	reader := rand.Reader
+	rand.Reader = strings.NewReader("")
+	defer func() {
+		rand.Reader = reader
+		if recover() == nil {
+			t.Errorf("storage.NewKey() returned a key without random bytes, expected it to panic")
+		}
+	}()
+
+	NewKey(time.Now())
+}
+
+func TestKeysSortByTime(t *testing.T) {
+	start := time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC)
+	var keys []string
+	for i := 0; i < 50; i++ {
+		keys = append(keys, NewKey(start.Add(time.Duration(i*i)*time.Hour)))
+	}
+
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("storage.NewKey() returned keys out of order: %v", keys)
+	}
+}
+
+func TestKeyTime(t *testing.T) {
+	tests := []string{
+		"7b0ed6ec5e1bfce2e0a3c92fb1a0a2fd0a9dd8c5efb3e4d43e0bbff8d16d2a77",
+		"2026/10/18/not-a-ulid-at-all-but-long",
+		"2026/13/18/01J8Z3V6T0AAAAAAAAAAAAAAAA",
+		"",
+	}
+
+	for i := 0; i < len(tests); i++ {
+		if _, ok := KeyTime(tests[i]); ok {
+			t.Errorf("storage.KeyTime(%s) returned true, expected false", tests[i])
+		}
+	}
+}
+
+func TestRangePrefix(t *testing.T) {
+	tests := []struct {
+		since    time.Time
+		until    time.Time
+		expected string
+	}{
+		{
+			since:    time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC),
+			expected: "2026/10/18/",
+		},
+		{
+			since:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC),
+			expected: "2026/10/",
+		},
+		{
+			since:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+			expected: "2026/",
+		},
+		{
+			since:    time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			until:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			expected: "",
+		},
+		{
+			until:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			expected: "",
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		actual := rangePrefix(test.since, test.until)
+		if actual != test.expected {
+			t.Errorf("storage.rangePrefix(%v, %v) returned %q, expected %q", test.since, test.until, actual, test.expected)
+		}
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	keys := []string{
+		"2026/10/18/01JAB3X5Y7Z9QWERTYUIOPASDF",
+		"2026/10/18/01JAB3X5Y7ZAAAAAAAAAAAAAAA",
+		"2026/10/19/01JAC000000000000000000000",
+		"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+
+	tests := []struct {
+		prefix    string
+		expected  string
+		err       error
+		ambiguous int
+	}{
+		{prefix: keys[0], expected: keys[0]},
+		{prefix: "2026/10/19", expected: keys[2]},
+		{prefix: "01jac", expected: keys[2]},
+		{prefix: "01JAB3X5Y7Z9", expected: keys[0]},
+		{prefix: "9f86", expected: keys[3]},
+		{prefix: "01JAB3", ambiguous: 2},
+		{prefix: "2026/10/18", ambiguous: 2},
+		{prefix: "01JAD", err: ErrKeyNotFound},
+		{prefix: "", err: ErrKeyNotFound},
+	}
+
+	for _, test := range tests {
+		actual, err := MatchKey(test.prefix, keys)
+		if test.ambiguous > 0 {
+			if ambiguous, ok := err.(*AmbiguousKeyError); !ok || len(ambiguous.Keys) != test.ambiguous {
+				t.Errorf("storage.MatchKey(%q) returned %s, %v, expected %d matches", test.prefix, actual, err, test.ambiguous)
+			}
+			continue
+		}
+
+		if actual != test.expected || err != test.err {
+			t.Errorf("storage.MatchKey(%q) returned %s, %v, expected %s, %v", test.prefix, actual, err, test.expected, test.err)
+		}
+	}
+}
+
+func TestResolveKey(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	entry := testEntry("encrypted")
+	s.Create(entry)
+	s.Create(testEntry("also encrypted"))
+	id := entry.Key[len(keyDateLayout):]
+
+	if key, err := s.ResolveKey(id[len(id)-16:]); err != ErrKeyNotFound {
+		t.Errorf("storage.ResolveKey(end of the id) returned %s, %v, expected %v", key, err, ErrKeyNotFound)
+	}
+
+	if key, err := s.ResolveKey(id); key != entry.Key || err != nil {
+		t.Errorf("storage.ResolveKey(%s) returned %s, %v, expected %s", id, key, err, entry.Key)
+	}
+}
@@ -0,0 +1,12 @@
+package storage
+
+import "github.com/rivo/uniseg"
+
+// Length counts the characters in text the way a reader sees them: as
+// grapheme clusters, following the extended grapheme cluster rules of
+// Unicode Standard Annex #29. An emoji built from several code points, such
+// as a flag or a family, a letter with combining accents, or a Hangul
+// syllable written in jamo each count as one.
+func Length(text string) int {
+	return uniseg.GraphemeClusterCount(text)
+}
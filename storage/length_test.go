@@ -0,0 +1,34 @@
+package storage
+
+import "testing"
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{text: "", expected: 0},
+		{text: "Hello World!", expected: 12},
+		{text: "こんにちは世界", expected: 7},
+		{text: "café", expected: 4},
+		{text: "café", expected: 4},
+		{text: "👍🏽", expected: 1},
+		{text: "👨‍👩‍👧‍👦", expected: 1},
+		{text: "🇯🇵🇺🇸", expected: 2},
+		{text: "🇯🇵🇺", expected: 2},
+		{text: "❤️", expected: 1},
+		{text: "각", expected: 1},
+		{text: "한국어", expected: 3},
+		{text: "line\r\nline", expected: 9},
+		{text: "a‍b", expected: 2},
+		{text: "नमस्ते", expected: 4},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		actual := Length(test.text)
+		if actual != test.expected {
+			t.Errorf("storage.Length(%q) returned %d, expected %d", test.text, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// manifestKey is where the signed, hash-chained list of entries is kept.
+const manifestKey = reservedPrefix + "manifest.json"
+
+const manifestVersion = 2
+
+// ErrNoManifest is returned by Verify for journals that have no manifest yet.
+// One is created the next time an entry is written.
+var ErrNoManifest = errors.New("journal has no manifest yet; one is created the next time an entry is saved")
+
+const brokenChainError = "Journal manifest hash chain is broken. It has been tampered with."
+
+// Signer signs and verifies the journal manifest
+type Signer interface {
+	Sign(data []byte) (string, error)
+	Verify(data []byte, signature string) error
+}
+
+// manifestRecord is one entry in the manifest. Chain covers this record and
+// every record before it.
+type manifestRecord struct {
+	Key       string `json:"key"`
+	CreatedAt string `json:"createdAt"`
+	Hash      string `json:"hash"`
+	Chain     string `json:"chain"`
+}
+
+type manifest struct {
+	Version int `json:"version"`
+	// Sequence counts every write of the manifest, so that an older one
+	// can be told apart from the latest. Version 1 manifests have none.
+	Sequence  int              `json:"sequence,omitempty"`
+	Records   []manifestRecord `json:"records"`
+	Signature string           `json:"signature"`
+}
+
+// Report describes how the entries in a bucket compare to the manifest
+type Report struct {
+	// Entries is the number of entries in the manifest
+	Entries int
+	// Missing entries are in the manifest but not in the bucket
+	Missing []string
+	// Unlisted entries are in the bucket but not in the manifest, such as
+	// replayed copies of deleted entries
+	Unlisted []string
+	// Altered entries have different ciphertext than the manifest records
+	Altered []string
+	// Reordered entries have a different createdAt than the manifest records
+	Reordered []string
+}
+
+// OK reports whether the bucket matches the manifest exactly
+func (r Report) OK() bool {
+	return len(r.Missing)+len(r.Unlisted)+len(r.Altered)+len(r.Reordered) == 0
+}
+
+func contentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func formatCreatedAt(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (m *manifest) link(prev string, r manifestRecord) string {
+	sum := sha256.Sum256([]byte(prev + "\n" + r.Key + "\n" + r.CreatedAt + "\n" + r.Hash))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// rechain recomputes every record's chain hash after the records change.
+func (m *manifest) rechain() {
+	prev := ""
+	for i := range m.Records {
+		m.Records[i].Chain = m.link(prev, m.Records[i])
+		prev = m.Records[i].Chain
+	}
+}
+
+// checkChain makes sure no record was added, removed or changed without the
+// chain being rebuilt.
+func (m *manifest) checkChain() error {
+	prev := ""
+	for _, r := range m.Records {
+		if m.link(prev, r) != r.Chain {
+			return errors.New(brokenChainError)
+		}
+		prev = r.Chain
+	}
+
+	return nil
+}
+
+// signedData is what the signature covers: the head of the chain pins down
+// every record.
+func (m *manifest) signedData() []byte {
+	head := ""
+	if len(m.Records) > 0 {
+		head = m.Records[len(m.Records)-1].Chain
+	}
+
+	if m.Version < 2 {
+		return []byte(fmt.Sprintf("%d\n%d\n%s", m.Version, len(m.Records), head))
+	}
+
+	return []byte(fmt.Sprintf("%d\n%d\n%d\n%s", m.Version, m.Sequence, len(m.Records), head))
+}
+
+func (m *manifest) put(r manifestRecord) {
+	for i := range m.Records {
+		if m.Records[i].Key == r.Key {
+			m.Records[i] = r
+			return
+		}
+	}
+
+	m.Records = append(m.Records, r)
+}
+
+func (m *manifest) remove(key string) {
+	for i := range m.Records {
+		if m.Records[i].Key == key {
+			m.Records = append(m.Records[:i], m.Records[i+1:]...)
+			return
+		}
+	}
+}
+
+// manifestRetries is how many times a manifest changed by someone else is
+// read again before giving up
+const manifestRetries = 5
+
+// readManifest loads and verifies the manifest, returning nil if the journal
+// has none, along with a precondition that holds until it is next written.
+func (s *Storage) readManifest(ctx context.Context, bucket *blob.Bucket) (*manifest, Precondition, error) {
+	attrs, err := bucket.Attributes(ctx, manifestKey)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, Precondition{Absent: true}, nil
+	}
+	if err != nil {
+		return nil, Precondition{}, err
+	}
+	// A manifest rewritten between the two reads fails the precondition,
+	// and is read again.
+	unchanged := Precondition{ETag: hex.EncodeToString(attrs.MD5), ModTime: attrs.ModTime}
+
+	data, err := bucket.ReadAll(ctx, manifestKey)
+	if err != nil {
+		return nil, Precondition{}, err
+	}
+
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, Precondition{}, err
+	}
+
+	if err := m.checkChain(); err != nil {
+		return nil, Precondition{}, err
+	}
+
+	if err := s.Signer.Verify(m.signedData(), m.Signature); err != nil {
+		return nil, Precondition{}, err
+	}
+
+	if err := s.checkWatermark(m); err != nil {
+		return nil, Precondition{}, err
+	}
+
+	return m, unchanged, nil
+}
+
+// checkManifest makes sure the manifest verifies before an entry is written
+// that it would then have to list. Nothing is checked if the storage has no
+// signer.
+func (s *Storage) checkManifest(ctx context.Context, bucket *blob.Bucket) error {
+	if s.Signer == nil {
+		return nil
+	}
+
+	_, _, err := s.readManifest(ctx, bucket)
+
+	return err
+}
+
+// writeManifest signs and saves m, as long as the stored manifest still
+// meets cond, or else returns ErrConflict.
+func (s *Storage) writeManifest(ctx context.Context, bucket *blob.Bucket, m *manifest, cond Precondition) error {
+	m.Version = manifestVersion
+	m.Sequence++
+	m.rechain()
+
+	signature, err := s.Signer.Sign(m.signedData())
+	if err != nil {
+		return err
+	}
+	m.Signature = signature
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	beforeWrite, err := checkPreconditions(ctx, bucket, manifestKey, []Precondition{cond})
+	if err != nil {
+		return err
+	}
+	options := blob.WriterOptions{BeforeWrite: beforeWrite}
+	if err := bucket.WriteAll(ctx, manifestKey, data, &options); err != nil {
+		return conflict(err)
+	}
+
+	return s.checkWatermark(m)
+}
+
+// updateManifest applies change to the verified manifest and signs it again.
+// Journals without a manifest get one listing their current entries. If
+// someone else saves the manifest in the meantime, it starts over from what
+// they wrote. Nothing is done if the storage has no signer.
+func (s *Storage) updateManifest(ctx context.Context, bucket *blob.Bucket, change func(*manifest)) error {
+	if s.Signer == nil {
+		return nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		m, cond, err := s.readManifest(ctx, bucket)
+		if err != nil {
+			return err
+		}
+
+		if m == nil {
+			if m, err = manifestFromBucket(ctx, bucket); err != nil {
+				return err
+			}
+		}
+
+		change(m)
+
+		err = s.writeManifest(ctx, bucket, m, cond)
+		if err != ErrConflict || attempt == manifestRetries {
+			return err
+		}
+	}
+}
+
+// ResignManifest signs the manifest again with signer, e.g. after the
+// QUACKWORD changes. The manifest is verified with the current signer first.
+func (s *Storage) ResignManifest(signer Signer) error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	m, cond, err := s.readManifest(ctx, bucket)
+	if err != nil || m == nil {
+		return err
+	}
+
+	s.Signer = signer
+
+	return s.writeManifest(ctx, bucket, m, cond)
+}
+
+// manifestFromBucket lists the entries already in the bucket, oldest first.
+func manifestFromBucket(ctx context.Context, bucket *blob.Bucket) (*manifest, error) {
+	entries, err := readFromBucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	m := &manifest{Version: manifestVersion}
+	for _, entry := range entries {
+		m.Records = append(m.Records, manifestRecord{
+			Key:       entry.Key,
+			CreatedAt: formatCreatedAt(entry.CreatedAt),
+			Hash:      contentHash([]byte(entry.Content)),
+		})
+	}
+
+	return m, nil
+}
+
+// Verify compares the entries in the bucket against the signed manifest.
+// It returns an error if there is no manifest, or if the manifest itself
+// has been tampered with.
+func (s *Storage) Verify() (Report, error) {
+	if s.Signer == nil {
+		return Report{}, errors.New("storage has no signer to verify the manifest with")
+	}
+
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	m, _, err := s.readManifest(ctx, bucket)
+	if err != nil {
+		return Report{}, err
+	}
+	if m == nil {
+		return Report{}, ErrNoManifest
+	}
+
+	entries, err := readFromBucket(ctx, bucket)
+	if err != nil {
+		return Report{}, err
+	}
+
+	found := make(map[string]Entry, len(entries))
+	for _, entry := range entries {
+		found[entry.Key] = entry
+	}
+
+	report := Report{Entries: len(m.Records)}
+	listed := make(map[string]bool, len(m.Records))
+	for _, r := range m.Records {
+		listed[r.Key] = true
+		entry, ok := found[r.Key]
+
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, r.Key)
+		case contentHash([]byte(entry.Content)) != r.Hash:
+			report.Altered = append(report.Altered, r.Key)
+		case formatCreatedAt(entry.CreatedAt) != r.CreatedAt:
+			report.Reordered = append(report.Reordered, r.Key)
+		}
+	}
+
+	for _, entry := range entries {
+		if !listed[entry.Key] {
+			report.Unlisted = append(report.Unlisted, entry.Key)
+		}
+	}
+	sort.Strings(report.Unlisted)
+
+	return report, nil
+}
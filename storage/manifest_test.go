@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+type fakeSigner struct {
+	key string
+}
+
+func (f fakeSigner) Sign(data []byte) (string, error) {
+	mac := hmac.New(sha256.New, []byte(f.key))
+	mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (f fakeSigner) Verify(data []byte, signature string) error {
+	expected, _ := f.Sign(data)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("bad signature")
+	}
+
+	return nil
+}
+
+func newSignedStorage(t *testing.T) (*Storage, *blob.Bucket, []Entry) {
+	s := &Storage{Backend: NewMemoryBackend(), Signer: fakeSigner{"password"}}
+	bucket, _ := s.open(context.Background())
+
+	var entries []Entry
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		entry := NewEntry(start.Add(time.Duration(i) * time.Hour))
+		entry.Key = string('a' + rune(i))
+		entry.Content = "encrypted " + entry.Key
+		entry.DecryptedContent = entry.Content
+		if err := s.Create(entry); err != nil {
+			t.Fatalf("storage.Create(%v) returned error %v", entry, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return s, bucket, entries
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		tamper   func(*Storage, *blob.Bucket, []Entry)
+		expected Report
+	}{
+		{
+			name:     "untouched",
+			tamper:   func(*Storage, *blob.Bucket, []Entry) {},
+			expected: Report{Entries: 3},
+		},
+		{
+			name: "deleted through storage",
+			tamper: func(s *Storage, _ *blob.Bucket, e []Entry) {
+				s.Delete(e[1].Key)
+			},
+			expected: Report{Entries: 2},
+		},
+		{
+			name: "updated through storage",
+			tamper: func(s *Storage, _ *blob.Bucket, e []Entry) {
+				e[0].Content = "rewritten"
+				s.Update(e[0])
+			},
+			expected: Report{Entries: 3},
+		},
+		{
+			name: "deleted from bucket",
+			tamper: func(_ *Storage, b *blob.Bucket, e []Entry) {
+				b.Delete(ctx, e[1].Key)
+			},
+			expected: Report{Entries: 3, Missing: []string{"b"}},
+		},
+		{
+			name: "overwritten in bucket",
+			tamper: func(_ *Storage, b *blob.Bucket, e []Entry) {
+				e[2].Content = "forged"
+				writeToBucket(ctx, e[2], b, nil)
+			},
+			expected: Report{Entries: 3, Altered: []string{"c"}},
+		},
+		{
+			name: "backdated in bucket",
+			tamper: func(_ *Storage, b *blob.Bucket, e []Entry) {
+				e[2].CreatedAt = e[0].CreatedAt.Add(-time.Hour)
+				writeToBucket(ctx, e[2], b, nil)
+			},
+			expected: Report{Entries: 3, Reordered: []string{"c"}},
+		},
+		{
+			name: "replayed into bucket",
+			tamper: func(_ *Storage, b *blob.Bucket, e []Entry) {
+				e[0].Key = "replayed"
+				writeToBucket(ctx, e[0], b, nil)
+			},
+			expected: Report{Entries: 3, Unlisted: []string{"replayed"}},
+		},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		s, bucket, entries := newSignedStorage(t)
+		test.tamper(s, bucket, entries)
+
+		actual, err := s.Verify()
+		if err != nil {
+			t.Errorf("storage.Verify() after %s returned error %v", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("storage.Verify() after %s returned %+v, expected %+v", test.name, actual, test.expected)
+		}
+
+		if actual.OK() != test.expected.OK() {
+			t.Errorf("Report.OK() after %s returned %t", test.name, actual.OK())
+		}
+	}
+}
+
+func TestVerifyTamperedManifest(t *testing.T) {
+	ctx := context.Background()
+	s, bucket, _ := newSignedStorage(t)
+
+	data, _ := bucket.ReadAll(ctx, manifestKey)
+	m := new(manifest)
+	json.Unmarshal(data, m)
+
+	// Dropping a record, with or without rebuilding the chain, must be caught.
+	m.Records = m.Records[1:]
+	data, _ = json.Marshal(m)
+	bucket.WriteAll(ctx, manifestKey, data, nil)
+	if _, err := s.Verify(); err == nil {
+		t.Errorf("storage.Verify() accepted a manifest with a broken chain")
+	}
+
+	m.rechain()
+	data, _ = json.Marshal(m)
+	bucket.WriteAll(ctx, manifestKey, data, nil)
+	if _, err := s.Verify(); err == nil {
+		t.Errorf("storage.Verify() accepted a manifest with a bad signature")
+	}
+
+	// Writes refuse to build on a tampered manifest.
+	entry := testEntry("encrypted")
+	if err := s.Create(entry); err == nil {
+		t.Errorf("storage.Create() accepted a tampered manifest")
+	}
+	if ok, _ := bucket.Exists(ctx, entry.Key); ok {
+		t.Errorf("storage.Create() saved entry %s before finding the manifest tampered with", entry.Key)
+	}
+
+	s.Signer = fakeSigner{"wrong password"}
+	if err := s.ResignManifest(fakeSigner{"new password"}); err == nil {
+		t.Errorf("storage.ResignManifest() accepted the wrong signer")
+	}
+}
+
+func TestVerifyWithoutManifest(t *testing.T) {
+	s := &Storage{Backend: NewMemoryBackend()}
+	s.Create(testEntry("encrypted"))
+	s.Signer = fakeSigner{"password"}
+
+	if _, err := s.Verify(); err != ErrNoManifest {
+		t.Errorf("storage.Verify() returned %v, expected %v", err, ErrNoManifest)
+	}
+
+	// The first signed write lists entries that are already there.
+	s.Create(testEntry("encrypted"))
+	actual, err := s.Verify()
+	if err != nil || !actual.OK() || actual.Entries != 2 {
+		t.Errorf("storage.Verify() returned %+v, %v, expected 2 entries", actual, err)
+	}
+}
+
+func TestResignManifest(t *testing.T) {
+	s, _, _ := newSignedStorage(t)
+
+	if err := s.ResignManifest(fakeSigner{"new password"}); err != nil {
+		t.Fatalf("storage.ResignManifest() returned error %v", err)
+	}
+
+	s.Signer = fakeSigner{"password"}
+	if _, err := s.Verify(); err == nil {
+		t.Errorf("storage.Verify() accepted the old signer after ResignManifest")
+	}
+
+	s.Signer = fakeSigner{"new password"}
+	if actual, err := s.Verify(); err != nil || !actual.OK() {
+		t.Errorf("storage.Verify() returned %+v, %v after ResignManifest", actual, err)
+	}
+}
+
+func TestVerifyRolledBack(t *testing.T) {
+	ctx := context.Background()
+	dir, _ := ioutil.TempDir("", "quack-watermark")
+	defer os.RemoveAll(dir)
+
+	s, bucket, _ := newSignedStorage(t)
+	s.WatermarkPath = filepath.Join(dir, "manifest")
+	if _, err := s.Verify(); err != nil {
+		t.Fatalf("storage.Verify() returned error %v", err)
+	}
+
+	// Putting back a validly signed older manifest undoes the newer entry.
+	old, _ := bucket.ReadAll(ctx, manifestKey)
+	s.Create(testEntry("encrypted"))
+	bucket.WriteAll(ctx, manifestKey, old, nil)
+
+	if _, err := s.Verify(); err != ErrRolledBack {
+		t.Errorf("storage.Verify() returned %v for a rolled back manifest, expected %v", err, ErrRolledBack)
+	}
+	entry := testEntry("encrypted")
+	if err := s.Create(entry); err != ErrRolledBack {
+		t.Errorf("storage.Create() returned %v on a rolled back manifest, expected %v", err, ErrRolledBack)
+	}
+	if ok, _ := bucket.Exists(ctx, entry.Key); ok {
+		t.Errorf("storage.Create() saved entry %s on a rolled back manifest", entry.Key)
+	}
+
+	// Another machine only notes what it has seen itself.
+	s.WatermarkPath = filepath.Join(dir, "other")
+	if _, err := s.Verify(); err != nil {
+		t.Errorf("storage.Verify() returned error %v without a watermark", err)
+	}
+}
+
+func TestManifestConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	s, bucket, entries := newSignedStorage(t)
+	other := &Storage{Backend: s.Backend, Signer: s.Signer}
+
+	// Someone else saves an entry while this one is updating the manifest.
+	theirs := testEntry("theirs")
+	calls := 0
+	err := s.updateManifest(ctx, bucket, func(m *manifest) {
+		if calls++; calls == 1 {
+			if err := other.Create(theirs); err != nil {
+				t.Fatalf("storage.Create(%v) returned error %v", theirs, err)
+			}
+		}
+		m.remove(entries[0].Key)
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("storage.updateManifest() returned %v after %d tries, expected to succeed on the second", err, calls)
+	}
+
+	m, _, err := s.readManifest(ctx, bucket)
+	if err != nil {
+		t.Fatalf("storage.readManifest() returned error %v", err)
+	}
+	var keys []string
+	for _, r := range m.Records {
+		keys = append(keys, r.Key)
+	}
+	expected := []string{entries[1].Key, entries[2].Key, theirs.Key}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("storage.updateManifest() left records for %v, expected %v", keys, expected)
+	}
+}
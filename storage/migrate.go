@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"time"
+
+	"gocloud.dev/blob"
+)
+
+// MigrateKeys renames entries whose keys predate time-sortable keys, calling
+// renamed after each one is moved. An entry's key is bound to its ciphertext,
+// so each one is decrypted and encrypted again under its new key. Running it
+// again after an interruption picks up where it left off.
+func (s *Storage) MigrateKeys(renamed func(oldKey, newKey string)) (int, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var keys []string
+	err = listEntries(ctx, bucket, "", func(obj *blob.ListObject) bool {
+		if _, ok := KeyTime(obj.Key); !ok {
+			keys = append(keys, obj.Key)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, key := range keys {
+		entry, err := readFromBucketByKey(ctx, bucket, key)
+		if err != nil {
+			return i, err
+		}
+
+		if err := entry.SetDecryptedContent(); err != nil {
+			return i, err
+		}
+
+		moved := entry
+		moved.Key = migratedKey(entry.Key, entry.CreatedAt)
+		if err := moved.Encrypt(entry.DecryptedContent); err != nil {
+			return i, err
+		}
+
+		// Write the new copy before removing the old one, so an interruption
+		// can leave a duplicate behind but never lose an entry.
+		if err := s.Update(moved); err != nil {
+			return i, err
+		}
+
+		if err := s.removeRenamed(ctx, bucket, entry); err != nil {
+			return i, err
+		}
+
+		if renamed != nil {
+			renamed(entry.Key, moved.Key)
+		}
+	}
+
+	return len(keys), nil
+}
+
+// removeRenamed deletes the old key of an entry that now lives under a new
+// one, as long as it is unchanged since it was read. Unlike Delete it skips
+// the trash, as there is nothing to restore, but leaves a Tombstone so that
+// Sync removes the old key from other buckets too.
+func (s *Storage) removeRenamed(ctx context.Context, bucket *blob.Bucket, entry Entry) error {
+	if err := s.checkManifest(ctx, bucket); err != nil {
+		return err
+	}
+	attrs, _, err := matchPreconditions(ctx, bucket, entry.Key, []Precondition{entry.Unchanged()})
+	if err != nil {
+		return err
+	}
+	if err := deletePinned(ctx, bucket, s.prefix, entry.Key, attrs); err != nil {
+		return err
+	}
+
+	sum := md5.Sum([]byte(entry.Content))
+	renamed := Tombstone{Key: entry.Key, Hash: hex.EncodeToString(sum[:]), DeletedAt: time.Now().UTC()}
+	if err := writeTombstone(ctx, bucket, renamed); err != nil {
+		return err
+	}
+
+	return s.updateManifest(ctx, bucket, func(m *manifest) {
+		m.remove(entry.Key)
+	})
+}
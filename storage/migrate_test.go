@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMigrateKeys(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+	s := &Storage{Backend: NewMemoryBackend(), Signer: fakeSigner{"password"}}
+
+	start := time.Date(2020, 3, 9, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		entry := NewEntry(start.Add(-time.Duration(i) * time.Hour))
+		entry.Key = fmt.Sprintf("%064x", 3-i)
+		entry.Encrypt(fmt.Sprintf("entry %d", i))
+		s.Create(entry)
+	}
+	current := NewEntry(start.Add(time.Hour))
+	current.Encrypt("current")
+	s.Create(current)
+
+	var renamed []string
+	n, err := s.MigrateKeys(func(oldKey, newKey string) {
+		renamed = append(renamed, oldKey)
+	})
+	if err != nil || n != 3 || len(renamed) != 3 {
+		t.Fatalf("storage.MigrateKeys() returned %d, %v, expected 3 renamed", n, err)
+	}
+
+	entries, _ := s.Read()
+	var keys, contents []string
+	for _, entry := range entries {
+		if err := entry.SetDecryptedContent(); err != nil {
+			t.Errorf("entry %s did not decrypt after migrating: %v", entry.Key, err)
+		}
+		keys = append(keys, entry.Key)
+		contents = append(contents, entry.DecryptedContent)
+	}
+
+	expected := []string{"entry 2", "entry 1", "entry 0", "current"}
+	if fmt.Sprint(contents) != fmt.Sprint(expected) || !sort.StringsAreSorted(keys) {
+		t.Errorf("storage.Read() after migrating returned %v, expected %v", contents, expected)
+	}
+
+	if report, err := s.Verify(); err != nil || !report.OK() {
+		t.Errorf("storage.Verify() after migrating returned %+v, %v", report, err)
+	}
+
+	if trash, err := s.Trash(); err != nil || len(trash) != 0 {
+		t.Errorf("storage.Trash() after migrating returned %v, %v, expected renamed entries left out", trash, err)
+	}
+
+	if n, err := s.MigrateKeys(nil); n != 0 || err != nil {
+		t.Errorf("storage.MigrateKeys() a second time returned %d, %v, expected 0", n, err)
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jonathanwthom/quack/query"
+)
+
+// payloadVersion 1 held content, tags and mentions. Version 2 added
+// timestamps, mood, location and edit history.
+const payloadVersion = 2
+
+// payloadMarker starts every payload written since it was added, so that one
+// can't be mistaken for an entry written before payloads existed, which
+// decrypts to just its content. No typed entry starts with a NUL.
+const payloadMarker = "\x00quack payload\n"
+
+const invalidPayloadError = "Entry decrypted to a payload that can't be read."
+
+// payload is what an entry's ciphertext decrypts to. Everything about an
+// entry beyond its key and creation time is kept inside it, rather than in
+// bucket metadata, so it stays encrypted.
+type payload struct {
+	Version   int        `json:"version"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	Tags      []string   `json:"tags,omitempty"`
+	Mentions  []string   `json:"mentions,omitempty"`
+	Mood      string     `json:"mood,omitempty"`
+	Location  string     `json:"location,omitempty"`
+	History   []Revision `json:"history,omitempty"`
+}
+
+// Revision is what an entry said before it was edited
+type Revision struct {
+	Content string `json:"content"`
+	// UpdatedAt is when this content was written
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// newPayload wraps msg as the content of entry, along with the tags and
+// mentions found in it
+func newPayload(entry *Entry, msg string) payload {
+	updatedAt := entry.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = entry.CreatedAt
+	}
+
+	return payload{
+		Version:   payloadVersion,
+		Content:   msg,
+		CreatedAt: entry.CreatedAt.UTC(),
+		UpdatedAt: updatedAt.UTC(),
+		Tags:      query.Tags(msg),
+		Mentions:  query.Mentions(msg),
+		Mood:      entry.Mood,
+		Location:  entry.Location,
+		History:   entry.History,
+	}
+}
+
+func (p payload) marshal() (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	return payloadMarker + string(data), nil
+}
+
+// apply sets the payload's fields on entry. The entry's creation time comes
+// from bucket metadata, which decryption has already checked.
+func (p payload) apply(entry *Entry) {
+	entry.DecryptedContent = p.Content
+	entry.UpdatedAt = p.UpdatedAt
+	if entry.UpdatedAt.IsZero() {
+		entry.UpdatedAt = entry.CreatedAt
+	}
+	entry.Tags, entry.Mentions = p.Tags, p.Mentions
+	entry.Mood, entry.Location = p.Mood, p.Location
+	entry.History = p.History
+}
+
+// parsePayload reads decrypted plaintext. Entries written before payloads
+// existed decrypt to just their content, whose tags and mentions are found
+// the same way they would be when writing.
+func parsePayload(plaintext string) (payload, error) {
+	var p payload
+	if strings.HasPrefix(plaintext, payloadMarker) {
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(plaintext, payloadMarker)), &p); err != nil || p.Version < 1 {
+			return p, errors.New(invalidPayloadError)
+		}
+		return p, nil
+	}
+
+	return payload{
+		Content:  plaintext,
+		Tags:     query.Tags(plaintext),
+		Mentions: query.Mentions(plaintext),
+	}, nil
+}
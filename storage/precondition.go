@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrConflict is returned by Update and Delete when a Precondition no longer
+// holds, because the entry was changed in storage since it was read
+var ErrConflict = errors.New("entry was changed in storage since it was read")
+
+// Precondition makes Update or Delete conditional on what is stored. The
+// zero value always holds.
+//
+// Storage checks preconditions just before writing or deleting. Backends
+// that support conditional requests, Google Cloud Storage by generation and
+// Azure by ETag, also refuse the write or delete itself if the entry changes
+// after that check; on others one racing with the check can still slip
+// through.
+type Precondition struct {
+	// ETag, if set, must match the stored entry's ETag, as in Object
+	ETag string
+	// ModTime, if set, must match when the stored entry was last written
+	ModTime time.Time
+	// Absent requires that nothing is stored under the key yet
+	Absent bool
+}
+
+// Unchanged returns a precondition that holds while the entry is stored as
+// it was when it was read
+func (entry *Entry) Unchanged() Precondition {
+	return Precondition{ETag: entry.ETag, ModTime: entry.ModTime}
+}
+
+func (p Precondition) isZero() bool {
+	return p.ETag == "" && p.ModTime.IsZero() && !p.Absent
+}
+
+// checkPreconditions returns ErrConflict unless what is stored under key
+// meets every one of conds, along with a hook that makes the write itself
+// conditional where the backend allows it. Both are nil without conditions.
+func checkPreconditions(ctx context.Context, bucket *blob.Bucket, key string, conds []Precondition) (func(func(interface{}) bool) error, error) {
+	attrs, checked, err := matchPreconditions(ctx, bucket, key, conds)
+	if err != nil || !checked {
+		return nil, err
+	}
+
+	return pinned(attrs), nil
+}
+
+// matchPreconditions returns ErrConflict unless what is stored under key
+// meets every one of conds, along with the attributes they were checked
+// against, nil if nothing is stored. checked is false without conditions.
+func matchPreconditions(ctx context.Context, bucket *blob.Bucket, key string, conds []Precondition) (attrs *blob.Attributes, checked bool, err error) {
+	var active []Precondition
+	for _, p := range conds {
+		if !p.isZero() {
+			active = append(active, p)
+		}
+	}
+	if len(active) == 0 {
+		return nil, false, nil
+	}
+
+	attrs, err = bucket.Attributes(ctx, key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		attrs, err = nil, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, p := range active {
+		if attrs == nil {
+			if !p.Absent {
+				return nil, false, ErrConflict
+			}
+			continue
+		}
+
+		if p.Absent ||
+			(p.ETag != "" && p.ETag != hex.EncodeToString(attrs.MD5)) ||
+			(!p.ModTime.IsZero() && !p.ModTime.Equal(attrs.ModTime)) {
+			return nil, false, ErrConflict
+		}
+	}
+
+	return attrs, true, nil
+}
+
+// pinned returns a BeforeWrite hook that only lets the write through if the
+// object is still the one described by attrs, or still absent if attrs is
+// nil, on backends that can check that themselves
+func pinned(attrs *blob.Attributes) func(func(interface{}) bool) error {
+	return func(as func(interface{}) bool) error {
+		var object **gcs.ObjectHandle
+		if as(&object) {
+			cond := gcs.Conditions{DoesNotExist: true}
+			if attrs != nil {
+				var stored gcs.ObjectAttrs
+				if !attrs.As(&stored) {
+					return nil
+				}
+				cond = gcs.Conditions{GenerationMatch: stored.Generation}
+			}
+			*object = (*object).If(cond)
+			return nil
+		}
+
+		var upload *azblob.UploadStreamToBlockBlobOptions
+		if as(&upload) {
+			conds := &upload.AccessConditions.ModifiedAccessConditions
+			if attrs == nil {
+				conds.IfNoneMatch = azblob.ETagAny
+				return nil
+			}
+			var stored azblob.BlobGetPropertiesResponse
+			if attrs.As(&stored) {
+				conds.IfMatch = stored.ETag()
+			}
+		}
+
+		return nil
+	}
+}
+
+// deletePinned deletes key only if it is still the object described by
+// attrs, on backends that can check that themselves, and returns ErrConflict
+// if it isn't. Elsewhere it deletes key regardless. The driver clients used
+// for the check see keys as they are stored, with the prefix the bucket adds.
+func deletePinned(ctx context.Context, bucket *blob.Bucket, prefix, key string, attrs *blob.Attributes) error {
+	if attrs == nil {
+		return bucket.Delete(ctx, key)
+	}
+
+	var client *gcs.Client
+	var object gcs.ObjectAttrs
+	if bucket.As(&client) && attrs.As(&object) {
+		err := client.Bucket(object.Bucket).Object(object.Name).If(gcs.Conditions{GenerationMatch: object.Generation}).Delete(ctx)
+		if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusPreconditionFailed {
+			return ErrConflict
+		}
+		return err
+	}
+
+	var container *azblob.ContainerURL
+	var props azblob.BlobGetPropertiesResponse
+	if bucket.As(&container) && attrs.As(&props) {
+		conds := azblob.BlobAccessConditions{
+			ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfMatch: props.ETag()},
+		}
+		_, err := container.NewBlockBlobURL(prefix+key).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, conds)
+		if storageErr, ok := err.(azblob.StorageError); ok && storageErr.ServiceCode() == azblob.ServiceCodeConditionNotMet {
+			return ErrConflict
+		}
+		return err
+	}
+
+	return bucket.Delete(ctx, key)
+}
+
+// conflict turns a backend's refusal of a conditional write into ErrConflict
+func conflict(err error) error {
+	if err != nil && gcerrors.Code(err) == gcerrors.FailedPrecondition {
+		return ErrConflict
+	}
+
+	return err
+}
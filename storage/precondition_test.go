@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+func TestPreconditions(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+	s := New(NewMemoryBackend())
+
+	entry := NewEntry(time.Now())
+	entry.Encrypt("Hello World!")
+	if err := s.Create(entry); err != nil {
+		t.Fatalf("storage.Create() returned error %v", err)
+	}
+	if err := s.Create(entry); err != ErrConflict {
+		t.Errorf("storage.Create() of an existing key returned %v, expected ErrConflict", err)
+	}
+
+	mine, _ := s.ReadByKey(entry.Key)
+	theirs, _ := s.ReadByKey(entry.Key)
+	if mine.ETag == "" || mine.ModTime.IsZero() {
+		t.Errorf("storage.ReadByKey() returned ETag %q and ModTime %v, expected both set", mine.ETag, mine.ModTime)
+	}
+
+	theirs.Encrypt("Hello from another machine")
+	if err := s.Update(theirs, theirs.Unchanged()); err != nil {
+		t.Fatalf("storage.Update() of an unchanged entry returned error %v", err)
+	}
+
+	mine.Encrypt("Hello from this machine")
+	if err := s.Update(mine, mine.Unchanged()); err != ErrConflict {
+		t.Errorf("storage.Update() of an entry changed since it was read returned %v, expected ErrConflict", err)
+	}
+	if err := s.Delete(mine.Key, mine.Unchanged()); err != ErrConflict {
+		t.Errorf("storage.Delete() of an entry changed since it was read returned %v, expected ErrConflict", err)
+	}
+
+	current, _ := s.ReadByKey(entry.Key)
+	current.SetDecryptedContent()
+	if current.DecryptedContent != "Hello from another machine" {
+		t.Errorf("storage.Update() with a stale precondition overwrote the entry with %q", current.DecryptedContent)
+	}
+
+	if err := s.Delete(current.Key, current.Unchanged()); err != nil {
+		t.Errorf("storage.Delete() of an unchanged entry returned error %v", err)
+	}
+	if err := s.Update(current, current.Unchanged()); err != ErrConflict {
+		t.Errorf("storage.Update() of a deleted entry returned %v, expected ErrConflict", err)
+	}
+	if err := s.Update(current); err != nil {
+		t.Errorf("storage.Update() without preconditions returned error %v", err)
+	}
+}
+
+func TestPinnedAzure(t *testing.T) {
+	var opts azblob.UploadStreamToBlockBlobOptions
+	as := func(i interface{}) bool {
+		p, ok := i.(**azblob.UploadStreamToBlockBlobOptions)
+		if ok {
+			*p = &opts
+		}
+		return ok
+	}
+
+	pinned(nil)(as)
+	if opts.AccessConditions.ModifiedAccessConditions.IfNoneMatch != azblob.ETagAny {
+		t.Errorf("storage.pinned(nil) did not require the blob to be absent")
+	}
+}
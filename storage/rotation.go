@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gocloud.dev/gcerrors"
+)
+
+// rotationKey is where a QUACKWORD rotation in progress keeps its checkpoint
+const rotationKey = reservedPrefix + "rotation.json"
+
+// Rotation is the checkpoint of a QUACKWORD rotation that is re-encrypting
+// the journal's entries with a new data key, so an interrupted rotation can
+// pick up where it stopped
+type Rotation struct {
+	// KeyID is the hex-encoded ID of the data key entries are moving to
+	KeyID string `json:"keyId"`
+	// PageToken resumes iterating after the last entry dealt with
+	PageToken string `json:"pageToken,omitempty"`
+	// Reencrypted counts the entries re-encrypted so far
+	Reencrypted int       `json:"reencrypted"`
+	StartedAt   time.Time `json:"startedAt"`
+}
+
+// ReadRotation returns the checkpoint of the rotation in progress, or nil if
+// there is none
+func (s *Storage) ReadRotation() (*Rotation, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := bucket.ReadAll(ctx, rotationKey)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(Rotation)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// WriteRotation saves a checkpoint of the rotation in progress
+func (s *Storage) WriteRotation(r Rotation) error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return bucket.WriteAll(ctx, rotationKey, data, nil)
+}
+
+// ClearRotation removes the checkpoint once a rotation is finished
+func (s *Storage) ClearRotation() error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = bucket.Delete(ctx, rotationKey)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotation(t *testing.T) {
+	s := New(NewMemoryBackend())
+
+	if r, err := s.ReadRotation(); r != nil || err != nil {
+		t.Errorf("storage.ReadRotation() of a new journal returned %+v, %v, expected nil", r, err)
+	}
+
+	saved := Rotation{KeyID: "0102030405060708", PageToken: "2026/10/18/01JAB3X5Y7Z9QWERTYUIOPASDF", Reencrypted: 3, StartedAt: time.Now().UTC()}
+	if err := s.WriteRotation(saved); err != nil {
+		t.Fatalf("storage.WriteRotation() returned error %v", err)
+	}
+
+	r, err := s.ReadRotation()
+	if err != nil || r == nil || r.PageToken != saved.PageToken || r.Reencrypted != saved.Reencrypted || !r.StartedAt.Equal(saved.StartedAt) {
+		t.Errorf("storage.ReadRotation() returned %+v, %v, expected %+v", r, err, saved)
+	}
+
+	if entries, _ := s.Read(); len(entries) != 0 {
+		t.Errorf("storage.Read() returned the rotation checkpoint as an entry")
+	}
+
+	if err := s.ClearRotation(); err != nil {
+		t.Errorf("storage.ClearRotation() returned error %v", err)
+	}
+	if err := s.ClearRotation(); err != nil {
+		t.Errorf("storage.ClearRotation() without a rotation returned error %v", err)
+	}
+	if r, _ := s.ReadRotation(); r != nil {
+		t.Errorf("storage.ReadRotation() after storage.ClearRotation() returned %+v, expected nil", r)
+	}
+}
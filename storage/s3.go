@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/s3blob"
+)
+
+// defaultS3CompatibleRegion is signed into requests to custom endpoints when
+// no region is configured; MinIO and friends accept it.
+const defaultS3CompatibleRegion = "us-east-1"
+
+// NewS3Backend opens an S3 bucket, or a bucket on an S3-compatible service if
+// an endpoint is given. Static credentials are used if given, otherwise the
+// AWS SDK's default credential chain applies.
+func NewS3Backend(cfg S3Config) Backend {
+	return BackendFunc(func(ctx context.Context) (*blob.Bucket, error) {
+		sess, err := session.NewSession(awsConfig(cfg))
+		if err != nil {
+			return nil, err
+		}
+
+		return s3blob.OpenBucket(ctx, sess, cfg.Bucket, nil)
+	})
+}
+
+func newS3Backend(cfg Config) (Backend, error) {
+	return NewS3Backend(cfg.S3), nil
+}
+
+func awsConfig(cfg S3Config) *aws.Config {
+	config := &aws.Config{
+		Region: aws.String(cfg.Region),
+	}
+
+	if cfg.Endpoint != "" {
+		config.Endpoint = aws.String(cfg.Endpoint)
+		if cfg.Region == "" {
+			config.Region = aws.String(defaultS3CompatibleRegion)
+		}
+	}
+
+	if cfg.ForcePathStyle {
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	if cfg.DisableSSL {
+		config.DisableSSL = aws.Bool(true)
+	}
+
+	if cfg.AccessKeyID != "" {
+		config.Credentials = credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken)
+	}
+
+	return config
+}
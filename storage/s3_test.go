@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeS3List struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeS3ListObject
+}
+
+type fakeS3ListObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+// sigV4 matches a Signature Version 4 Authorization header, capturing the
+// access key, date, region and signed headers
+var sigV4 = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([^,]+), Signature=[0-9a-f]{64}$`)
+
+// newFakeS3 stands in for a path-style S3 API, checking that each request
+// is signed with Signature Version 4 for the access key
+func newFakeS3(bucket, accessKey string) *fakeServer {
+	return newFakeServer(fakeDialect{
+		root:           "/" + bucket + "/",
+		metadataPrefix: "x-amz-meta-",
+		created:        http.StatusOK,
+		deleted:        http.StatusNoContent,
+		notFound:       "NoSuchKey",
+		list: func(prefix string, objects []fakeListed) interface{} {
+			result := fakeS3List{Name: bucket, Prefix: prefix, MaxKeys: 1000, KeyCount: len(objects)}
+			for _, obj := range objects {
+				result.Contents = append(result.Contents, fakeS3ListObject{
+					Key:          obj.key,
+					LastModified: obj.modTime.UTC().Format(time.RFC3339),
+					ETag:         obj.etag(),
+					Size:         len(obj.body),
+				})
+			}
+			return result
+		},
+		authorize: func(r *http.Request) error {
+			m := sigV4.FindStringSubmatch(r.Header.Get("Authorization"))
+			if m == nil || m[1] != accessKey || m[3] != defaultS3CompatibleRegion ||
+				!strings.HasPrefix(r.Header.Get("X-Amz-Date"), m[2]) {
+				return fmt.Errorf("not signed with %s for %s: %q", accessKey, defaultS3CompatibleRegion, r.Header.Get("Authorization"))
+			}
+			if signed := ";" + m[4] + ";"; !strings.Contains(signed, ";host;") || !strings.Contains(signed, ";x-amz-date;") {
+				return fmt.Errorf("host and date aren't signed: %q", m[4])
+			}
+			return nil
+		},
+	})
+}
+
+func TestS3CompatibleBackend(t *testing.T) {
+	fake := newFakeS3("journal", "minio-access-key")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	testBackend(t, NewS3Backend(S3Config{
+		Bucket:          "journal",
+		Endpoint:        server.URL,
+		ForcePathStyle:  true,
+		DisableSSL:      true,
+		AccessKeyID:     "minio-access-key",
+		SecretAccessKey: "minio-secret-key",
+	}))
+
+	if len(fake.authErrors) > 0 {
+		t.Errorf("requests to the S3 endpoint were not signed with the static credentials: %v", fake.authErrors)
+	}
+}
+
+func TestAWSConfig(t *testing.T) {
+	config := awsConfig(S3Config{Endpoint: "http://localhost:9000", ForcePathStyle: true, DisableSSL: true})
+
+	if *config.Endpoint != "http://localhost:9000" || !*config.S3ForcePathStyle || !*config.DisableSSL {
+		t.Errorf("storage.awsConfig() did not apply endpoint settings: %v", config)
+	}
+
+	if *config.Region != defaultS3CompatibleRegion {
+		t.Errorf("storage.awsConfig() returned region %s for a custom endpoint, expected %s", *config.Region, defaultS3CompatibleRegion)
+	}
+
+	config = awsConfig(S3Config{Region: "us-west-2"})
+	if config.Endpoint != nil || config.S3ForcePathStyle != nil || config.Credentials != nil {
+		t.Errorf("storage.awsConfig() set S3-compatible options for plain S3: %v", config)
+	}
+}
+
+// TestMinIO runs against a real S3-compatible server when one is available,
+// e.g. `docker run -p 9000:9000 minio/minio server /data` with a bucket
+// created and QUACK_TEST_S3_ENDPOINT=http://localhost:9000.
+func TestMinIO(t *testing.T) {
+	endpoint := os.Getenv("QUACK_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("QUACK_TEST_S3_ENDPOINT not set")
+	}
+
+	testBackend(t, NewS3Backend(S3Config{
+		Bucket:          os.Getenv("QUACK_TEST_S3_BUCKET"),
+		Endpoint:        endpoint,
+		ForcePathStyle:  true,
+		DisableSSL:      strings.HasPrefix(endpoint, "http://"),
+		AccessKeyID:     os.Getenv("QUACK_TEST_S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("QUACK_TEST_S3_SECRET_ACCESS_KEY"),
+	}))
+}
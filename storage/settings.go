@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// settingsKey is where the journal's settings are kept
+const settingsKey = reservedPrefix + "settings.json"
+
+// DefaultMaxLength is how many characters an entry can have in a journal
+// that hasn't set its own limit
+const DefaultMaxLength = 280
+
+// Unlimited is the MaxLength of a long-form journal, whose entries can be
+// any length
+const Unlimited = -1
+
+// Settings are kept with a journal, so every device writing to it follows
+// them
+type Settings struct {
+	// MaxLength is the most characters, counted with Length, an entry can
+	// have. Zero means DefaultMaxLength.
+	MaxLength int `json:"maxLength,omitempty"`
+}
+
+// Limit returns the most characters an entry can have, or zero if there is
+// no limit
+func (s Settings) Limit() int {
+	switch {
+	case s.MaxLength == 0:
+		return DefaultMaxLength
+	case s.MaxLength < 0:
+		return 0
+	}
+
+	return s.MaxLength
+}
+
+// TooLongError is returned when an entry's text is longer than the journal
+// allows
+type TooLongError struct {
+	Length int
+	Limit  int
+}
+
+func (e *TooLongError) Error() string {
+	return fmt.Sprintf("entry is %d characters long, but the journal allows at most %d", e.Length, e.Limit)
+}
+
+// ReadSettings returns the journal's settings, which are the defaults until
+// some are written
+func (s *Storage) ReadSettings() (Settings, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return readSettings(ctx, bucket)
+}
+
+// WriteSettings saves the journal's settings
+func (s *Storage) WriteSettings(settings Settings) error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	return bucket.WriteAll(ctx, settingsKey, data, nil)
+}
+
+func readSettings(ctx context.Context, bucket *blob.Bucket) (Settings, error) {
+	var settings Settings
+	data, err := bucket.ReadAll(ctx, settingsKey)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+
+	err = json.Unmarshal(data, &settings)
+	return settings, err
+}
+
+// ErrNotDecrypted is returned when saving an entry whose DecryptedContent
+// isn't set, as Encrypt does, since its length can't be checked
+var ErrNotDecrypted = errors.New("entry has ciphertext but no decrypted content to check the length of")
+
+// checkLength returns a TooLongError if e's text is longer than the journal
+// allows. An entry whose text is already stored unchanged, e.g. one being
+// re-encrypted, is let through even if the limit has been lowered since.
+func checkLength(ctx context.Context, bucket *blob.Bucket, e Entry) error {
+	if e.Content != "" && e.DecryptedContent == "" {
+		return ErrNotDecrypted
+	}
+
+	settings, err := readSettings(ctx, bucket)
+	if err != nil {
+		return err
+	}
+
+	limit := settings.Limit()
+	length := Length(e.DecryptedContent)
+	if limit == 0 || length <= limit {
+		return nil
+	}
+
+	stored, err := readFromBucketByKey(ctx, bucket, e.Key)
+	if err == nil && stored.SetDecryptedContent() == nil && stored.DecryptedContent == e.DecryptedContent {
+		return nil
+	}
+
+	return &TooLongError{Length: length, Limit: limit}
+}
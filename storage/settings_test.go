@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSettings(t *testing.T) {
+	s := New(NewMemoryBackend())
+
+	settings, err := s.ReadSettings()
+	if err != nil || settings.Limit() != DefaultMaxLength {
+		t.Errorf("storage.ReadSettings() of a new journal returned %+v, %v, expected the default limit", settings, err)
+	}
+
+	tests := []struct {
+		maxLength int
+		expected  int
+	}{
+		{maxLength: 0, expected: DefaultMaxLength},
+		{maxLength: 500, expected: 500},
+		{maxLength: Unlimited, expected: 0},
+	}
+
+	for i := 0; i < len(tests); i++ {
+		test := tests[i]
+		s.WriteSettings(Settings{MaxLength: test.maxLength})
+		settings, _ := s.ReadSettings()
+		if actual := settings.Limit(); actual != test.expected {
+			t.Errorf("storage.ReadSettings() after writing a max length of %d returned a limit of %d, expected %d", test.maxLength, actual, test.expected)
+		}
+	}
+
+	if entries, _ := s.Read(); len(entries) != 0 {
+		t.Errorf("storage.Read() returned the settings as an entry")
+	}
+}
+
+func TestCreateChecksLength(t *testing.T) {
+	os.Setenv("QUACKWORD", "password")
+	s := New(NewMemoryBackend())
+
+	entry := NewEntry(time.Now())
+	entry.Encrypt(strings.Repeat("🦆", DefaultMaxLength))
+	if err := s.Create(entry); err != nil {
+		t.Errorf("storage.Create() of an entry at the limit returned error %v", err)
+	}
+
+	// The length of an entry can only be checked if it is known.
+	undecrypted := NewEntry(time.Now())
+	undecrypted.Content = entry.Content
+	if err := s.Create(undecrypted); err != ErrNotDecrypted {
+		t.Errorf("storage.Create() of an entry without decrypted content returned %v, expected %v", err, ErrNotDecrypted)
+	}
+
+	long := NewEntry(time.Now())
+	long.Encrypt(strings.Repeat("🦆", DefaultMaxLength+1))
+	err := s.Create(long)
+	if tooLong, ok := err.(*TooLongError); !ok || tooLong.Length != DefaultMaxLength+1 || tooLong.Limit != DefaultMaxLength {
+		t.Errorf("storage.Create() of an entry over the limit returned %v, expected a TooLongError", err)
+	}
+
+	s.WriteSettings(Settings{MaxLength: Unlimited})
+	if err := s.Create(long); err != nil {
+		t.Errorf("storage.Create() in a long-form journal returned error %v", err)
+	}
+
+	// Lowering the limit doesn't stop existing entries being rewritten as
+	// they are, but does stop them being edited.
+	s.WriteSettings(Settings{MaxLength: 10})
+	if err := s.Update(long); err != nil {
+		t.Errorf("storage.Update() of an unchanged entry over a lowered limit returned error %v", err)
+	}
+
+	long.Edit(strings.Repeat("🦆", DefaultMaxLength+2), time.Now())
+	if err := s.Update(long); err == nil {
+		t.Errorf("storage.Update() of an edit over the limit returned no error")
+	}
+}
@@ -2,369 +2,400 @@ package storage
 
 import (
 	"context"
-	"crypto/sha256"
-	"fmt"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/mitchellh/go-homedir"
+	"encoding/hex"
+	"errors"
+	"github.com/jonathanwthom/quack/secure"
+	"github.com/spf13/viper"
 	"gocloud.dev/blob"
-	"gocloud.dev/blob/fileblob"
-	// gcsblob is needed but only called indirectly
-	_ "gocloud.dev/blob/gcsblob"
-	"gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcerrors"
 	"io"
-	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
-var amazonVars = []string{
-	"QUACK_S3_BUCKET_REGION",
-	"QUACK_S3_BUCKET_NAME",
-	"QUACK_AWS_ACCESS_KEY_ID",
-	"QUACK_AWS_SECRET_ACCESS_KEY",
+// reservedPrefix holds journal bookkeeping objects, which are never returned
+// as entries.
+const reservedPrefix = "_quack/"
+
+// ErrReservedKey is returned when reading, updating or deleting a key under
+// the reserved prefix, which never holds entries
+var ErrReservedKey = errors.New("key is reserved for journal bookkeeping")
+
+// headerKey is where the journal's key derivation header is kept.
+const headerKey = reservedPrefix + "header.json"
+
+// Storage implement all CRUD methods
+type Storage struct {
+	// Backend provides the bucket. If it is nil, one is picked from the
+	// viper configuration on first use.
+	Backend Backend
+	// Signer signs the journal manifest. Without one, no manifest is kept.
+	Signer Signer
+	// WatermarkPath is a local file where the newest manifest seen is
+	// noted, to catch the manifest being rolled back. Without one, rollback
+	// isn't checked.
+	WatermarkPath string
+
+	mu     sync.Mutex
+	bucket *blob.Bucket
+	// prefix is what the bucket puts before every key, which the driver
+	// clients it gives access to don't
+	prefix   string
+	identity string
 }
 
-var googleVars = []string{
-	"QUACK_GOOGLE_APPLICATION_CREDENTIALS",
-	"QUACK_GOOGLE_BUCKET_NAME",
+// New returns a Storage that keeps entries in the given backend
+func New(backend Backend) *Storage {
+	return &Storage{Backend: backend}
 }
 
-const amazon = "amazon"
-const google = "google"
+// Configure validates cfg and picks the backend it describes
+func (s *Storage) Configure(cfg Config) error {
+	backend, err := SelectBackend(cfg)
+	if err != nil {
+		return err
+	}
 
-// Storage implement all CRUD methods
-type Storage struct{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Backend = backend
+	s.identity = cfg.Identity()
 
-type cloudEnv struct {
-	name string
+	return nil
 }
 
-func (c *cloudEnv) amazon() bool {
-	return c.name == amazon
+// Identity names the journal storage was configured for, or is empty if it
+// wasn't configured or keeps nothing once the process exits
+func (s *Storage) Identity() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.identity
 }
 
-var cloud cloudEnv
+// open opens the backend's bucket once and reuses it for later calls.
+func (s *Storage) open(ctx context.Context) (*blob.Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-// Create will save a message to the cloud, or a local file.
-func (s *Storage) Create(msg string) error {
-	ctx := context.Background()
+	if s.bucket != nil {
+		return s.bucket, nil
+	}
+
+	if s.Backend == nil {
+		backend, err := SelectBackend(LoadConfig(viper.GetViper()))
+		if err != nil {
+			return nil, err
+		}
+		s.Backend = backend
+	}
 
-	if cloudConfigPresent() {
-		return writeToCloud(ctx, msg)
+	bucket, err := s.Backend.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.bucket = bucket
+	if prefixed, ok := s.Backend.(prefixedBackend); ok {
+		s.prefix = prefixed.prefix
 	}
 
-	return writeToFile(ctx, msg)
+	return bucket, nil
 }
 
-// Update rewrites and entry in storage
-func (s *Storage) Update(e Entry) error {
-	ctx := context.Background()
+// Close releases the bucket, if one was opened
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if cloudConfigPresent() {
-		return updateToCloud(ctx, e)
+	if s.bucket == nil {
+		return nil
 	}
 
-	return updateToFile(ctx, e)
-}
+	err := s.bucket.Close()
+	s.bucket = nil
 
-// Read will read the content of all messages from the cloud or local file.
-func (s *Storage) Read() ([]Entry, error) {
-	ctx := context.Background()
+	return err
+}
 
-	if cloudConfigPresent() {
-		return readFromCloud(ctx)
+// Create will save a new entry, made with NewEntry, to the configured backend.
+// It returns ErrConflict if an entry with the same key already exists.
+func (s *Storage) Create(e Entry) error {
+	if e.Key == "" {
+		return errors.New("entry has no key")
 	}
 
-	return readFromFiles(ctx)
+	return s.Update(e, Precondition{Absent: true})
 }
 
-// ReadByKey will read a single message from the cloud or local file, selected by
-// key.
-func (s *Storage) ReadByKey(key string) (Entry, error) {
+// Update rewrites and entry in storage, as long as what is stored meets
+// every one of conds, or else returns ErrConflict. Pass entry.Unchanged() to
+// only overwrite the entry as it was read. Its DecryptedContent, which
+// Encrypt sets, must be set and can't be longer than the journal's settings
+// allow. Nothing is written if the journal manifest doesn't verify.
+func (s *Storage) Update(e Entry, conds ...Precondition) error {
+	if strings.HasPrefix(e.Key, reservedPrefix) {
+		return ErrReservedKey
+	}
+
 	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
 
-	if cloudConfigPresent() {
-		return readByKeyFromCloud(ctx, key)
+	if err := checkLength(ctx, bucket, e); err != nil {
+		return err
+	}
+	if err := s.checkManifest(ctx, bucket); err != nil {
+		return err
 	}
 
-	return readByKeyFromFiles(ctx, key)
-}
+	beforeWrite, err := checkPreconditions(ctx, bucket, e.Key, conds)
+	if err != nil {
+		return err
+	}
 
-func readByKeyFromCloud(ctx context.Context, key string) (Entry, error) {
-	bucket, err := openCloudBucket(ctx)
+	hash, err := writeToBucket(ctx, e, bucket, beforeWrite)
 	if err != nil {
-		return Entry{}, err
+		return conflict(err)
 	}
-	defer bucket.Close()
 
-	return readFromBucketByKey(ctx, bucket, key)
+	return s.updateManifest(ctx, bucket, func(m *manifest) {
+		m.put(manifestRecord{Key: e.Key, CreatedAt: formatCreatedAt(e.CreatedAt), Hash: hash})
+	})
 }
 
-func readFromBucketByKey(ctx context.Context, bucket *blob.Bucket, key string) (Entry, error) {
-	res, err := bucket.ReadAll(ctx, key)
+// Read will read the content of all messages from the configured backend.
+func (s *Storage) Read() ([]Entry, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
 	if err != nil {
-		return Entry{}, err
-	}
-
-	entry := Entry{
-		// would be nice to get modtime
-		Content: string(res),
-		Key:     key,
+		return []Entry{}, err
 	}
 
-	return entry, nil
+	return readFromBucket(ctx, bucket)
 }
 
-func readByKeyFromFiles(ctx context.Context, key string) (Entry, error) {
-	bucket, err := openFileBucket()
+// ReadByKey will read a single message from the configured backend, selected
+// by key.
+func (s *Storage) ReadByKey(key string) (Entry, error) {
+	if strings.HasPrefix(key, reservedPrefix) {
+		return Entry{}, ErrReservedKey
+	}
+
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
 	if err != nil {
 		return Entry{}, err
 	}
-	defer bucket.Close()
 
 	return readFromBucketByKey(ctx, bucket, key)
 }
 
-// Delete will delete an entry by its unique key, from either the cloud or a local
-// file.
-func (s *Storage) Delete(key string) error {
-	ctx := context.Background()
-
-	if cloudConfigPresent() {
-		return deleteFromCloud(ctx, key)
+// Delete will delete an entry by its unique key from the configured backend,
+// as long as what is stored meets every one of conds, or else returns
+// ErrConflict. The entry is moved to the trash, from which it can be restored
+// until it is purged, and a Tombstone is left in its place for Sync.
+func (s *Storage) Delete(key string, conds ...Precondition) error {
+	if strings.HasPrefix(key, reservedPrefix) {
+		return ErrReservedKey
 	}
 
-	return deleteFromFile(ctx, key)
-}
-
-func deleteFromCloud(ctx context.Context, key string) error {
-	bucket, err := openCloudBucket(ctx)
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
 	if err != nil {
 		return err
 	}
-	defer bucket.Close()
 
-	err = bucket.Delete(ctx, key)
+	if err := s.checkManifest(ctx, bucket); err != nil {
+		return err
+	}
+	attrs, checked, err := matchPreconditions(ctx, bucket, key, conds)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func deleteFromFile(ctx context.Context, key string) error {
-	bucket, err := openFileBucket()
+	deletedAt := time.Now().UTC()
+	hash, err := moveToTrash(ctx, bucket, key, deletedAt)
 	if err != nil {
 		return err
 	}
-	defer bucket.Close()
 
-	err = bucket.Delete(ctx, key)
+	if checked {
+		err = deletePinned(ctx, bucket, s.prefix, key, attrs)
+	} else {
+		err = bucket.Delete(ctx, key)
+	}
+	if err == ErrConflict {
+		// The entry is still there, changed, so it doesn't belong in the
+		// trash.
+		bucket.Delete(ctx, trashPrefix+key)
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func openCloudBucket(ctx context.Context) (*blob.Bucket, error) {
-	if cloud.amazon() {
-		sess, err := session.NewSession(&aws.Config{
-			Region: aws.String(os.Getenv("S3_BUCKET_REGION")),
-		})
-		if err != nil {
-			return new(blob.Bucket), err
-		}
-
-		return s3blob.OpenBucket(ctx, sess, os.Getenv("S3_BUCKET_NAME"), nil)
+	if err := writeTombstone(ctx, bucket, Tombstone{Key: key, Hash: hash, DeletedAt: deletedAt}); err != nil {
+		return err
 	}
 
-	return blob.OpenBucket(ctx, "gs://"+os.Getenv("GOOGLE_BUCKET_NAME"))
+	return s.updateManifest(ctx, bucket, func(m *manifest) {
+		m.remove(key)
+	})
 }
 
-func openFileBucket() (*blob.Bucket, error) {
-	homeDir, err := homedir.Dir()
+// ReadHeader returns the journal header, or nil if none has been written yet.
+func (s *Storage) ReadHeader() ([]byte, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
 	if err != nil {
-		return new(blob.Bucket), err
-	}
-	dir := homeDir + "/.quack"
-	if err := os.MkdirAll(dir, 0777); err != nil {
-		return new(blob.Bucket), err
+		return nil, err
 	}
 
-	bucket, err := fileblob.OpenBucket(dir, nil)
-	if err != nil {
-		return bucket, err
+	header, err := bucket.ReadAll(ctx, headerKey)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil
 	}
 
-	return bucket, nil
+	return header, err
 }
 
-func readFromCloud(ctx context.Context) ([]Entry, error) {
-	bucket, err := openCloudBucket(ctx)
+// WriteHeader saves the journal header next to the entries.
+func (s *Storage) WriteHeader(header []byte) error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
 	if err != nil {
-		return []Entry{}, err
+		return err
 	}
-	defer bucket.Close()
 
-	return readFromBucket(ctx, bucket)
+	return bucket.WriteAll(ctx, headerKey, header, nil)
 }
 
-func readFromFiles(ctx context.Context) ([]Entry, error) {
-	bucket, err := openFileBucket()
+// ReadHeaderVersion returns the journal header along with a version for
+// WriteHeaderIf, or nil and an empty version if none has been written yet.
+func (s *Storage) ReadHeaderVersion() ([]byte, string, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
 	if err != nil {
-		return []Entry{}, err
+		return nil, "", err
 	}
-	defer bucket.Close()
-
-	return readFromBucket(ctx, bucket)
-}
-
-func readFromBucket(ctx context.Context, bucket *blob.Bucket) ([]Entry, error) {
-	var entries []Entry
-	iter := bucket.List(nil)
-
-	for {
-		obj, err := iter.Next(ctx)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return []Entry{}, err
-		}
-		res, err := bucket.ReadAll(ctx, obj.Key)
-		if err != nil {
-			return []Entry{}, err
-		}
-
-		attr, err := bucket.Attributes(ctx, obj.Key)
-		if err != nil {
-			return []Entry{}, err
-		}
 
-		rawCreatedAt := attr.Metadata["createdat"]
-		createdAt, err := time.Parse(layout, rawCreatedAt)
+	attrs, err := bucket.Attributes(ctx, headerKey)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
 
-		if err != nil {
-			return []Entry{}, err
-		}
+	header, err := bucket.ReadAll(ctx, headerKey)
+	if err != nil {
+		return nil, "", err
+	}
 
-		entry := Entry{
-			CreatedAt: createdAt,
-			Content:   string(res),
-			Key:       obj.Key,
-		}
-		entries = append(entries, entry)
+	// A header rewritten between the two reads fails WriteHeaderIf, and is
+	// read again.
+	if len(attrs.MD5) > 0 {
+		return header, hex.EncodeToString(attrs.MD5), nil
 	}
 
-	return entries, nil
+	return header, attrs.ModTime.Format(time.RFC3339Nano), nil
 }
 
-func writeToCloud(ctx context.Context, msg string) error {
-	bucket, err := openCloudBucket(ctx)
+// WriteHeaderIf saves the journal header as long as the stored one is still
+// at version, as returned by ReadHeaderVersion, or else returns
+// secure.ErrHeaderChanged.
+func (s *Storage) WriteHeaderIf(header []byte, version string) error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
 	if err != nil {
 		return err
 	}
-	defer bucket.Close()
 
-	return writeToBucket(ctx, msg, bucket)
-}
+	cond := Precondition{Absent: true}
+	if t, err := time.Parse(time.RFC3339Nano, version); err == nil {
+		cond = Precondition{ModTime: t}
+	} else if version != "" {
+		cond = Precondition{ETag: version}
+	}
 
-func updateToCloud(ctx context.Context, e Entry) error {
-	bucket, err := openCloudBucket(ctx)
-	if err != nil {
-		return err
+	beforeWrite, err := checkPreconditions(ctx, bucket, headerKey, []Precondition{cond})
+	if err == nil {
+		err = conflict(bucket.WriteAll(ctx, headerKey, header, &blob.WriterOptions{BeforeWrite: beforeWrite}))
+	}
+	if err == ErrConflict {
+		return secure.ErrHeaderChanged
 	}
-	defer bucket.Close()
 
-	return updateToBucket(ctx, e, bucket)
+	return err
 }
 
-func writeToFile(ctx context.Context, msg string) error {
-	bucket, err := openFileBucket()
+// readCreatedAt reads when the entry under key was created from its metadata
+func readCreatedAt(ctx context.Context, bucket *blob.Bucket, key string) (time.Time, error) {
+	attrs, err := bucket.Attributes(ctx, key)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	defer bucket.Close()
 
-	return writeToBucket(ctx, msg, bucket)
+	return time.Parse(layout, attrs.Metadata["createdat"])
 }
 
-func updateToFile(ctx context.Context, e Entry) error {
-	bucket, err := openFileBucket()
+func readFromBucketByKey(ctx context.Context, bucket *blob.Bucket, key string) (Entry, error) {
+	res, err := bucket.ReadAll(ctx, key)
 	if err != nil {
-		return err
+		return Entry{}, err
 	}
-	defer bucket.Close()
 
-	return updateToBucket(ctx, e, bucket)
-}
-
-func updateToBucket(ctx context.Context, e Entry, bucket *blob.Bucket) error {
-	metadata := map[string]string{"createdAt": e.CreatedAt.Format(layout)}
-	options := blob.WriterOptions{Metadata: metadata}
-	w, err := bucket.NewWriter(ctx, e.Key, &options)
+	attrs, err := bucket.Attributes(ctx, key)
 	if err != nil {
-		return err
-	}
-	_, writeErr := fmt.Fprintln(w, e.Content)
-	closeErr := w.Close()
-	if writeErr != nil {
-		return writeErr
-	}
-	if closeErr != nil {
-		return closeErr
+		return Entry{}, err
 	}
 
-	return nil
-}
-
-func writeToBucket(ctx context.Context, msg string, bucket *blob.Bucket) error {
-	sum := sha256.Sum256([]byte(time.Now().String()))
-	key := fmt.Sprintf("%x", sum)
-	metadata := map[string]string{"createdAt": time.Now().Format(layout)}
-	options := blob.WriterOptions{Metadata: metadata}
-	w, err := bucket.NewWriter(ctx, key, &options)
+	createdAt, err := time.Parse(layout, attrs.Metadata["createdat"])
 	if err != nil {
-		return err
-	}
-	_, writeErr := fmt.Fprintln(w, msg)
-	closeErr := w.Close()
-	if writeErr != nil {
-		return writeErr
+		return Entry{}, err
 	}
-	if closeErr != nil {
-		return closeErr
+
+	entry := Entry{
+		CreatedAt: createdAt,
+		Content:   string(res),
+		Key:       key,
+		ETag:      hex.EncodeToString(attrs.MD5),
+		ModTime:   attrs.ModTime,
 	}
 
-	return nil
+	return entry, nil
 }
 
-func allVarsPresent(params []string) bool {
-	result := true
-	for i := 0; i < len(params); i++ {
-		if os.Getenv(params[i]) == "" {
-			result = false
+func readFromBucket(ctx context.Context, bucket *blob.Bucket) ([]Entry, error) {
+	var entries []Entry
+	iter := iterateBucket(ctx, bucket, IterateOptions{})
+
+	for {
+		entry, err := iter.Next()
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return []Entry{}, err
+		}
+		entries = append(entries, entry)
 	}
 
-	return result
-}
-
-func (c *cloudEnv) setName() {
-	if allVarsPresent(amazonVars) {
-		c.name = amazon
-	} else if allVarsPresent(googleVars) {
-		c.name = google
-	}
+	return entries, nil
 }
 
-//would be nice to memoize?
-func cloudConfigPresent() bool {
-	if cloud.name == "" {
-		cloud.setName()
+// writeToBucket saves an entry and returns the hash of what was written.
+// beforeWrite, if set, can make the write conditional.
+func writeToBucket(ctx context.Context, e Entry, bucket *blob.Bucket, beforeWrite func(func(interface{}) bool) error) (string, error) {
+	body := []byte(e.Content + "\n")
+	metadata := map[string]string{"createdAt": e.CreatedAt.Format(layout)}
+	options := blob.WriterOptions{Metadata: metadata, BeforeWrite: beforeWrite}
+	err := bucket.WriteAll(ctx, e.Key, body, &options)
+	if err != nil {
+		return "", err
 	}
 
-	return cloud.name != ""
+	return contentHash(body), nil
 }
@@ -1,15 +1,161 @@
 package storage
 
 import (
+	"context"
+	"os"
 	"testing"
+	"time"
+
+	"github.com/jonathanwthom/quack/secure"
 )
 
+// testEntry returns a new entry with the given, already encrypted, content
+func testEntry(content string) Entry {
+	entry := NewEntry(time.Now())
+	entry.Content, entry.DecryptedContent = content, content
+
+	return entry
+}
+
 func TestCreate(t *testing.T) {
-	// write to filesystem
-	// write to cloud
+	s := New(NewMemoryBackend())
+	defer s.Close()
+
+	if err := s.Create(testEntry("encrypted")); err != nil {
+		t.Fatalf("storage.Create() returned error %v", err)
+	}
+
+	entries, err := s.Read()
+	if err != nil {
+		t.Fatalf("storage.Read() returned error %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].Content != "encrypted\n" {
+		t.Errorf("storage.Read() returned %v after storage.Create(testEntry(encrypted))", entries)
+	}
+
+	if entries[0].CreatedAt.IsZero() {
+		t.Errorf("storage.Create() did not record createdAt")
+	}
 }
 
 func TestRead(t *testing.T) {
-	// read from filesystem
-	// read from cloud
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	os.Setenv("QUACKWORD", "password")
+	secure.SetHeaderStore(s)
+	defer secure.SetHeaderStore(nil)
+
+	for i := 0; i < 2; i++ {
+		entry := NewEntry(time.Now())
+		entry.Encrypt("Hello World!")
+		s.Create(entry)
+	}
+
+	entries, err := s.Read()
+	if err != nil {
+		t.Fatalf("storage.Read() returned error %v", err)
+	}
+
+	// The journal header is stored in the bucket but is not an entry.
+	if len(entries) != 2 {
+		t.Fatalf("storage.Read() returned %d entries, expected 2", len(entries))
+	}
+
+	for _, entry := range entries {
+		if err := entry.SetDecryptedContent(); err != nil || entry.DecryptedContent != "Hello World!" {
+			t.Errorf("entry.SetDecryptedContent() returned %s, %v, expected Hello World!", entry.DecryptedContent, err)
+		}
+	}
+}
+
+func TestReadByKey(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	s.Create(testEntry("encrypted"))
+	entries, _ := s.Read()
+	key := entries[0].Key
+
+	entry, err := s.ReadByKey(key)
+	if err != nil || entry.Content != "encrypted\n" {
+		t.Errorf("storage.ReadByKey(%s) returned %v, %v", key, entry, err)
+	}
+
+	if _, err := s.ReadByKey("missing"); err == nil {
+		t.Errorf("storage.ReadByKey(missing) returned no error")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	s.Create(testEntry("before"))
+	entries, _ := s.Read()
+	entry := entries[0]
+	entry.Content, entry.DecryptedContent = "after", "after"
+
+	if err := s.Update(entry); err != nil {
+		t.Fatalf("storage.Update(%v) returned error %v", entry, err)
+	}
+
+	entries, _ = s.Read()
+	if len(entries) != 1 || entries[0].Content != "after\n" || !entries[0].CreatedAt.Equal(entry.CreatedAt) {
+		t.Errorf("storage.Read() returned %v after storage.Update(%v)", entries, entry)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	s.Create(testEntry("encrypted"))
+	entries, _ := s.Read()
+
+	if err := s.Delete(entries[0].Key); err != nil {
+		t.Fatalf("storage.Delete(%s) returned error %v", entries[0].Key, err)
+	}
+
+	key := entries[0].Key
+	entries, _ = s.Read()
+	if len(entries) != 0 {
+		t.Errorf("storage.Read() returned %v after storage.Delete()", entries)
+	}
+
+	bucket, _ := s.open(context.Background())
+	tombstones, err := readTombstones(context.Background(), bucket)
+	if _, ok := tombstones[key]; !ok || err != nil {
+		t.Errorf("storage.Delete(%s) left tombstones %v, %v, expected one for the entry", key, tombstones, err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+
+	header, err := s.ReadHeader()
+	if header != nil || err != nil {
+		t.Errorf("storage.ReadHeader() returned %s, %v for a new journal, expected nil, nil", header, err)
+	}
+
+	s.WriteHeader([]byte("header"))
+	header, err = s.ReadHeader()
+	if string(header) != "header" || err != nil {
+		t.Errorf("storage.ReadHeader() returned %s, %v, expected header", header, err)
+	}
+
+	_, version, err := s.ReadHeaderVersion()
+	if version == "" || err != nil {
+		t.Fatalf("storage.ReadHeaderVersion() returned %q, %v, expected a version", version, err)
+	}
+	if err := s.WriteHeaderIf([]byte("stale"), ""); err != secure.ErrHeaderChanged {
+		t.Errorf("storage.WriteHeaderIf(stale, none) returned %v, expected %v", err, secure.ErrHeaderChanged)
+	}
+	if err := s.WriteHeaderIf([]byte("newer"), version); err != nil {
+		t.Errorf("storage.WriteHeaderIf(newer, %s) returned error %v", version, err)
+	}
+	if err := s.WriteHeaderIf([]byte("stale"), version); err != secure.ErrHeaderChanged {
+		t.Errorf("storage.WriteHeaderIf(stale, %s) returned %v, expected %v", version, err, secure.ErrHeaderChanged)
+	}
+	if header, _ := s.ReadHeader(); string(header) != "newer" {
+		t.Errorf("storage.ReadHeader() returned %s, expected newer", header)
+	}
 }
@@ -0,0 +1,551 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/jonathanwthom/quack/secure"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// replicaKey holds a random ID that names a bucket to the buckets it is
+// synced with
+const replicaKey = reservedPrefix + "replica"
+
+// syncPrefix holds, for each bucket this one is synced with, the entries
+// both held after their last sync
+const syncPrefix = reservedPrefix + "sync/"
+
+// Sides of a sync, for SyncOptions.Prefer
+const (
+	PreferFrom = "from"
+	PreferTo   = "to"
+)
+
+// ErrDifferentJournals is returned by Sync for buckets holding journals with
+// different headers, whose entries can't be read with each other's keys
+var ErrDifferentJournals = errors.New("the buckets hold different journals")
+
+// ErrKeysDiverged is returned by Sync when each bucket has added a journal
+// key of its own since they were last synced, and neither is preferred
+var ErrKeysDiverged = errors.New("the buckets have each added a journal key")
+
+// ErrSameBucket is returned by Sync when asked to sync a bucket with itself
+var ErrSameBucket = errors.New("the buckets are the same")
+
+// SyncOptions controls how Sync settles conflicts
+type SyncOptions struct {
+	// Prefer settles conflicts, entries changed or deleted on one side and
+	// changed on the other since they were last synced, in favour of
+	// PreferFrom or PreferTo. Otherwise they are left as they are.
+	Prefer string
+}
+
+// SyncReport lists the keys of the entries Sync changed
+type SyncReport struct {
+	// Copied were copied from the first bucket to the second, and
+	// CopiedBack the other way
+	Copied     []string
+	CopiedBack []string
+	// Deleted were deleted from the second bucket because they were deleted
+	// from the first, and DeletedBack the other way
+	Deleted     []string
+	DeletedBack []string
+	// Conflicts were changed on both sides and left as they are
+	Conflicts []string
+	// Header lists the sides, PreferFrom or PreferTo, whose journal header
+	// was updated, as it is after data keys are added or the QUACKWORD
+	// changes
+	Header []string
+}
+
+// Changed reports whether Sync changed anything
+func (r SyncReport) Changed() bool {
+	return len(r.Copied)+len(r.CopiedBack)+len(r.Deleted)+len(r.DeletedBack)+len(r.Header) > 0
+}
+
+// syncBase is what two buckets both held after they were last synced
+type syncBase struct {
+	SyncedAt time.Time `json:"syncedAt"`
+	// Entries maps keys to the hex MD5 of the entry both buckets held
+	Entries map[string]string `json:"entries"`
+}
+
+// syncSide is one of the buckets being synced
+type syncSide struct {
+	storage    *Storage
+	bucket     *blob.Bucket
+	id         string
+	hashes     map[string]string
+	tombstones map[string]Tombstone
+}
+
+// Sync brings the entries in two storages into step without decrypting
+// them. Ciphertexts are copied as they are, along with their creation
+// times. An entry new or changed on one side is copied to the other, and one
+// deleted on one side is deleted from the other, unless it changed there
+// too, which is a conflict, or was restored from the trash since. The
+// journal header and settings go along, newest first. Entries are compared
+// by key and content hash against what both sides held after they were last
+// synced.
+func Sync(ctx context.Context, from, to *Storage, opts SyncOptions) (SyncReport, error) {
+	var report SyncReport
+	a, err := openSyncSide(ctx, from)
+	if err != nil {
+		return report, err
+	}
+	b, err := openSyncSide(ctx, to)
+	if err != nil {
+		return report, err
+	}
+	if a.id == b.id {
+		return report, ErrSameBucket
+	}
+
+	if report.Header, err = syncHeader(ctx, a, b, opts.Prefer); err != nil {
+		return report, err
+	}
+	if err := syncNewest(ctx, a.bucket, b.bucket, settingsKey); err != nil {
+		return report, err
+	}
+
+	base, err := readSyncBase(ctx, a.bucket, b.id)
+	if err != nil {
+		return report, err
+	}
+	if base == nil {
+		if base, err = readSyncBase(ctx, b.bucket, a.id); err != nil {
+			return report, err
+		}
+	}
+	if base == nil {
+		base = &syncBase{Entries: map[string]string{}}
+	}
+
+	synced := map[string]string{}
+	for _, key := range syncKeys(a, b) {
+		hA, hB, h0 := a.hashes[key], b.hashes[key], base.Entries[key]
+		tA, okA := a.tombstones[key]
+		tB, okB := b.tombstones[key]
+		deletedA, deletedB := okA && tA.Deleted(), okB && tB.Deleted()
+
+		var err error
+		switch {
+		case hA != "" && hB != "":
+			switch {
+			case hA == hB:
+				synced[key] = hA
+			case hA == h0:
+				err = copyEntry(ctx, b, a, key)
+				report.CopiedBack = append(report.CopiedBack, key)
+				synced[key] = hB
+			case hB == h0:
+				err = copyEntry(ctx, a, b, key)
+				report.Copied = append(report.Copied, key)
+				synced[key] = hA
+			case opts.Prefer == PreferTo:
+				err = copyEntry(ctx, b, a, key)
+				report.CopiedBack = append(report.CopiedBack, key)
+				synced[key] = hB
+			case opts.Prefer == PreferFrom:
+				err = copyEntry(ctx, a, b, key)
+				report.Copied = append(report.Copied, key)
+				synced[key] = hA
+			default:
+				report.Conflicts = append(report.Conflicts, key)
+			}
+		case hA != "":
+			switch {
+			case !deletedB || tA.RestoredAt.After(tB.DeletedAt):
+				err = copyEntry(ctx, a, b, key)
+				report.Copied = append(report.Copied, key)
+				synced[key] = hA
+			case tB.Hash == hA || opts.Prefer == PreferTo:
+				err = a.storage.Delete(key)
+				report.DeletedBack = append(report.DeletedBack, key)
+			case opts.Prefer == PreferFrom:
+				err = copyEntry(ctx, a, b, key)
+				report.Copied = append(report.Copied, key)
+				synced[key] = hA
+			default:
+				report.Conflicts = append(report.Conflicts, key)
+			}
+		case hB != "":
+			switch {
+			case !deletedA || tB.RestoredAt.After(tA.DeletedAt):
+				err = copyEntry(ctx, b, a, key)
+				report.CopiedBack = append(report.CopiedBack, key)
+				synced[key] = hB
+			case tA.Hash == hB || opts.Prefer == PreferFrom:
+				err = b.storage.Delete(key)
+				report.Deleted = append(report.Deleted, key)
+			case opts.Prefer == PreferTo:
+				err = copyEntry(ctx, b, a, key)
+				report.CopiedBack = append(report.CopiedBack, key)
+				synced[key] = hB
+			default:
+				report.Conflicts = append(report.Conflicts, key)
+			}
+		case deletedA && !deletedB && !tB.RestoredAt.After(tA.DeletedAt):
+			err = writeTombstone(ctx, b.bucket, tA)
+		case deletedB && !deletedA && !tA.RestoredAt.After(tB.DeletedAt):
+			err = writeTombstone(ctx, a.bucket, tB)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+
+	// Conflicts keep what was last synced, so they are still conflicts
+	// next time.
+	for _, key := range report.Conflicts {
+		if h0, ok := base.Entries[key]; ok {
+			synced[key] = h0
+		}
+	}
+
+	next := syncBase{SyncedAt: time.Now().UTC(), Entries: synced}
+	if err := writeSyncBase(ctx, a.bucket, b.id, next); err != nil {
+		return report, err
+	}
+
+	return report, writeSyncBase(ctx, b.bucket, a.id, next)
+}
+
+func openSyncSide(ctx context.Context, s *Storage) (*syncSide, error) {
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	side := &syncSide{storage: s, bucket: bucket, hashes: map[string]string{}}
+	if side.id, err = replicaID(ctx, bucket); err != nil {
+		return nil, err
+	}
+
+	var objects []*blob.ListObject
+	err = listEntries(ctx, bucket, "", func(obj *blob.ListObject) bool {
+		objects = append(objects, obj)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if side.hashes[obj.Key], err = objectHash(ctx, bucket, obj.Key, obj.MD5); err != nil {
+			return nil, err
+		}
+	}
+
+	if side.tombstones, err = readTombstones(ctx, bucket); err != nil {
+		return nil, err
+	}
+
+	return side, nil
+}
+
+// syncKeys lists every key either side has an entry or tombstone for
+func syncKeys(sides ...*syncSide) []string {
+	seen := map[string]bool{}
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, side := range sides {
+		for key := range side.hashes {
+			add(key)
+		}
+		for key := range side.tombstones {
+			add(key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// copyEntry copies an entry's ciphertext and creation time from one side to
+// the other, as long as the other side hasn't got a different one since it
+// was listed, and lists it in the other side's manifest
+func copyEntry(ctx context.Context, src, dst *syncSide, key string) error {
+	data, err := src.bucket.ReadAll(ctx, key)
+	if err != nil {
+		return err
+	}
+	attrs, err := src.bucket.Attributes(ctx, key)
+	if err != nil {
+		return err
+	}
+	createdAt, err := time.Parse(layout, attrs.Metadata["createdat"])
+	if err != nil {
+		return err
+	}
+
+	if err := dst.storage.checkManifest(ctx, dst.bucket); err != nil {
+		return err
+	}
+	var conds []Precondition
+	if dst.hashes[key] == "" {
+		conds = append(conds, Precondition{Absent: true})
+	}
+	beforeWrite, err := checkPreconditions(ctx, dst.bucket, key, conds)
+	if err != nil {
+		return err
+	}
+
+	options := blob.WriterOptions{Metadata: attrs.Metadata, BeforeWrite: beforeWrite}
+	if err := dst.bucket.WriteAll(ctx, key, data, &options); err != nil {
+		return conflict(err)
+	}
+
+	if err := removeTombstone(ctx, dst.bucket, key); err != nil {
+		return err
+	}
+
+	return dst.storage.updateManifest(ctx, dst.bucket, func(m *manifest) {
+		m.put(manifestRecord{Key: key, CreatedAt: formatCreatedAt(createdAt), Hash: contentHash(data)})
+	})
+}
+
+// syncHeader brings the journal header on both sides into step, returning
+// the sides, PreferFrom or PreferTo, it was written to. A side without one
+// gets a copy of the other's. Otherwise the headers must be for the same
+// journal, with the same salt, and their data keys are merged, so that none
+// added on either side is lost.
+func syncHeader(ctx context.Context, a, b *syncSide, prefer string) ([]string, error) {
+	dataA, versionA, err := a.storage.ReadHeaderVersion()
+	if err != nil {
+		return nil, err
+	}
+	dataB, versionB, err := b.storage.ReadHeaderVersion()
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(dataA, dataB) {
+		return nil, nil
+	}
+
+	merged := dataA
+	if dataA == nil {
+		merged = dataB
+	} else if dataB != nil {
+		hA, err := secure.ParseHeader(dataA)
+		if err != nil {
+			return nil, err
+		}
+		hB, err := secure.ParseHeader(dataB)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(hA.Salt, hB.Salt) {
+			return nil, ErrDifferentJournals
+		}
+
+		// Where both sides wrap the same key differently, as after the
+		// QUACKWORD changes, the newer wrapping is kept.
+		newer, older := hA, hB
+		bNewer, err := newerHeader(ctx, b.bucket, a.bucket)
+		if err != nil {
+			return nil, err
+		}
+		if bNewer {
+			newer, older = hB, hA
+		}
+		preferred := map[string]*secure.Header{PreferFrom: hA, PreferTo: hB}[prefer]
+
+		h, err := mergeHeaders(newer, older, preferred)
+		if err != nil {
+			return nil, err
+		}
+		if merged, err = h.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+
+	var written []string
+	for _, side := range []struct {
+		name    string
+		s       *syncSide
+		data    []byte
+		version string
+	}{{PreferFrom, a, dataA, versionA}, {PreferTo, b, dataB, versionB}} {
+		if bytes.Equal(side.data, merged) {
+			continue
+		}
+		if err := side.s.storage.WriteHeaderIf(merged, side.version); err != nil {
+			return written, err
+		}
+		written = append(written, side.name)
+	}
+
+	return written, nil
+}
+
+// newerHeader reports whether the header in a was written after the one in b
+func newerHeader(ctx context.Context, a, b *blob.Bucket) (bool, error) {
+	attrsA, err := a.Attributes(ctx, headerKey)
+	if err != nil {
+		return false, err
+	}
+	attrsB, err := b.Attributes(ctx, headerKey)
+	if err != nil {
+		return false, err
+	}
+
+	return attrsA.ModTime.After(attrsB.ModTime), nil
+}
+
+// mergeHeaders combines two headers for the same journal, keeping every data
+// key either has, and newer's wrapping of keys both have. The current key is
+// the one side added on top of the other's current key. If each side added
+// its own, the preferred side's is current, or without one ErrKeysDiverged
+// is returned.
+func mergeHeaders(newer, older, preferred *secure.Header) (*secure.Header, error) {
+	merged := *newer
+	merged.Keys = nil
+	if len(newer.Keys) == 0 && len(older.Keys) == 0 {
+		return &merged, nil
+	}
+
+	first := newer
+	switch {
+	case len(older.Keys) == 0 || hasDataKey(newer, older.Keys[0].ID):
+	case len(newer.Keys) == 0 || hasDataKey(older, newer.Keys[0].ID):
+		first = older
+	case preferred != nil:
+		first = preferred
+	default:
+		return nil, ErrKeysDiverged
+	}
+
+	// The keys keep first's order, followed by any only the other side has.
+	wrapped := map[string]secure.DataKey{}
+	for _, dk := range older.Keys {
+		wrapped[string(dk.ID)] = dk
+	}
+	for _, dk := range newer.Keys {
+		wrapped[string(dk.ID)] = dk
+	}
+	other := older
+	if first == older {
+		other = newer
+	}
+	for _, h := range []*secure.Header{first, other} {
+		for _, dk := range h.Keys {
+			if dk, ok := wrapped[string(dk.ID)]; ok {
+				merged.Keys = append(merged.Keys, dk)
+				delete(wrapped, string(dk.ID))
+			}
+		}
+	}
+
+	return &merged, nil
+}
+
+func hasDataKey(h *secure.Header, id []byte) bool {
+	for _, dk := range h.Keys {
+		if bytes.Equal(dk.ID, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncNewest copies the object under key to whichever side hasn't got it,
+// or the newer one over the older
+func syncNewest(ctx context.Context, a, b *blob.Bucket, key string) error {
+	dataA, err := readOptional(ctx, a, key)
+	if err != nil {
+		return err
+	}
+	dataB, err := readOptional(ctx, b, key)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(dataA, dataB) {
+		return nil
+	}
+
+	dst, data := b, dataA
+	if dataA == nil {
+		dst, data = a, dataB
+	} else if dataB != nil {
+		attrsA, err := a.Attributes(ctx, key)
+		if err != nil {
+			return err
+		}
+		attrsB, err := b.Attributes(ctx, key)
+		if err != nil {
+			return err
+		}
+		if attrsB.ModTime.After(attrsA.ModTime) {
+			dst, data = a, dataB
+		}
+	}
+
+	return dst.WriteAll(ctx, key, data, nil)
+}
+
+// readOptional reads the object under key, or returns nil if there is none
+func readOptional(ctx context.Context, bucket *blob.Bucket, key string) ([]byte, error) {
+	data, err := bucket.ReadAll(ctx, key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// replicaID returns the bucket's ID, giving it one if it has none
+func replicaID(ctx context.Context, bucket *blob.Bucket) (string, error) {
+	data, err := readOptional(ctx, bucket, replicaKey)
+	if err != nil || data != nil {
+		return string(data), err
+	}
+
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), bucket.WriteAll(ctx, replicaKey, []byte(hex.EncodeToString(id)), nil)
+}
+
+func readSyncBase(ctx context.Context, bucket *blob.Bucket, peer string) (*syncBase, error) {
+	data, err := readOptional(ctx, bucket, syncPrefix+peer+".json")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	base := new(syncBase)
+	if err := json.Unmarshal(data, base); err != nil {
+		return nil, err
+	}
+	if base.Entries == nil {
+		base.Entries = map[string]string{}
+	}
+
+	return base, nil
+}
+
+func writeSyncBase(ctx context.Context, bucket *blob.Bucket, peer string, base syncBase) error {
+	data, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+
+	return bucket.WriteAll(ctx, syncPrefix+peer+".json", data, nil)
+}
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jonathanwthom/quack/secure"
+)
+
+// syncedPair returns two storages with the given entries synced between
+// them, keyed by content
+func syncedPair(t *testing.T, contents ...string) (*Storage, *Storage, map[string]string) {
+	from, to := New(NewMemoryBackend()), New(NewMemoryBackend())
+	keys := map[string]string{}
+	for _, content := range contents {
+		entry := testEntry(content)
+		from.Create(entry)
+		keys[content] = entry.Key
+	}
+
+	if _, err := Sync(context.Background(), from, to, SyncOptions{}); err != nil {
+		t.Fatalf("storage.Sync() returned error %v", err)
+	}
+
+	return from, to, keys
+}
+
+func contents(t *testing.T, s *Storage) map[string]string {
+	entries, err := s.Read()
+	if err != nil {
+		t.Fatalf("storage.Read() returned error %v", err)
+	}
+
+	got := map[string]string{}
+	for _, entry := range entries {
+		got[entry.Key] = entry.Content
+	}
+
+	return got
+}
+
+func TestSyncCopies(t *testing.T) {
+	from, to, keys := syncedPair(t, "one", "two")
+	defer from.Close()
+	defer to.Close()
+
+	want := map[string]string{keys["one"]: "one\n", keys["two"]: "two\n"}
+	if got := contents(t, to); !reflect.DeepEqual(got, want) {
+		t.Errorf("storage.Sync() left %v in the second bucket, expected %v", got, want)
+	}
+
+	back := testEntry("three")
+	to.Create(back)
+	report, err := Sync(context.Background(), from, to, SyncOptions{})
+	if err != nil || !reflect.DeepEqual(report.CopiedBack, []string{back.Key}) || len(report.Copied) != 0 {
+		t.Errorf("storage.Sync() returned %+v, %v, expected %s copied back", report, err, back.Key)
+	}
+
+	original, _ := to.ReadByKey(back.Key)
+	entry, err := from.ReadByKey(back.Key)
+	if err != nil || !entry.CreatedAt.Equal(original.CreatedAt) {
+		t.Errorf("storage.Sync() copied %v, %v, expected it created at %v", entry, err, original.CreatedAt)
+	}
+
+	report, err = Sync(context.Background(), from, to, SyncOptions{})
+	if err != nil || report.Changed() {
+		t.Errorf("storage.Sync() returned %+v, %v for synced buckets", report, err)
+	}
+}
+
+func TestSyncUpdates(t *testing.T) {
+	from, to, keys := syncedPair(t, "one")
+	defer from.Close()
+	defer to.Close()
+
+	entry, _ := from.ReadByKey(keys["one"])
+	entry.Content, entry.DecryptedContent = "changed", "changed"
+	from.Update(entry)
+
+	report, err := Sync(context.Background(), from, to, SyncOptions{})
+	if err != nil || !reflect.DeepEqual(report.Copied, []string{keys["one"]}) {
+		t.Errorf("storage.Sync() returned %+v, %v, expected %s copied", report, err, keys["one"])
+	}
+
+	if got, _ := to.ReadByKey(keys["one"]); got.Content != "changed\n" {
+		t.Errorf("storage.Sync() left %q in the second bucket, expected changed", got.Content)
+	}
+}
+
+func TestSyncOneSidedUpdates(t *testing.T) {
+	for _, prefer := range []string{"", PreferFrom, PreferTo} {
+		from, to, keys := syncedPair(t, "one", "two")
+
+		entry, _ := from.ReadByKey(keys["one"])
+		entry.Content, entry.DecryptedContent = "from", "from"
+		from.Update(entry)
+		entry, _ = to.ReadByKey(keys["two"])
+		entry.Content, entry.DecryptedContent = "to", "to"
+		to.Update(entry)
+
+		report, err := Sync(context.Background(), from, to, SyncOptions{Prefer: prefer})
+		if err != nil {
+			t.Fatalf("storage.Sync(%q) returned error %v", prefer, err)
+		}
+		if !reflect.DeepEqual(report.Copied, []string{keys["one"]}) || !reflect.DeepEqual(report.CopiedBack, []string{keys["two"]}) {
+			t.Errorf("storage.Sync(%q) returned %+v, expected %s copied and %s copied back", prefer, report, keys["one"], keys["two"])
+		}
+
+		want := map[string]string{keys["one"]: "from\n", keys["two"]: "to\n"}
+		for _, s := range []*Storage{from, to} {
+			if got := contents(t, s); !reflect.DeepEqual(got, want) {
+				t.Errorf("storage.Sync(%q) left %v, expected %v", prefer, got, want)
+			}
+		}
+
+		from.Close()
+		to.Close()
+	}
+}
+
+func TestSyncDeletes(t *testing.T) {
+	from, to, keys := syncedPair(t, "one", "two")
+	defer from.Close()
+	defer to.Close()
+
+	from.Delete(keys["one"])
+	to.Delete(keys["two"])
+
+	report, err := Sync(context.Background(), from, to, SyncOptions{})
+	if err != nil {
+		t.Fatalf("storage.Sync() returned error %v", err)
+	}
+	if !reflect.DeepEqual(report.Deleted, []string{keys["one"]}) || !reflect.DeepEqual(report.DeletedBack, []string{keys["two"]}) {
+		t.Errorf("storage.Sync() returned %+v, expected %s deleted and %s deleted back", report, keys["one"], keys["two"])
+	}
+
+	for _, s := range []*Storage{from, to} {
+		if got := contents(t, s); len(got) != 0 {
+			t.Errorf("storage.Sync() left %v, expected no entries", got)
+		}
+	}
+
+	// A deleted entry is not brought back by a bucket that never saw it.
+	other := New(NewMemoryBackend())
+	defer other.Close()
+	Sync(context.Background(), from, other, SyncOptions{})
+	report, err = Sync(context.Background(), other, to, SyncOptions{})
+	if err != nil || report.Changed() {
+		t.Errorf("storage.Sync() returned %+v, %v, expected no changes", report, err)
+	}
+}
+
+func TestSyncConflicts(t *testing.T) {
+	tests := []struct {
+		prefer string
+		want   string
+	}{
+		{"", ""},
+		{PreferFrom, "from\n"},
+		{PreferTo, "to\n"},
+	}
+
+	for _, test := range tests {
+		from, to, keys := syncedPair(t, "one", "two")
+		key := keys["one"]
+
+		for content, s := range map[string]*Storage{"from": from, "to": to} {
+			entry, _ := s.ReadByKey(key)
+			entry.Content, entry.DecryptedContent = content, content
+			s.Update(entry)
+		}
+
+		// Changed on one side and deleted on the other
+		entry, _ := from.ReadByKey(keys["two"])
+		entry.Content, entry.DecryptedContent = "changed", "changed"
+		from.Update(entry)
+		to.Delete(keys["two"])
+
+		report, err := Sync(context.Background(), from, to, SyncOptions{Prefer: test.prefer})
+		if err != nil {
+			t.Fatalf("storage.Sync(%q) returned error %v", test.prefer, err)
+		}
+
+		if test.want == "" {
+			want := []string{key, keys["two"]}
+			if key > keys["two"] {
+				want = []string{keys["two"], key}
+			}
+			if !reflect.DeepEqual(report.Conflicts, want) {
+				t.Errorf("storage.Sync(%q) returned conflicts %v, expected %v", test.prefer, report.Conflicts, want)
+			}
+			if report.Changed() {
+				t.Errorf("storage.Sync(%q) returned %+v, expected no changes", test.prefer, report)
+			}
+		} else {
+			if len(report.Conflicts) != 0 {
+				t.Errorf("storage.Sync(%q) returned conflicts %v, expected none", test.prefer, report.Conflicts)
+			}
+			a, b := contents(t, from), contents(t, to)
+			if !reflect.DeepEqual(a, b) || a[key] != test.want {
+				t.Errorf("storage.Sync(%q) left %v and %v, expected both to hold %q", test.prefer, a, b, test.want)
+			}
+		}
+
+		from.Close()
+		to.Close()
+	}
+}
+
+func TestSyncSameBucket(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+
+	if _, err := Sync(context.Background(), s, s, SyncOptions{}); err != ErrSameBucket {
+		t.Errorf("storage.Sync() returned %v, expected %v", err, ErrSameBucket)
+	}
+}
+
+func TestSyncHeader(t *testing.T) {
+	from, to := New(NewMemoryBackend()), New(NewMemoryBackend())
+	defer from.Close()
+	defer to.Close()
+
+	header, _ := secure.NewHeader()
+	data, _ := header.Marshal()
+	from.WriteHeader(data)
+
+	report, err := Sync(context.Background(), from, to, SyncOptions{})
+	if err != nil || !reflect.DeepEqual(report.Header, []string{PreferTo}) {
+		t.Errorf("storage.Sync() returned %+v, %v, expected the header copied to", report, err)
+	}
+	if got, _ := to.ReadHeader(); string(got) != string(data) {
+		t.Errorf("storage.Sync() left header %s, expected %s", got, data)
+	}
+
+	other, _ := secure.NewHeader()
+	data, _ = other.Marshal()
+	to.WriteHeader(data)
+
+	if _, err := Sync(context.Background(), from, to, SyncOptions{}); err != ErrDifferentJournals {
+		t.Errorf("storage.Sync() returned %v for different journals, expected %v", err, ErrDifferentJournals)
+	}
+}
+
+func TestSyncMergesDataKeys(t *testing.T) {
+	from, to := New(NewMemoryBackend()), New(NewMemoryBackend())
+	defer from.Close()
+	defer to.Close()
+	defer secure.SetHeaderStore(nil)
+
+	secure.SetHeaderStore(from)
+	shared, _ := secure.AddDataKey("password")
+	if _, err := Sync(context.Background(), from, to, SyncOptions{}); err != nil {
+		t.Fatalf("storage.Sync() returned error %v", err)
+	}
+
+	keyIDs := func(s *Storage) [][]byte {
+		data, _ := s.ReadHeader()
+		h, err := secure.ParseHeader(data)
+		if err != nil {
+			t.Fatalf("secure.ParseHeader() returned error %v", err)
+		}
+		var ids [][]byte
+		for _, dk := range h.Keys {
+			ids = append(ids, dk.ID)
+		}
+		return ids
+	}
+
+	secure.SetHeaderStore(from)
+	fromKey, _ := secure.AddDataKey("password")
+	secure.SetHeaderStore(to)
+	toKey, _ := secure.AddDataKey("password")
+
+	if _, err := Sync(context.Background(), from, to, SyncOptions{}); err != ErrKeysDiverged {
+		t.Errorf("storage.Sync() returned %v for diverged keys, expected %v", err, ErrKeysDiverged)
+	}
+
+	report, err := Sync(context.Background(), from, to, SyncOptions{Prefer: PreferTo})
+	if err != nil || !reflect.DeepEqual(report.Header, []string{PreferFrom, PreferTo}) {
+		t.Errorf("storage.Sync() returned %+v, %v, expected the header updated on both sides", report, err)
+	}
+	want := [][]byte{toKey, shared, fromKey}
+	for _, s := range []*Storage{from, to} {
+		if got := keyIDs(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("storage.Sync() left data keys %x, expected %x", got, want)
+		}
+	}
+
+	secure.SetHeaderStore(from)
+	newest, _ := secure.AddDataKey("password")
+	report, err = Sync(context.Background(), from, to, SyncOptions{})
+	if err != nil || !reflect.DeepEqual(report.Header, []string{PreferTo}) {
+		t.Errorf("storage.Sync() returned %+v, %v, expected the header updated in to", report, err)
+	}
+	if got := keyIDs(to); !reflect.DeepEqual(got, append([][]byte{newest}, want...)) {
+		t.Errorf("storage.Sync() left data keys %x, expected %x first", got, newest)
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// tombstonePrefix holds a tombstone for each deleted entry, so Sync can tell
+// an entry deleted on one side from one not yet copied to it
+const tombstonePrefix = reservedPrefix + "tombstones/"
+
+// Tombstone records that an entry was deleted, and if it has since been
+// restored from the trash
+type Tombstone struct {
+	Key string `json:"key"`
+	// Hash is the hex MD5 of the entry as it was when it was deleted
+	Hash       string    `json:"hash"`
+	DeletedAt  time.Time `json:"deletedAt"`
+	RestoredAt time.Time `json:"restoredAt"`
+}
+
+// Deleted reports whether the entry is still deleted
+func (t Tombstone) Deleted() bool {
+	return t.RestoredAt.IsZero()
+}
+
+func writeTombstone(ctx context.Context, bucket *blob.Bucket, t Tombstone) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return bucket.WriteAll(ctx, tombstonePrefix+t.Key, data, nil)
+}
+
+func removeTombstone(ctx context.Context, bucket *blob.Bucket, key string) error {
+	err := bucket.Delete(ctx, tombstonePrefix+key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return nil
+	}
+
+	return err
+}
+
+// readTombstones returns every tombstone in the bucket by entry key
+func readTombstones(ctx context.Context, bucket *blob.Bucket) (map[string]Tombstone, error) {
+	tombstones := make(map[string]Tombstone)
+	iter := bucket.List(&blob.ListOptions{Prefix: tombstonePrefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err != nil {
+			if err == io.EOF {
+				return tombstones, nil
+			}
+			return nil, err
+		}
+
+		data, err := bucket.ReadAll(ctx, obj.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		var t Tombstone
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		t.Key = strings.TrimPrefix(obj.Key, tombstonePrefix)
+		tombstones[t.Key] = t
+	}
+}
+
+// objectHash returns the hex MD5 of the object under key, using md5sum from
+// its attributes or listing if the backend reported one
+func objectHash(ctx context.Context, bucket *blob.Bucket, key string, md5sum []byte) (string, error) {
+	if len(md5sum) > 0 {
+		return hex.EncodeToString(md5sum), nil
+	}
+
+	data, err := bucket.ReadAll(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// trashPrefix holds deleted entries, under their own keys, until they are
+// restored or purged. Entries in the trash are never returned by reads.
+const trashPrefix = reservedPrefix + "trash/"
+
+// ErrNotInTrash is returned when restoring an entry that isn't in the trash
+var ErrNotInTrash = errors.New("entry is not in the trash")
+
+// TrashedEntry is a deleted entry, still encrypted, with when it was deleted
+type TrashedEntry struct {
+	Entry
+	DeletedAt time.Time
+}
+
+// Trash returns the entries in the trash, in key order
+func (s *Storage) Trash() ([]TrashedEntry, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return readTrash(ctx, bucket)
+}
+
+// Restore moves an entry from the trash back to its key. It returns
+// ErrNotInTrash if it isn't there, and ErrConflict if another entry has
+// taken its key since.
+func (s *Storage) Restore(key string) error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	trashed, err := readFromBucketByKey(ctx, bucket, trashPrefix+key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return ErrNotInTrash
+	}
+	if err != nil {
+		return err
+	}
+	deletedAt, err := trashedAt(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	data := []byte(trashed.Content)
+
+	if err := s.checkManifest(ctx, bucket); err != nil {
+		return err
+	}
+	beforeWrite, err := checkPreconditions(ctx, bucket, key, []Precondition{{Absent: true}})
+	if err != nil {
+		return err
+	}
+	metadata := map[string]string{"createdAt": trashed.CreatedAt.Format(layout)}
+	options := blob.WriterOptions{Metadata: metadata, BeforeWrite: beforeWrite}
+	if err := bucket.WriteAll(ctx, key, data, &options); err != nil {
+		return conflict(err)
+	}
+
+	if err := bucket.Delete(ctx, trashPrefix+key); err != nil {
+		return err
+	}
+
+	// The tombstone is kept, marked restored, so that Sync copies the entry
+	// back to buckets it was deleted from rather than deleting it again.
+	sum := md5.Sum(data)
+	restored := Tombstone{Key: key, Hash: hex.EncodeToString(sum[:]), DeletedAt: deletedAt, RestoredAt: time.Now().UTC()}
+	if err := writeTombstone(ctx, bucket, restored); err != nil {
+		return err
+	}
+
+	return s.updateManifest(ctx, bucket, func(m *manifest) {
+		m.put(manifestRecord{Key: key, CreatedAt: formatCreatedAt(trashed.CreatedAt), Hash: contentHash(data)})
+	})
+}
+
+// UpdateTrashed replaces the content of an entry in the trash, such as to
+// re-encrypt it, keeping when it was created and deleted. It returns
+// ErrNotInTrash if it isn't there, and ErrConflict unless what is stored
+// meets every one of conds.
+func (s *Storage) UpdateTrashed(e Entry, conds ...Precondition) error {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := trashPrefix + e.Key
+	attrs, err := bucket.Attributes(ctx, key)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return ErrNotInTrash
+	}
+	if err != nil {
+		return err
+	}
+
+	beforeWrite, err := checkPreconditions(ctx, bucket, key, conds)
+	if err != nil {
+		return err
+	}
+	metadata := map[string]string{
+		"createdAt": attrs.Metadata["createdat"],
+		"deletedAt": attrs.Metadata["deletedat"],
+	}
+	options := blob.WriterOptions{Metadata: metadata, BeforeWrite: beforeWrite}
+
+	return conflict(bucket.WriteAll(ctx, key, []byte(e.Content), &options))
+}
+
+// Purge permanently deletes the entries put in the trash before the given
+// time, returning their keys
+func (s *Storage) Purge(before time.Time) ([]string, error) {
+	ctx := context.Background()
+	bucket, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	trash, err := readTrash(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	for _, trashed := range trash {
+		if !trashed.DeletedAt.Before(before) {
+			continue
+		}
+		if err := bucket.Delete(ctx, trashPrefix+trashed.Key); err != nil {
+			return purged, err
+		}
+		purged = append(purged, trashed.Key)
+	}
+
+	return purged, nil
+}
+
+// moveToTrash copies the entry under key into the trash, marked deleted at
+// the given time, and returns the hex MD5 of its contents. The entry itself
+// is left for the caller to delete.
+func moveToTrash(ctx context.Context, bucket *blob.Bucket, key string, deletedAt time.Time) (string, error) {
+	data, err := bucket.ReadAll(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	attrs, err := bucket.Attributes(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	metadata := map[string]string{
+		"createdAt": attrs.Metadata["createdat"],
+		"deletedAt": deletedAt.Format(layout),
+	}
+	if err := bucket.WriteAll(ctx, trashPrefix+key, data, &blob.WriterOptions{Metadata: metadata}); err != nil {
+		return "", err
+	}
+	sum := md5.Sum(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func readTrash(ctx context.Context, bucket *blob.Bucket) ([]TrashedEntry, error) {
+	var trash []TrashedEntry
+	iter := bucket.List(&blob.ListOptions{Prefix: trashPrefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			return trash, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := readFromBucketByKey(ctx, bucket, obj.Key)
+		if err != nil {
+			return nil, err
+		}
+		entry.Key = strings.TrimPrefix(obj.Key, trashPrefix)
+
+		deletedAt, err := trashedAt(ctx, bucket, entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		trash = append(trash, TrashedEntry{Entry: entry, DeletedAt: deletedAt})
+	}
+}
+
+// trashedAt returns when the entry under key was put in the trash
+func trashedAt(ctx context.Context, bucket *blob.Bucket, key string) (time.Time, error) {
+	attrs, err := bucket.Attributes(ctx, trashPrefix+key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(layout, attrs.Metadata["deletedat"])
+}
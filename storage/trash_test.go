@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	entry := testEntry("encrypted")
+	s.Create(entry)
+
+	if err := s.Delete(entry.Key); err != nil {
+		t.Fatalf("storage.Delete(%s) returned error %v", entry.Key, err)
+	}
+
+	if entries, _ := s.Read(); len(entries) != 0 {
+		t.Errorf("storage.Read() returned %v, expected trashed entries to be left out", entries)
+	}
+
+	trash, err := s.Trash()
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("storage.Trash() returned %v, %v, expected the deleted entry", trash, err)
+	}
+	if trash[0].Key != entry.Key || trash[0].Content != "encrypted\n" || !trash[0].CreatedAt.Equal(entry.CreatedAt) || trash[0].DeletedAt.IsZero() {
+		t.Errorf("storage.Trash() returned %+v, expected %s as it was, with when it was deleted", trash[0], entry.Key)
+	}
+
+	if _, err := s.ReadByKey(trashPrefix + entry.Key); err != ErrReservedKey {
+		t.Errorf("storage.ReadByKey() of a trashed key returned %v, expected %v", err, ErrReservedKey)
+	}
+	if err := s.Delete(trashPrefix + entry.Key); err != ErrReservedKey {
+		t.Errorf("storage.Delete() of a trashed key returned %v, expected %v", err, ErrReservedKey)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	entry := testEntry("encrypted")
+	s.Create(entry)
+	s.Delete(entry.Key)
+
+	if err := s.Restore("missing"); err != ErrNotInTrash {
+		t.Errorf("storage.Restore(missing) returned %v, expected %v", err, ErrNotInTrash)
+	}
+
+	if err := s.Restore(entry.Key); err != nil {
+		t.Fatalf("storage.Restore(%s) returned error %v", entry.Key, err)
+	}
+
+	restored, err := s.ReadByKey(entry.Key)
+	if err != nil || restored.Content != "encrypted\n" || !restored.CreatedAt.Equal(entry.CreatedAt) {
+		t.Errorf("storage.ReadByKey(%s) returned %v, %v after storage.Restore()", entry.Key, restored, err)
+	}
+	if trash, _ := s.Trash(); len(trash) != 0 {
+		t.Errorf("storage.Trash() returned %v after storage.Restore(), expected nothing", trash)
+	}
+
+	// A restored entry can't replace one written under its key since.
+	s.Delete(entry.Key)
+	s.Create(entry)
+	if err := s.Restore(entry.Key); err != ErrConflict {
+		t.Errorf("storage.Restore(%s) over a new entry returned %v, expected %v", entry.Key, err, ErrConflict)
+	}
+}
+
+func TestUpdateTrashed(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	entry := testEntry("encrypted")
+	s.Create(entry)
+	s.Delete(entry.Key)
+
+	if err := s.UpdateTrashed(testEntry("missing")); err != ErrNotInTrash {
+		t.Errorf("storage.UpdateTrashed(missing) returned %v, expected %v", err, ErrNotInTrash)
+	}
+
+	before, _ := s.Trash()
+	trashed := before[0].Entry
+	stale := trashed.Unchanged()
+	trashed.Content = "reencrypted"
+	if err := s.UpdateTrashed(trashed, stale); err != nil {
+		t.Fatalf("storage.UpdateTrashed(%s) returned error %v", entry.Key, err)
+	}
+
+	after, err := s.Trash()
+	if err != nil || len(after) != 1 || after[0].Content != "reencrypted" || !after[0].CreatedAt.Equal(entry.CreatedAt) || !after[0].DeletedAt.Equal(before[0].DeletedAt) {
+		t.Errorf("storage.Trash() returned %+v, %v after storage.UpdateTrashed(), expected the new content deleted at %v", after, err, before[0].DeletedAt)
+	}
+	if entries, _ := s.Read(); len(entries) != 0 {
+		t.Errorf("storage.Read() returned %v after storage.UpdateTrashed(), expected nothing", entries)
+	}
+
+	if err := s.UpdateTrashed(trashed, stale); err != ErrConflict {
+		t.Errorf("storage.UpdateTrashed(%s) of a changed entry returned %v, expected %v", entry.Key, err, ErrConflict)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := New(NewMemoryBackend())
+	defer s.Close()
+	entry := testEntry("encrypted")
+	s.Create(entry)
+	s.Delete(entry.Key)
+
+	purged, err := s.Purge(time.Now().Add(-time.Hour))
+	if err != nil || len(purged) != 0 {
+		t.Errorf("storage.Purge(an hour ago) returned %v, %v, expected nothing purged", purged, err)
+	}
+
+	purged, err = s.Purge(time.Now().Add(time.Hour))
+	if err != nil || len(purged) != 1 || purged[0] != entry.Key {
+		t.Errorf("storage.Purge(an hour from now) returned %v, %v, expected %s", purged, err, entry.Key)
+	}
+	if trash, _ := s.Trash(); len(trash) != 0 {
+		t.Errorf("storage.Trash() returned %v after storage.Purge(), expected nothing", trash)
+	}
+}
+
+func TestSyncRestored(t *testing.T) {
+	from, to, keys := syncedPair(t, "one")
+	defer from.Close()
+	defer to.Close()
+	key := keys["one"]
+
+	from.Delete(key)
+	Sync(context.Background(), from, to, SyncOptions{})
+	from.Restore(key)
+
+	report, err := Sync(context.Background(), from, to, SyncOptions{})
+	if err != nil || len(report.Copied) != 1 || len(report.DeletedBack) != 0 {
+		t.Errorf("storage.Sync() returned %+v, %v, expected the restored entry copied", report, err)
+	}
+	if got := contents(t, to); got[key] != "one\n" {
+		t.Errorf("storage.Sync() left %v, expected the restored entry", got)
+	}
+}
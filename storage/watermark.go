@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrRolledBack is returned when the journal manifest is older than one
+// already seen on this machine, as it is when an old copy of the bucket is
+// put back to undo later changes.
+var ErrRolledBack = errors.New("journal manifest is older than one already seen here; it may have been rolled back")
+
+// watermark is the newest manifest seen for a journal on this machine
+type watermark struct {
+	Sequence int    `json:"sequence"`
+	Records  int    `json:"records"`
+	Head     string `json:"head"`
+}
+
+func (m *manifest) watermark() watermark {
+	w := watermark{Sequence: m.Sequence, Records: len(m.Records)}
+	if len(m.Records) > 0 {
+		w.Head = m.Records[len(m.Records)-1].Chain
+	}
+
+	return w
+}
+
+// readWatermark returns the watermark kept at path, or the zero value if
+// there is none
+func readWatermark(path string) (watermark, error) {
+	var w watermark
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return w, err
+	}
+
+	return w, json.Unmarshal(data, &w)
+}
+
+// checkWatermark returns ErrRolledBack if m is older than the watermark kept
+// at WatermarkPath, and otherwise moves the watermark up to m. Nothing is
+// checked without a WatermarkPath.
+func (s *Storage) checkWatermark(m *manifest) error {
+	if s.WatermarkPath == "" {
+		return nil
+	}
+
+	w, err := readWatermark(s.WatermarkPath)
+	if err != nil {
+		return err
+	}
+	if m.Sequence < w.Sequence {
+		return ErrRolledBack
+	}
+	if m.watermark() == w {
+		return nil
+	}
+
+	data, err := json.Marshal(m.watermark())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.WatermarkPath), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.WatermarkPath, data, 0600)
+}